@@ -0,0 +1,524 @@
+package memorypool
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sync"
+)
+
+// binaryField 结构体字段的编码信息
+type binaryField struct {
+	size  int
+	blank bool // 字段名为 _, 同 encoding/binary 解码时跳过, 编码时写 0
+}
+
+// binaryStructs 缓存结构体的字段信息, map[reflect.Type][]binaryField, 不是定长类型时为 nil
+var binaryStructs sync.Map
+
+func binaryFields(t reflect.Type) []binaryField {
+	if v, ok := binaryStructs.Load(t); ok {
+		return v.([]binaryField)
+	}
+	fields := make([]binaryField, t.NumField())
+	for i := range fields {
+		sf := t.Field(i)
+		fields[i] = binaryField{size: binarySize(sf.Type), blank: sf.Name == "_"}
+		if fields[i].size < 0 {
+			fields = nil
+			break
+		}
+	}
+	binaryStructs.Store(t, fields)
+	return fields
+}
+
+// binarySize 同 binary.Size, 定长类型 t 编码后的字节数, 结构体字段之间没有填充. 不是定长类型时返回 -1
+func binarySize(t reflect.Type) int {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int8, reflect.Uint8,
+		reflect.Int16, reflect.Uint16,
+		reflect.Int32, reflect.Uint32, reflect.Float32,
+		reflect.Int64, reflect.Uint64, reflect.Float64,
+		reflect.Complex64, reflect.Complex128:
+		return int(t.Size())
+	case reflect.Array:
+		if s := binarySize(t.Elem()); s >= 0 {
+			return s * t.Len()
+		}
+	case reflect.Struct:
+		fields := binaryFields(t)
+		if fields == nil {
+			return -1
+		}
+		n := 0
+		for _, f := range fields {
+			n += f.size
+		}
+		return n
+	}
+	return -1
+}
+
+func errBinaryType(t reflect.Type) error {
+	return fmt.Errorf("memorypool: binary: invalid type %v", t)
+}
+
+// BinaryReader 按指定字节序从 []byte 读取定长数据, 类似 encoding/binary.Read,
+// 解码出的结构体和切片分配在内存池中. 整数类型必须指定宽度, 不支持 int/uint.
+//
+// 数据不足时 Uint16 等方法返回零值并记录 io.ErrUnexpectedEOF, 之后的读取都失败, 最后检查 Err 即可
+type BinaryReader struct {
+	ac    *Allocator
+	order binary.ByteOrder
+	buf   []byte
+	off   int
+	err   error
+}
+
+// NewBinaryReader 新建 BinaryReader, 从 b 按 order 读取
+func (ac *Allocator) NewBinaryReader(b []byte, order binary.ByteOrder) *BinaryReader {
+	return &BinaryReader{ac: ac, order: order, buf: b}
+}
+
+// Err 第一次读取失败的错误
+func (r *BinaryReader) Err() error {
+	return r.err
+}
+
+// Len 未读取的字节数
+func (r *BinaryReader) Len() int {
+	return len(r.buf) - r.off
+}
+
+// next 读取 n 个字节, 不足时返回 nil 并记录错误
+func (r *BinaryReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > r.Len() {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := r.buf[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+// Skip 跳过 n 个字节
+func (r *BinaryReader) Skip(n int) {
+	r.next(n)
+}
+
+// Bytes 读取 n 个字节, 与 NewBinaryReader 传入的 b 共享内存
+func (r *BinaryReader) Bytes(n int) []byte {
+	return r.next(n)
+}
+
+// Bool 非 0 为 true
+func (r *BinaryReader) Bool() bool {
+	return r.Uint8() != 0
+}
+
+// Uint8 ...
+func (r *BinaryReader) Uint8() uint8 {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+// Uint16 ...
+func (r *BinaryReader) Uint16() uint16 {
+	if b := r.next(2); b != nil {
+		return r.order.Uint16(b)
+	}
+	return 0
+}
+
+// Uint32 ...
+func (r *BinaryReader) Uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return r.order.Uint32(b)
+	}
+	return 0
+}
+
+// Uint64 ...
+func (r *BinaryReader) Uint64() uint64 {
+	if b := r.next(8); b != nil {
+		return r.order.Uint64(b)
+	}
+	return 0
+}
+
+// Int8 ...
+func (r *BinaryReader) Int8() int8 {
+	return int8(r.Uint8())
+}
+
+// Int16 ...
+func (r *BinaryReader) Int16() int16 {
+	return int16(r.Uint16())
+}
+
+// Int32 ...
+func (r *BinaryReader) Int32() int32 {
+	return int32(r.Uint32())
+}
+
+// Int64 ...
+func (r *BinaryReader) Int64() int64 {
+	return int64(r.Uint64())
+}
+
+// Float32 ...
+func (r *BinaryReader) Float32() float32 {
+	return math.Float32frombits(r.Uint32())
+}
+
+// Float64 ...
+func (r *BinaryReader) Float64() float64 {
+	return math.Float64frombits(r.Uint64())
+}
+
+// Read 同 binary.Read, data 为指向定长类型的指针或定长类型的切片, 原地解码
+func (r *BinaryReader) Read(data any) error {
+	v := reflect.ValueOf(data)
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return errBinaryType(v.Type())
+		}
+		v = v.Elem()
+	case reflect.Slice:
+	default:
+		return errBinaryType(reflect.TypeOf(data))
+	}
+	return r.readValue(v)
+}
+
+func (r *BinaryReader) readValue(v reflect.Value) error {
+	var n int
+	if v.Kind() == reflect.Slice {
+		n = binarySize(v.Type().Elem())
+		if n >= 0 {
+			n *= v.Len()
+		}
+	} else {
+		n = binarySize(v.Type())
+	}
+	if n < 0 {
+		return errBinaryType(v.Type())
+	}
+	b := r.next(n)
+	if r.err != nil {
+		return r.err
+	}
+	if v.Kind() == reflect.Slice {
+		for i := 0; i < v.Len(); i++ {
+			b = r.decode(v.Index(i), b)
+		}
+		return nil
+	}
+	r.decode(v, b)
+	return nil
+}
+
+// decode 从 b 解码 v, 返回剩下的字节
+func (r *BinaryReader) decode(v reflect.Value, b []byte) []byte {
+	order := r.order
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(b[0] != 0)
+		return b[1:]
+	case reflect.Int8:
+		v.SetInt(int64(int8(b[0])))
+		return b[1:]
+	case reflect.Uint8:
+		v.SetUint(uint64(b[0]))
+		return b[1:]
+	case reflect.Int16:
+		v.SetInt(int64(int16(order.Uint16(b))))
+		return b[2:]
+	case reflect.Uint16:
+		v.SetUint(uint64(order.Uint16(b)))
+		return b[2:]
+	case reflect.Int32:
+		v.SetInt(int64(int32(order.Uint32(b))))
+		return b[4:]
+	case reflect.Uint32:
+		v.SetUint(uint64(order.Uint32(b)))
+		return b[4:]
+	case reflect.Int64:
+		v.SetInt(int64(order.Uint64(b)))
+		return b[8:]
+	case reflect.Uint64:
+		v.SetUint(order.Uint64(b))
+		return b[8:]
+	case reflect.Float32:
+		v.SetFloat(float64(math.Float32frombits(order.Uint32(b))))
+		return b[4:]
+	case reflect.Float64:
+		v.SetFloat(math.Float64frombits(order.Uint64(b)))
+		return b[8:]
+	case reflect.Complex64:
+		v.SetComplex(complex(
+			float64(math.Float32frombits(order.Uint32(b))),
+			float64(math.Float32frombits(order.Uint32(b[4:]))),
+		))
+		return b[8:]
+	case reflect.Complex128:
+		v.SetComplex(complex(
+			math.Float64frombits(order.Uint64(b)),
+			math.Float64frombits(order.Uint64(b[8:])),
+		))
+		return b[16:]
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			b = r.decode(v.Index(i), b)
+		}
+	case reflect.Struct:
+		for i, f := range binaryFields(v.Type()) {
+			if f.blank {
+				b = b[f.size:]
+				continue
+			}
+			b = r.decode(v.Field(i), b)
+		}
+	}
+	return b
+}
+
+// ReadValue 从内存池分配 T 并解码, T 为定长类型
+func ReadValue[T any](r *BinaryReader) (*T, error) {
+	p := New[T](r.ac)
+	var zero T
+	*p = zero
+	if err := r.readValue(reflect.ValueOf(p).Elem()); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ReadSlice 从内存池分配长度为 n 的 []T 并解码, T 为定长类型
+func ReadSlice[T any](r *BinaryReader, n int) ([]T, error) {
+	size := binarySize(reflect.TypeOf((*T)(nil)).Elem())
+	if size < 0 {
+		return nil, errBinaryType(reflect.TypeOf((*T)(nil)).Elem())
+	}
+	// 先检查长度, 避免按错误的 n 分配
+	if n < 0 || (size > 0 && n > r.Len()/size) {
+		if r.err == nil {
+			r.err = io.ErrUnexpectedEOF
+		}
+		return nil, r.err
+	}
+	s := NewSlice[T](r.ac, n, n)
+	var zero T
+	for i := range s {
+		s[i] = zero
+	}
+	if err := r.readValue(reflect.ValueOf(s)); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// BinaryWriter 按指定字节序写入定长数据, 类似 encoding/binary.Write, 内容存储在内存池中
+type BinaryWriter struct {
+	ac    *Allocator
+	order binary.ByteOrder
+	buf   []byte
+}
+
+// NewBinaryWriter 新建 BinaryWriter, 按 order 写入
+func (ac *Allocator) NewBinaryWriter(order binary.ByteOrder) *BinaryWriter {
+	return &BinaryWriter{ac: ac, order: order}
+}
+
+// Bytes 写入的内容, 与 BinaryWriter 共享内存
+func (w *BinaryWriter) Bytes() []byte {
+	return w.buf
+}
+
+// Len 写入的字节数
+func (w *BinaryWriter) Len() int {
+	return len(w.buf)
+}
+
+// Reset 清空内容, 保留容量
+func (w *BinaryWriter) Reset() {
+	w.buf = w.buf[:0]
+}
+
+// alloc 在末尾扩展 n 个字节并返回这部分
+func (w *BinaryWriter) alloc(n int) []byte {
+	w.buf = w.ac.growBytes(w.buf, n)
+	l := len(w.buf)
+	w.buf = w.buf[:l+n]
+	return w.buf[l:]
+}
+
+// PutBytes 写入 p
+func (w *BinaryWriter) PutBytes(p []byte) {
+	copy(w.alloc(len(p)), p)
+}
+
+// PutBool true 写 1, false 写 0
+func (w *BinaryWriter) PutBool(v bool) {
+	var b uint8
+	if v {
+		b = 1
+	}
+	w.PutUint8(b)
+}
+
+// PutUint8 ...
+func (w *BinaryWriter) PutUint8(v uint8) {
+	w.alloc(1)[0] = v
+}
+
+// PutUint16 ...
+func (w *BinaryWriter) PutUint16(v uint16) {
+	w.order.PutUint16(w.alloc(2), v)
+}
+
+// PutUint32 ...
+func (w *BinaryWriter) PutUint32(v uint32) {
+	w.order.PutUint32(w.alloc(4), v)
+}
+
+// PutUint64 ...
+func (w *BinaryWriter) PutUint64(v uint64) {
+	w.order.PutUint64(w.alloc(8), v)
+}
+
+// PutInt8 ...
+func (w *BinaryWriter) PutInt8(v int8) {
+	w.PutUint8(uint8(v))
+}
+
+// PutInt16 ...
+func (w *BinaryWriter) PutInt16(v int16) {
+	w.PutUint16(uint16(v))
+}
+
+// PutInt32 ...
+func (w *BinaryWriter) PutInt32(v int32) {
+	w.PutUint32(uint32(v))
+}
+
+// PutInt64 ...
+func (w *BinaryWriter) PutInt64(v int64) {
+	w.PutUint64(uint64(v))
+}
+
+// PutFloat32 ...
+func (w *BinaryWriter) PutFloat32(v float32) {
+	w.PutUint32(math.Float32bits(v))
+}
+
+// PutFloat64 ...
+func (w *BinaryWriter) PutFloat64(v float64) {
+	w.PutUint64(math.Float64bits(v))
+}
+
+// Write 同 binary.Write, data 为定长类型的值, 指针或切片
+func (w *BinaryWriter) Write(data any) error {
+	v := reflect.Indirect(reflect.ValueOf(data))
+	var n int
+	if v.Kind() == reflect.Slice {
+		n = binarySize(v.Type().Elem())
+		if n >= 0 {
+			n *= v.Len()
+		}
+	} else if v.IsValid() {
+		n = binarySize(v.Type())
+	} else {
+		n = -1
+	}
+	if n < 0 {
+		return errBinaryType(reflect.TypeOf(data))
+	}
+	b := w.alloc(n)
+	if v.Kind() == reflect.Slice {
+		for i := 0; i < v.Len(); i++ {
+			b = w.encode(v.Index(i), b)
+		}
+		return nil
+	}
+	w.encode(v, b)
+	return nil
+}
+
+// encode 把 v 编码到 b, 返回剩下的字节
+func (w *BinaryWriter) encode(v reflect.Value, b []byte) []byte {
+	order := w.order
+	switch v.Kind() {
+	case reflect.Bool:
+		b[0] = 0
+		if v.Bool() {
+			b[0] = 1
+		}
+		return b[1:]
+	case reflect.Int8:
+		b[0] = byte(v.Int())
+		return b[1:]
+	case reflect.Uint8:
+		b[0] = byte(v.Uint())
+		return b[1:]
+	case reflect.Int16:
+		order.PutUint16(b, uint16(v.Int()))
+		return b[2:]
+	case reflect.Uint16:
+		order.PutUint16(b, uint16(v.Uint()))
+		return b[2:]
+	case reflect.Int32:
+		order.PutUint32(b, uint32(v.Int()))
+		return b[4:]
+	case reflect.Uint32:
+		order.PutUint32(b, uint32(v.Uint()))
+		return b[4:]
+	case reflect.Int64:
+		order.PutUint64(b, uint64(v.Int()))
+		return b[8:]
+	case reflect.Uint64:
+		order.PutUint64(b, v.Uint())
+		return b[8:]
+	case reflect.Float32:
+		order.PutUint32(b, math.Float32bits(float32(v.Float())))
+		return b[4:]
+	case reflect.Float64:
+		order.PutUint64(b, math.Float64bits(v.Float()))
+		return b[8:]
+	case reflect.Complex64:
+		c := v.Complex()
+		order.PutUint32(b, math.Float32bits(float32(real(c))))
+		order.PutUint32(b[4:], math.Float32bits(float32(imag(c))))
+		return b[8:]
+	case reflect.Complex128:
+		c := v.Complex()
+		order.PutUint64(b, math.Float64bits(real(c)))
+		order.PutUint64(b[8:], math.Float64bits(imag(c)))
+		return b[16:]
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			b = w.encode(v.Index(i), b)
+		}
+	case reflect.Struct:
+		for i, f := range binaryFields(v.Type()) {
+			if f.blank {
+				for j := range b[:f.size] {
+					b[j] = 0
+				}
+				b = b[f.size:]
+				continue
+			}
+			b = w.encode(v.Field(i), b)
+		}
+	}
+	return b
+}
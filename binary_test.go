@@ -0,0 +1,94 @@
+package memorypool
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type binaryPoint struct {
+	X, Y int16
+}
+
+type binaryRecord struct {
+	ID    uint32
+	Kind  int8
+	_     [3]byte
+	Ok    bool
+	Score float64
+	Pts   [2]binaryPoint
+	C     complex64
+}
+
+func TestBinaryReaderWriter(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	want := binaryRecord{ID: 7, Kind: -2, Ok: true, Score: 1.5, Pts: [2]binaryPoint{{1, -1}, {300, -300}}, C: complex(1, -2)}
+
+	for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+		w := ac.NewBinaryWriter(order)
+		w.PutUint16(0xABCD)
+		w.PutInt32(-3)
+		w.PutFloat32(2.5)
+		w.PutBool(true)
+		w.PutBytes([]byte("xy"))
+		assert.Nil(t, w.Write(&want))
+		assert.Nil(t, w.Write([]binaryPoint{{5, 6}, {7, 8}}))
+		w.PutInt64(-1)
+
+		// 与 encoding/binary 的编码一致
+		var std bytes.Buffer
+		for _, v := range []any{uint16(0xABCD), int32(-3), float32(2.5), true, []byte("xy"), &want, []binaryPoint{{5, 6}, {7, 8}}, int64(-1)} {
+			assert.Nil(t, binary.Write(&std, order, v))
+		}
+		assert.EqualValues(t, std.Bytes(), w.Bytes())
+
+		r := ac.NewBinaryReader(w.Bytes(), order)
+		assert.EqualValues(t, 0xABCD, r.Uint16())
+		assert.EqualValues(t, -3, r.Int32())
+		assert.EqualValues(t, 2.5, r.Float32())
+		assert.True(t, r.Bool())
+		assert.EqualValues(t, "xy", string(r.Bytes(2)))
+		got, err := ReadValue[binaryRecord](r)
+		assert.Nil(t, err)
+		pts, err := ReadSlice[binaryPoint](r, 2)
+		assert.Nil(t, err)
+		runtime.GC()
+		assert.EqualValues(t, want, *got)
+		assert.EqualValues(t, []binaryPoint{{5, 6}, {7, 8}}, pts)
+
+		var last int64
+		assert.Nil(t, r.Read(&last))
+		assert.EqualValues(t, -1, last)
+		assert.EqualValues(t, 0, r.Len())
+		assert.Nil(t, r.Err())
+
+		// 数据不足
+		assert.EqualValues(t, 0, r.Uint8())
+		assert.Equal(t, io.ErrUnexpectedEOF, r.Err())
+		_, err = ReadValue[binaryPoint](r)
+		assert.Equal(t, io.ErrUnexpectedEOF, err)
+	}
+
+	r := ac.NewBinaryReader([]byte{1, 2, 3, 4}, binary.BigEndian)
+	_, err := ReadSlice[uint32](r, 2)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	// 不是定长类型
+	r = ac.NewBinaryReader(make([]byte, 16), binary.BigEndian)
+	_, err = ReadValue[int](r)
+	assert.NotNil(t, err)
+	_, err = ReadSlice[struct{ S string }](r, 1)
+	assert.NotNil(t, err)
+	assert.NotNil(t, r.Read(binaryPoint{}))
+	assert.NotNil(t, r.Read((*binaryPoint)(nil)))
+	w := ac.NewBinaryWriter(binary.BigEndian)
+	assert.NotNil(t, w.Write([]int{1}))
+	assert.NotNil(t, w.Write(nil))
+	assert.EqualValues(t, 0, w.Len())
+
+	runtime.KeepAlive(ac)
+}
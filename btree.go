@@ -0,0 +1,477 @@
+package memorypool
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+const (
+	btreeDegree   = 16 // 最小度数, 除根节点外每个节点至少 btreeDegree-1 个 key
+	btreeMaxItems = 2*btreeDegree - 1
+)
+
+type btreeNode[K any, V any] struct {
+	n        int
+	leaf     bool
+	keys     [btreeMaxItems]K
+	vals     [btreeMaxItems]V
+	children [btreeMaxItems + 1]*btreeNode[K, V]
+}
+
+// BTree 有序 map, 节点从 Allocator 分配, 删除后的节点在内部回收复用.
+// cmp 返回负数/0/正数分别表示 a < b, a == b, a > b.
+// string 类型的 key 会通过 NewString 拷贝进内存池, value 不做拷贝.
+type BTree[K any, V any] struct {
+	ac     *Allocator
+	cmp    func(a, b K) int
+	root   *btreeNode[K, V]
+	len    int
+	free   *btreeNode[K, V] // 回收的节点, 通过 children[0] 串联
+	strKey bool
+}
+
+// NewBTree 新建 BTree
+func NewBTree[K any, V any](ac *Allocator, cmp func(a, b K) int) *BTree[K, V] {
+	var k K
+	t := New[BTree[K, V]](ac)
+	t.ac = ac
+	t.cmp = cmp
+	t.strKey = reflect.TypeOf(&k).Elem().Kind() == reflect.String
+	ac.KeepAlive(cmp) // t 在内存池中, GC 不会扫描到 cmp
+	return t
+}
+
+// Len 元素个数
+func (t *BTree[K, V]) Len() int {
+	return t.len
+}
+
+func (t *BTree[K, V]) newNode(leaf bool) *btreeNode[K, V] {
+	x := t.free
+	if x != nil {
+		t.free = x.children[0]
+		x.children[0] = nil
+	} else {
+		x = New[btreeNode[K, V]](t.ac)
+	}
+	x.leaf = leaf
+	return x
+}
+
+func (t *BTree[K, V]) releaseNode(x *btreeNode[K, V]) {
+	*x = btreeNode[K, V]{}
+	x.children[0] = t.free
+	t.free = x
+}
+
+// search 返回第一个 >= k 的下标, 以及是否相等
+func (t *BTree[K, V]) search(x *btreeNode[K, V], k K) (int, bool) {
+	lo, hi := 0, x.n
+	for lo < hi {
+		m := int(uint(lo+hi) >> 1)
+		if t.cmp(x.keys[m], k) < 0 {
+			lo = m + 1
+		} else {
+			hi = m
+		}
+	}
+	return lo, lo < x.n && t.cmp(x.keys[lo], k) == 0
+}
+
+// Get 查找 key
+func (t *BTree[K, V]) Get(k K) (v V, ok bool) {
+	for x := t.root; x != nil; {
+		i, found := t.search(x, k)
+		if found {
+			return x.vals[i], true
+		}
+		if x.leaf {
+			break
+		}
+		x = x.children[i]
+	}
+	return v, false
+}
+
+// Min 最小的元素
+func (t *BTree[K, V]) Min() (k K, v V, ok bool) {
+	x := t.root
+	if x == nil || x.n == 0 {
+		return k, v, false
+	}
+	for !x.leaf {
+		x = x.children[0]
+	}
+	return x.keys[0], x.vals[0], true
+}
+
+// Max 最大的元素
+func (t *BTree[K, V]) Max() (k K, v V, ok bool) {
+	x := t.root
+	if x == nil || x.n == 0 {
+		return k, v, false
+	}
+	for !x.leaf {
+		x = x.children[x.n]
+	}
+	return x.keys[x.n-1], x.vals[x.n-1], true
+}
+
+// Set 插入或更新 key
+func (t *BTree[K, V]) Set(k K, v V) {
+	if t.root == nil {
+		t.root = t.newNode(true)
+	}
+	if t.root.n == btreeMaxItems {
+		old := t.root
+		t.root = t.newNode(false)
+		t.root.children[0] = old
+		t.splitChild(t.root, 0)
+	}
+
+	x := t.root
+	for {
+		i, found := t.search(x, k)
+		if found {
+			x.vals[i] = v
+			return
+		}
+		if x.leaf {
+			if t.strKey {
+				s := (*string)(unsafe.Pointer(&k))
+				*s = t.ac.NewString(*s)
+			}
+			copy(x.keys[i+1:x.n+1], x.keys[i:x.n])
+			copy(x.vals[i+1:x.n+1], x.vals[i:x.n])
+			x.keys[i], x.vals[i] = k, v
+			x.n++
+			t.len++
+			return
+		}
+		if x.children[i].n == btreeMaxItems {
+			t.splitChild(x, i)
+			if c := t.cmp(k, x.keys[i]); c == 0 {
+				x.vals[i] = v
+				return
+			} else if c > 0 {
+				i++
+			}
+		}
+		x = x.children[i]
+	}
+}
+
+// splitChild 把已满的 x.children[i] 拆分为两个节点, 中间的 key 上移到 x
+func (t *BTree[K, V]) splitChild(x *btreeNode[K, V], i int) {
+	y := x.children[i]
+	z := t.newNode(y.leaf)
+	z.n = btreeDegree - 1
+	copy(z.keys[:], y.keys[btreeDegree:])
+	copy(z.vals[:], y.vals[btreeDegree:])
+	if !y.leaf {
+		copy(z.children[:], y.children[btreeDegree:])
+	}
+	mk, mv := y.keys[btreeDegree-1], y.vals[btreeDegree-1]
+	y.n = btreeDegree - 1
+	clearNodeTail(y)
+
+	copy(x.keys[i+1:x.n+1], x.keys[i:x.n])
+	copy(x.vals[i+1:x.n+1], x.vals[i:x.n])
+	copy(x.children[i+2:x.n+2], x.children[i+1:x.n+1])
+	x.keys[i], x.vals[i] = mk, mv
+	x.children[i+1] = z
+	x.n++
+}
+
+// clearNodeTail 清空 x.n 之后的槽位
+func clearNodeTail[K any, V any](x *btreeNode[K, V]) {
+	var (
+		zk K
+		zv V
+	)
+	for i := x.n; i < btreeMaxItems; i++ {
+		x.keys[i], x.vals[i] = zk, zv
+	}
+	if x.leaf {
+		return
+	}
+	for i := x.n + 1; i <= btreeMaxItems; i++ {
+		x.children[i] = nil
+	}
+}
+
+type btreeRemoveType int
+
+const (
+	btreeRemoveKey btreeRemoveType = iota
+	btreeRemoveMax
+)
+
+// Delete 删除 key, 返回 key 是否存在
+func (t *BTree[K, V]) Delete(k K) bool {
+	if t.root == nil {
+		return false
+	}
+	_, _, ok := t.remove(t.root, k, btreeRemoveKey)
+	if t.root.n == 0 && !t.root.leaf {
+		old := t.root
+		t.root = old.children[0]
+		t.releaseNode(old)
+	}
+	if ok {
+		t.len--
+	}
+	return ok
+}
+
+// remove 从以 x 为根的子树中删除, 下降之前保证子节点至少有 btreeDegree 个 key
+func (t *BTree[K, V]) remove(x *btreeNode[K, V], k K, typ btreeRemoveType) (rk K, rv V, ok bool) {
+	var (
+		i     int
+		found bool
+	)
+	switch typ {
+	case btreeRemoveMax:
+		if x.leaf {
+			x.n--
+			rk, rv = x.keys[x.n], x.vals[x.n]
+			clearNodeTail(x)
+			return rk, rv, true
+		}
+		i = x.n
+	case btreeRemoveKey:
+		i, found = t.search(x, k)
+		if x.leaf {
+			if !found {
+				return rk, rv, false
+			}
+			rk, rv = x.keys[i], x.vals[i]
+			copy(x.keys[i:], x.keys[i+1:x.n])
+			copy(x.vals[i:], x.vals[i+1:x.n])
+			x.n--
+			clearNodeTail(x)
+			return rk, rv, true
+		}
+	}
+
+	if x.children[i].n < btreeDegree {
+		t.growChild(x, i)
+		return t.remove(x, k, typ)
+	}
+
+	child := x.children[i]
+	if found {
+		// 用前驱替换
+		rk, rv = x.keys[i], x.vals[i]
+		x.keys[i], x.vals[i], _ = t.remove(child, k, btreeRemoveMax)
+		return rk, rv, true
+	}
+	return t.remove(child, k, typ)
+}
+
+// growChild 通过向兄弟节点借 key 或者与兄弟节点合并, 使 x.children[i] 至少有 btreeDegree 个 key
+func (t *BTree[K, V]) growChild(x *btreeNode[K, V], i int) {
+	child := x.children[i]
+	switch {
+	case i > 0 && x.children[i-1].n >= btreeDegree:
+		left := x.children[i-1]
+		copy(child.keys[1:child.n+1], child.keys[:child.n])
+		copy(child.vals[1:child.n+1], child.vals[:child.n])
+		child.keys[0], child.vals[0] = x.keys[i-1], x.vals[i-1]
+		if !child.leaf {
+			copy(child.children[1:child.n+2], child.children[:child.n+1])
+			child.children[0] = left.children[left.n]
+		}
+		child.n++
+		x.keys[i-1], x.vals[i-1] = left.keys[left.n-1], left.vals[left.n-1]
+		left.n--
+		clearNodeTail(left)
+
+	case i < x.n && x.children[i+1].n >= btreeDegree:
+		right := x.children[i+1]
+		child.keys[child.n], child.vals[child.n] = x.keys[i], x.vals[i]
+		if !child.leaf {
+			child.children[child.n+1] = right.children[0]
+			copy(right.children[:], right.children[1:right.n+1])
+		}
+		child.n++
+		x.keys[i], x.vals[i] = right.keys[0], right.vals[0]
+		copy(right.keys[:], right.keys[1:right.n])
+		copy(right.vals[:], right.vals[1:right.n])
+		right.n--
+		clearNodeTail(right)
+
+	default:
+		if i >= x.n {
+			i--
+			child = x.children[i]
+		}
+		right := x.children[i+1]
+		child.keys[child.n], child.vals[child.n] = x.keys[i], x.vals[i]
+		copy(child.keys[child.n+1:], right.keys[:right.n])
+		copy(child.vals[child.n+1:], right.vals[:right.n])
+		if !child.leaf {
+			copy(child.children[child.n+1:], right.children[:right.n+1])
+		}
+		child.n += right.n + 1
+
+		copy(x.keys[i:], x.keys[i+1:x.n])
+		copy(x.vals[i:], x.vals[i+1:x.n])
+		copy(x.children[i+1:], x.children[i+2:x.n+1])
+		x.n--
+		clearNodeTail(x)
+		t.releaseNode(right)
+	}
+}
+
+// Ascend 升序遍历, f 返回 false 时停止
+func (t *BTree[K, V]) Ascend(f func(k K, v V) bool) {
+	if t.root != nil {
+		t.ascend(t.root, nil, nil, f)
+	}
+}
+
+// AscendRange 升序遍历 [ge, lt) 范围内的元素
+func (t *BTree[K, V]) AscendRange(ge, lt K, f func(k K, v V) bool) {
+	if t.root != nil {
+		t.ascend(t.root, &ge, &lt, f)
+	}
+}
+
+// AscendGreaterOrEqual 升序遍历 >= ge 的元素
+func (t *BTree[K, V]) AscendGreaterOrEqual(ge K, f func(k K, v V) bool) {
+	if t.root != nil {
+		t.ascend(t.root, &ge, nil, f)
+	}
+}
+
+func (t *BTree[K, V]) ascend(x *btreeNode[K, V], ge, lt *K, f func(k K, v V) bool) bool {
+	i := 0
+	if ge != nil {
+		i, _ = t.search(x, *ge)
+	}
+	for ; i < x.n; i++ {
+		if !x.leaf && !t.ascend(x.children[i], ge, lt, f) {
+			return false
+		}
+		if lt != nil && t.cmp(x.keys[i], *lt) >= 0 {
+			return false
+		}
+		if !f(x.keys[i], x.vals[i]) {
+			return false
+		}
+	}
+	if !x.leaf {
+		return t.ascend(x.children[x.n], ge, lt, f)
+	}
+	return true
+}
+
+// Descend 降序遍历, f 返回 false 时停止
+func (t *BTree[K, V]) Descend(f func(k K, v V) bool) {
+	if t.root != nil {
+		t.descend(t.root, nil, nil, f)
+	}
+}
+
+// DescendRange 降序遍历 (gt, le] 范围内的元素
+func (t *BTree[K, V]) DescendRange(le, gt K, f func(k K, v V) bool) {
+	if t.root != nil {
+		t.descend(t.root, &le, &gt, f)
+	}
+}
+
+// DescendLessOrEqual 降序遍历 <= le 的元素
+func (t *BTree[K, V]) DescendLessOrEqual(le K, f func(k K, v V) bool) {
+	if t.root != nil {
+		t.descend(t.root, &le, nil, f)
+	}
+}
+
+func (t *BTree[K, V]) descend(x *btreeNode[K, V], le, gt *K, f func(k K, v V) bool) bool {
+	i := x.n - 1
+	if le != nil {
+		j, found := t.search(x, *le)
+		if i = j - 1; found {
+			i = j
+		}
+	}
+	if !x.leaf && !t.descend(x.children[i+1], le, gt, f) {
+		return false
+	}
+	for ; i >= 0; i-- {
+		if gt != nil && t.cmp(x.keys[i], *gt) <= 0 {
+			return false
+		}
+		if !f(x.keys[i], x.vals[i]) {
+			return false
+		}
+		if !x.leaf && !t.descend(x.children[i], le, gt, f) {
+			return false
+		}
+	}
+	return true
+}
+
+// BulkLoad 从严格升序的 keys/vals 自底向上构建, 只能在空树上调用.
+// keys 中的 string 不会再次拷贝, 调用方需保证其已在内存池中(例如通过 NewString 生成).
+func (t *BTree[K, V]) BulkLoad(keys []K, vals []V) {
+	if t.len != 0 {
+		panic("BTree: BulkLoad on non-empty tree")
+	}
+	if len(keys) != len(vals) {
+		panic("BTree: BulkLoad keys and vals length mismatch")
+	}
+	for i := 1; i < len(keys); i++ {
+		if t.cmp(keys[i-1], keys[i]) >= 0 {
+			panic("BTree: BulkLoad keys not in strictly ascending order")
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+
+	total := len(keys)
+	var children []*btreeNode[K, V]
+	for {
+		// 每层拆成 cnt 个节点, 相邻节点之间留一个 key 作为上一层的分隔 key
+		n := len(keys)
+		cnt := (n + btreeMaxItems + 1) / (btreeMaxItems + 1)
+		per := n - (cnt - 1)
+		nodes := NewSlice[*btreeNode[K, V]](t.ac, cnt, cnt)
+		upKeys := NewSlice[K](t.ac, cnt-1, cnt-1)
+		upVals := NewSlice[V](t.ac, cnt-1, cnt-1)
+
+		pos, ci := 0, 0
+		for j := 0; j < cnt; j++ {
+			sz := per / cnt
+			if j < per%cnt {
+				sz++
+			}
+			x := t.newNode(children == nil)
+			copy(x.keys[:sz], keys[pos:pos+sz])
+			copy(x.vals[:sz], vals[pos:pos+sz])
+			if children != nil {
+				copy(x.children[:sz+1], children[ci:ci+sz+1])
+				ci += sz + 1
+			}
+			x.n = sz
+			pos += sz
+			nodes[j] = x
+			if j < cnt-1 {
+				upKeys[j], upVals[j] = keys[pos], vals[pos]
+				pos++
+			}
+		}
+
+		if cnt == 1 {
+			if t.root != nil {
+				t.releaseNode(t.root)
+			}
+			t.root = nodes[0]
+			break
+		}
+		keys, vals, children = upKeys, upVals, nodes
+	}
+	t.len = total
+}
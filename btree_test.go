@@ -0,0 +1,145 @@
+package memorypool
+
+import (
+	"math/rand"
+	"runtime"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func intCmp(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func TestBTree(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	tr := NewBTree[int, int](ac, intCmp)
+	ref := map[int]int{}
+	for i := 0; i < 100_000; i++ {
+		k := rand.Intn(10_000)
+		if rand.Intn(3) == 0 {
+			_, ok := ref[k]
+			assert.EqualValues(t, ok, tr.Delete(k))
+			delete(ref, k)
+		} else {
+			tr.Set(k, i)
+			ref[k] = i
+		}
+	}
+	runtime.GC()
+
+	assert.EqualValues(t, len(ref), tr.Len())
+	keys := make([]int, 0, len(ref))
+	for k, v := range ref {
+		got, ok := tr.Get(k)
+		assert.True(t, ok)
+		assert.EqualValues(t, v, got)
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	var asc []int
+	tr.Ascend(func(k, v int) bool {
+		asc = append(asc, k)
+		return true
+	})
+	assert.EqualValues(t, keys, asc)
+
+	var desc []int
+	tr.Descend(func(k, v int) bool {
+		desc = append(desc, k)
+		return true
+	})
+	for i, j := 0, len(desc)-1; i < j; i, j = i+1, j-1 {
+		desc[i], desc[j] = desc[j], desc[i]
+	}
+	assert.EqualValues(t, keys, desc)
+
+	// 删除所有元素
+	for _, k := range keys {
+		assert.True(t, tr.Delete(k))
+	}
+	assert.EqualValues(t, 0, tr.Len())
+	_, _, ok := tr.Min()
+	assert.False(t, ok)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestBTreeRange(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	tr := NewBTree[int, string](ac, intCmp)
+	for i := 0; i < 1000; i += 2 {
+		tr.Set(i, strconv.Itoa(i))
+	}
+
+	var got []int
+	tr.AscendRange(101, 111, func(k int, v string) bool {
+		got = append(got, k)
+		return true
+	})
+	assert.EqualValues(t, []int{102, 104, 106, 108, 110}, got)
+
+	got = got[:0]
+	tr.DescendRange(110, 101, func(k int, v string) bool {
+		got = append(got, k)
+		return true
+	})
+	assert.EqualValues(t, []int{110, 108, 106, 104, 102}, got)
+
+	got = got[:0]
+	tr.AscendGreaterOrEqual(995, func(k int, v string) bool {
+		got = append(got, k)
+		return len(got) < 2
+	})
+	assert.EqualValues(t, []int{996, 998}, got)
+
+	k, v, _ := tr.Max()
+	assert.EqualValues(t, 998, k)
+	assert.EqualValues(t, "998", v)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestBTreeBulkLoad(t *testing.T) {
+	for _, n := range []int{1, 31, 32, 33, 1000, 50_000} {
+		ac := NewAlloctorFromPool(0)
+		keys := NewSlice[int](ac, n, n)
+		vals := NewSlice[int](ac, n, n)
+		for i := range keys {
+			keys[i], vals[i] = i*2, i
+		}
+		tr := NewBTree[int, int](ac, intCmp)
+		tr.BulkLoad(keys, vals)
+		assert.EqualValues(t, n, tr.Len())
+
+		i := 0
+		tr.Ascend(func(k, v int) bool {
+			assert.EqualValues(t, i*2, k)
+			assert.EqualValues(t, i, v)
+			i++
+			return true
+		})
+		assert.EqualValues(t, n, i)
+
+		// 加载后仍可正常增删
+		tr.Set(1, -1)
+		v, ok := tr.Get(1)
+		assert.True(t, ok)
+		assert.EqualValues(t, -1, v)
+		for i := 0; i < n; i++ {
+			assert.True(t, tr.Delete(i*2))
+		}
+		assert.EqualValues(t, 1, tr.Len())
+		ac.ReturnAlloctorToPool()
+	}
+}
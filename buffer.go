@@ -0,0 +1,179 @@
+package memorypool
+
+import (
+	"errors"
+	"io"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// MinRead Buffer.ReadFrom 每次 Read 时保证的最小空闲容量
+const MinRead = 512
+
+var errNegativeRead = errors.New("memorypool.Buffer: reader returned negative count from Read")
+
+// Buffer 存储在内存池中的 bytes.Buffer, 实现 io.Reader/io.Writer/io.ByteWriter/io.ReaderFrom/io.WriterTo,
+// 可以直接交给 json.NewEncoder, template.Execute, io.Copy 等使用. 扩容走内存池的扩容逻辑, 不会调用 make.
+type Buffer struct {
+	ac  *Allocator
+	buf []byte
+	off int // 读取位置
+}
+
+// NewBuffer 新建 Buffer
+func (ac *Allocator) NewBuffer() *Buffer {
+	b := New[Buffer](ac)
+	b.ac = ac
+	return b
+}
+
+// Len 未读取的字节数
+func (b *Buffer) Len() int {
+	return len(b.buf) - b.off
+}
+
+// Cap 当前容量
+func (b *Buffer) Cap() int {
+	return cap(b.buf)
+}
+
+// Bytes 未读取的内容, 与 Buffer 共享内存
+func (b *Buffer) Bytes() []byte {
+	return b.buf[b.off:]
+}
+
+// String 未读取的内容, 与 Buffer 共享内存
+func (b *Buffer) String() string {
+	if b.Len() == 0 {
+		return ""
+	}
+	return unsafe.String(&b.buf[b.off], b.Len())
+}
+
+// Reset 清空内容, 保留容量
+func (b *Buffer) Reset() {
+	b.buf = b.buf[:0]
+	b.off = 0
+}
+
+// Grow 保证至少还能写入 n 个字节而不需要扩容
+func (b *Buffer) Grow(n int) {
+	if n < 0 {
+		panic("Buffer.Grow: negative count")
+	}
+	b.grow(n)
+}
+
+// AvailableBuffer 返回长度为 0 的空闲容量, 配合 strconv.AppendXXX 后再 Write 可以避免拷贝
+func (b *Buffer) AvailableBuffer() []byte {
+	return b.buf[len(b.buf):]
+}
+
+func (b *Buffer) grow(n int) {
+	if b.off > 0 && b.off == len(b.buf) {
+		b.Reset()
+	}
+	b.buf = b.ac.growBytes(b.buf, n)
+}
+
+// Write 实现 io.Writer
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.grow(len(p))
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+// WriteString 实现 io.StringWriter
+func (b *Buffer) WriteString(s string) (int, error) {
+	b.grow(len(s))
+	b.buf = append(b.buf, s...)
+	return len(s), nil
+}
+
+// WriteByte 实现 io.ByteWriter
+func (b *Buffer) WriteByte(c byte) error {
+	b.grow(1)
+	b.buf = append(b.buf, c)
+	return nil
+}
+
+// WriteRune 写入 rune 的 UTF-8 编码
+func (b *Buffer) WriteRune(r rune) (int, error) {
+	b.grow(utf8.UTFMax)
+	n := len(b.buf)
+	b.buf = utf8.AppendRune(b.buf, r)
+	return len(b.buf) - n, nil
+}
+
+// Read 实现 io.Reader
+func (b *Buffer) Read(p []byte) (int, error) {
+	if b.Len() == 0 {
+		b.Reset()
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	n := copy(p, b.buf[b.off:])
+	b.off += n
+	return n, nil
+}
+
+// ReadByte 实现 io.ByteReader
+func (b *Buffer) ReadByte() (byte, error) {
+	if b.Len() == 0 {
+		b.Reset()
+		return 0, io.EOF
+	}
+	c := b.buf[b.off]
+	b.off++
+	return c, nil
+}
+
+// Next 读取接下来的 n 个字节, 与 Buffer 共享内存
+func (b *Buffer) Next(n int) []byte {
+	n = min(n, b.Len())
+	p := b.buf[b.off : b.off+n]
+	b.off += n
+	return p
+}
+
+// ReadFrom 实现 io.ReaderFrom, 读取直到 io.EOF
+func (b *Buffer) ReadFrom(r io.Reader) (n int64, err error) {
+	for {
+		b.grow(MinRead)
+		m, e := r.Read(b.buf[len(b.buf):cap(b.buf)])
+		if m < 0 {
+			panic(errNegativeRead)
+		}
+		b.buf = b.buf[:len(b.buf)+m]
+		n += int64(m)
+		if e == io.EOF {
+			return n, nil
+		}
+		if e != nil {
+			return n, e
+		}
+	}
+}
+
+// WriteTo 实现 io.WriterTo, 写出所有未读取的内容
+func (b *Buffer) WriteTo(w io.Writer) (n int64, err error) {
+	l := b.Len()
+	if l == 0 {
+		return 0, nil
+	}
+	m, err := w.Write(b.buf[b.off:])
+	if m > l {
+		panic("Buffer.WriteTo: invalid Write count")
+	}
+	b.off += m
+	if err != nil {
+		return int64(m), err
+	}
+	if m != l {
+		return int64(m), io.ErrShortWrite
+	}
+	b.Reset()
+	return int64(m), nil
+}
@@ -0,0 +1,66 @@
+package memorypool
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuffer(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	b := ac.NewBuffer()
+	b.WriteString("hello")
+	b.WriteByte(' ')
+	b.WriteRune('世')
+	b.Write([]byte("界"))
+	runtime.GC()
+	assert.EqualValues(t, "hello 世界", b.String())
+
+	p := make([]byte, 6)
+	n, err := b.Read(p)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "hello ", string(p[:n]))
+	c, _ := b.ReadByte()
+	assert.EqualValues(t, "世"[0], c)
+	assert.EqualValues(t, "世"[1:]+"界", string(b.Next(100)))
+	_, err = b.Read(p)
+	assert.Equal(t, io.EOF, err)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestBufferReadFromWriteTo(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	b := ac.NewBuffer()
+	src := strings.Repeat("0123456789", 2000) // 超过 block 大小
+	n, err := io.Copy(b, strings.NewReader(src))
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(src), n)
+	runtime.GC()
+
+	var dst bytes.Buffer
+	n, err = io.Copy(&dst, b)
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(src), n)
+	assert.EqualValues(t, src, dst.String())
+	assert.EqualValues(t, 0, b.Len())
+
+	runtime.KeepAlive(ac)
+}
+
+func TestBufferEncoder(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	b := ac.NewBuffer()
+	assert.Nil(t, json.NewEncoder(b).Encode(map[string]int{"a": 1}))
+	tpl := template.Must(template.New("").Parse("{{.}}!"))
+	assert.Nil(t, tpl.Execute(b, "hi"))
+	assert.EqualValues(t, "{\"a\":1}\nhi!", b.String())
+
+	runtime.KeepAlive(ac)
+}
@@ -0,0 +1,144 @@
+package memorypool
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Builder 直接在内存池中构建字符串, 用法同 strings.Builder.
+// 缓冲区位于当前 block 尾部时原地扩容, 否则从内存池重新分配并拷贝.
+type Builder struct {
+	ac  *Allocator
+	buf []byte
+}
+
+// Builder 新建字符串构建器
+func (ac *Allocator) Builder() *Builder {
+	b := New[Builder](ac)
+	b.ac = ac
+	return b
+}
+
+// Len 已写入的字节数
+func (b *Builder) Len() int {
+	return len(b.buf)
+}
+
+// Cap 当前容量
+func (b *Builder) Cap() int {
+	return cap(b.buf)
+}
+
+// Reset 清空内容, 之前的内存留在内存池中
+func (b *Builder) Reset() {
+	b.buf = nil
+}
+
+// Grow 保证至少还能写入 n 个字节而不需要扩容
+func (b *Builder) Grow(n int) {
+	if n < 0 {
+		panic("Builder.Grow: negative count")
+	}
+	b.grow(n)
+}
+
+func (b *Builder) grow(n int) {
+	b.buf = b.ac.growBytes(b.buf, n)
+}
+
+// Write 实现 io.Writer
+func (b *Builder) Write(p []byte) (int, error) {
+	b.grow(len(p))
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+// WriteString 实现 io.StringWriter
+func (b *Builder) WriteString(s string) (int, error) {
+	b.grow(len(s))
+	b.buf = append(b.buf, s...)
+	return len(s), nil
+}
+
+// WriteByte 实现 io.ByteWriter
+func (b *Builder) WriteByte(c byte) error {
+	b.grow(1)
+	b.buf = append(b.buf, c)
+	return nil
+}
+
+// WriteRune 写入 rune 的 UTF-8 编码
+func (b *Builder) WriteRune(r rune) (int, error) {
+	b.grow(utf8.UTFMax)
+	n := len(b.buf)
+	b.buf = utf8.AppendRune(b.buf, r)
+	return len(b.buf) - n, nil
+}
+
+// AppendInt 同 strconv.AppendInt
+func (b *Builder) AppendInt(i int64, base int) {
+	b.grow(65) // base 2 时最长 64 位 + 符号
+	b.buf = strconv.AppendInt(b.buf, i, base)
+}
+
+// AppendUint 同 strconv.AppendUint
+func (b *Builder) AppendUint(i uint64, base int) {
+	b.grow(64)
+	b.buf = strconv.AppendUint(b.buf, i, base)
+}
+
+// AppendBool 同 strconv.AppendBool
+func (b *Builder) AppendBool(v bool) {
+	b.grow(5)
+	b.buf = strconv.AppendBool(b.buf, v)
+}
+
+// AppendFloat 同 strconv.AppendFloat
+func (b *Builder) AppendFloat(f float64, fmt byte, prec, bitSize int) {
+	b.grow(floatLen(f, fmt, prec))
+	b.buf = strconv.AppendFloat(b.buf, f, fmt, prec, bitSize)
+}
+
+// floatLen strconv.AppendFloat 输出长度的上界.
+// 符号, 17 位有效数字, 小数点和指数不超过 32 字节; 'f' 格式另外加上十进制指数位数的整数部分或前导零
+func floatLen(f float64, fmt byte, prec int) int {
+	n := 32
+	if prec > 0 {
+		n += prec
+	}
+	if fmt == 'f' {
+		_, exp := math.Frexp(f)
+		if exp < 0 {
+			exp = -exp
+		}
+		n += exp*3/10 + 1 // log10(2) < 0.3
+	}
+	return n
+}
+
+// AppendQuote 同 strconv.AppendQuote
+func (b *Builder) AppendQuote(s string) {
+	b.grow(2 + 4*len(s)) // 每个字节最多转义为 \xNN
+	b.buf = strconv.AppendQuote(b.buf, s)
+}
+
+// Bytes 已写入的内容, 与 Builder 共享内存
+func (b *Builder) Bytes() []byte {
+	return b.buf
+}
+
+// String 返回构建好的字符串, 与 Builder 共享内存.
+// 缓冲区位于当前 block 尾部时, 未使用的容量会归还给内存池.
+func (b *Builder) String() string {
+	b.buf = b.ac.trimBytes(b.buf)
+	return BytesToString(b.buf)
+}
+
+// Sprintf 同 fmt.Sprintf, 结果分配在内存池中
+func (ac *Allocator) Sprintf(format string, a ...any) string {
+	b := ac.Builder()
+	fmt.Fprintf(b, format, a...)
+	return b.String()
+}
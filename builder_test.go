@@ -0,0 +1,85 @@
+package memorypool
+
+import (
+	"math"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuilder(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	b := ac.Builder()
+	var s string
+	noMalloc(func() {
+		b.WriteString("id=")
+		b.AppendInt(-42, 10)
+		b.WriteByte(' ')
+		b.AppendFloat(math.Pi, 'f', 3, 64)
+		b.WriteRune('中')
+		b.AppendQuote("a\"b\n")
+		b.AppendBool(true)
+		s = b.String()
+	})
+	runtime.GC()
+	assert.EqualValues(t, "id=-42 3.142中\"a\\\"b\\n\"true", s)
+
+	// 缓冲区在 block 尾部时原地扩容
+	b = ac.Builder()
+	b.WriteString("x")
+	p := unsafe.Pointer(unsafe.SliceData(b.Bytes()))
+	for i := 0; i < 100; i++ {
+		b.WriteString("0123456789")
+	}
+	assert.True(t, p == unsafe.Pointer(unsafe.SliceData(b.Bytes())))
+	assert.EqualValues(t, "x"+strings.Repeat("0123456789", 100), b.String())
+	assert.EqualValues(t, b.Len(), b.Cap())
+
+	// 中间插入其他分配后需要拷贝
+	b = ac.Builder()
+	b.WriteString("hello")
+	a := ac.NewString("other")
+	b.WriteString(strings.Repeat(" world", 10))
+	assert.EqualValues(t, "hello"+strings.Repeat(" world", 10), b.String())
+	assert.EqualValues(t, "other", a)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestBuilderAppendFloat(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	for _, c := range []struct {
+		f    float64
+		fmt  byte
+		prec int
+	}{
+		{math.MaxFloat64, 'f', -1}, {-math.MaxFloat64, 'f', 20}, {math.SmallestNonzeroFloat64, 'f', -1},
+		{-2.2250738585072014e-308, 'f', -1}, {1e-300, 'f', 400}, {math.Pi, 'e', 100}, {1e21, 'g', -1},
+		{1e20, 'g', 50}, {-0.1, 'x', 60}, {math.Inf(-1), 'f', 3}, {math.NaN(), 'g', -1}, {1.5, 'b', -1},
+	} {
+		want := strconv.AppendFloat(nil, c.f, c.fmt, c.prec, 64)
+		assert.LessOrEqual(t, len(want), floatLen(c.f, c.fmt, c.prec), string(want))
+
+		// 直接写入内存池中的缓冲区, 很长的 'f' 格式也不会分配堆内存
+		b := ac.Builder()
+		var s string
+		noMalloc(func() {
+			b.AppendFloat(c.f, c.fmt, c.prec, 64)
+			s = b.String()
+		})
+		assert.EqualValues(t, string(want), s)
+	}
+	runtime.KeepAlive(ac)
+}
+
+func TestSprintf(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	s := ac.Sprintf("%s-%d-%.2f", "a", 1, 0.5)
+	runtime.GC()
+	assert.EqualValues(t, "a-1-0.50", s)
+	runtime.KeepAlive(ac)
+}
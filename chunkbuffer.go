@@ -0,0 +1,148 @@
+package memorypool
+
+import (
+	"io"
+	"net"
+)
+
+const (
+	chunkMinFree   = 256 // 当前 block 剩余空间小于该值时直接使用新的 block
+	chunkWriteIovs = 64  // WriteTo 每次 writev 的分段数
+)
+
+type bufChunk struct {
+	buf  []byte
+	next *bufChunk
+}
+
+// ChunkedBuffer 分段缓冲区, 每个分段直接占用内存池中一个普通 block(或其剩余部分),
+// 写入再大也不会通过 newBlockWithSz 分配巨型 block. 可以通过 WriteTo 以 net.Buffers
+// 的方式写出, 目标为 net.Conn 时在 Linux 上使用 writev.
+type ChunkedBuffer struct {
+	ac         *Allocator
+	head, last *bufChunk
+	n          int // 分段数
+	len        int
+}
+
+// NewChunkedBuffer 新建分段缓冲区
+func (ac *Allocator) NewChunkedBuffer() *ChunkedBuffer {
+	b := New[ChunkedBuffer](ac)
+	b.ac = ac
+	return b
+}
+
+// Len 已写入的字节数
+func (b *ChunkedBuffer) Len() int {
+	return b.len
+}
+
+// Reset 清空内容, 之前的分段留在内存池中
+func (b *ChunkedBuffer) Reset() {
+	b.head, b.last = nil, nil
+	b.n, b.len = 0, 0
+}
+
+// tail 返回最后一个还有空闲空间的分段
+func (b *ChunkedBuffer) tail() *[]byte {
+	if b.last != nil && len(b.last.buf) < cap(b.last.buf) {
+		return &b.last.buf
+	}
+	c := New[bufChunk](b.ac)
+	c.buf = b.ac.allocChunk(min(chunkMinFree, b.ac.blockSize))
+	if b.last == nil {
+		b.head = c
+	} else {
+		b.last.next = c
+	}
+	b.last = c
+	b.n++
+	return &c.buf
+}
+
+// Write 实现 io.Writer
+func (b *ChunkedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		c := b.tail()
+		m := copy((*c)[len(*c):cap(*c)], p)
+		*c = (*c)[:len(*c)+m]
+		p = p[m:]
+	}
+	b.len += n
+	return n, nil
+}
+
+// WriteString 实现 io.StringWriter
+func (b *ChunkedBuffer) WriteString(s string) (int, error) {
+	n := len(s)
+	for len(s) > 0 {
+		c := b.tail()
+		m := copy((*c)[len(*c):cap(*c)], s)
+		*c = (*c)[:len(*c)+m]
+		s = s[m:]
+	}
+	b.len += n
+	return n, nil
+}
+
+// WriteByte 实现 io.ByteWriter
+func (b *ChunkedBuffer) WriteByte(c byte) error {
+	t := b.tail()
+	*t = append(*t, c)
+	b.len++
+	return nil
+}
+
+// ReadFrom 实现 io.ReaderFrom, 直接读进分段的空闲空间, 读取直到 io.EOF
+func (b *ChunkedBuffer) ReadFrom(r io.Reader) (n int64, err error) {
+	for {
+		c := b.tail()
+		m, e := r.Read((*c)[len(*c):cap(*c)])
+		if m < 0 {
+			panic("ChunkedBuffer.ReadFrom: reader returned negative count from Read")
+		}
+		*c = (*c)[:len(*c)+m]
+		b.len += m
+		n += int64(m)
+		if e == io.EOF {
+			return n, nil
+		}
+		if e != nil {
+			return n, e
+		}
+	}
+}
+
+// Buffers 以 net.Buffers 返回所有分段, 与 ChunkedBuffer 共享内存.
+// 返回的切片本身也从内存池分配, 分段很多时会占用一个巨型 block, 写出时优先使用 WriteTo.
+func (b *ChunkedBuffer) Buffers() net.Buffers {
+	bufs := NewSlice[[]byte](b.ac, 0, b.n)
+	for c := b.head; c != nil; c = c.next {
+		if len(c.buf) > 0 {
+			bufs = append(bufs, c.buf)
+		}
+	}
+	return bufs
+}
+
+// WriteTo 实现 io.WriterTo, 每次最多以 chunkWriteIovs 个分段组成 net.Buffers 写出, 全部写出后清空
+func (b *ChunkedBuffer) WriteTo(w io.Writer) (n int64, err error) {
+	batch := NewSlice[[]byte](b.ac, 0, min(b.n, chunkWriteIovs))
+	for c := b.head; c != nil; {
+		bufs := batch[:0]
+		for ; c != nil && len(bufs) < cap(bufs); c = c.next {
+			if len(c.buf) > 0 {
+				bufs = append(bufs, c.buf)
+			}
+		}
+		nbufs := net.Buffers(bufs)
+		m, e := nbufs.WriteTo(w)
+		n += m
+		if e != nil {
+			return n, e
+		}
+	}
+	b.Reset()
+	return n, nil
+}
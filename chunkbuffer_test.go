@@ -0,0 +1,79 @@
+package memorypool
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunkedBuffer(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	b := ac.NewChunkedBuffer()
+	b.WriteString("head:")
+	src := strings.Repeat("0123456789abcdef", 64*1024) // 1MB
+	n, err := b.ReadFrom(strings.NewReader(src))
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(src), n)
+	b.Write([]byte(":tail"))
+	b.WriteByte('!')
+	runtime.GC()
+
+	var dst bytes.Buffer
+	n, err = b.WriteTo(&dst)
+	assert.Nil(t, err)
+	assert.EqualValues(t, 5+len(src)+6, n)
+	assert.EqualValues(t, "head:"+src+":tail!", dst.String())
+	assert.EqualValues(t, 0, b.Len())
+
+	// 只使用普通 block, 不使用巨型 block 和 packed block
+	assert.EqualValues(t, 0, len(ac.hugeBlocks))
+	assert.EqualValues(t, 0, ac.Stats().PackedBytes)
+
+	b.WriteString(src[:10_000])
+	bufs := b.Buffers()
+	assert.EqualValues(t, 10_000, len(bytes.Join(bufs, nil)))
+	for _, c := range bufs {
+		assert.LessOrEqual(t, cap(c), int(ac.BlockSize()))
+	}
+
+	runtime.KeepAlive(ac)
+}
+
+func TestChunkedBufferConn(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+
+	src := strings.Repeat("x", 100_000)
+	done := make(chan string)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			done <- ""
+			return
+		}
+		defer c.Close()
+		b, _ := io.ReadAll(c)
+		done <- string(b)
+	}()
+
+	ac := NewAlloctorFromPool(0)
+	b := ac.NewChunkedBuffer()
+	b.WriteString(src)
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	assert.Nil(t, err)
+	n, err := b.WriteTo(conn) // writev
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(src), n)
+	conn.Close()
+	assert.EqualValues(t, src, <-done)
+
+	runtime.KeepAlive(ac)
+}
@@ -0,0 +1,436 @@
+package memorypool
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// 编解码结果直接写入内存池, 长度可以预先确定的一次性按最终长度分配,
+// 只能确定上限的先按上限分配, 再把多余的部分归还给内存池.
+
+//============================================================================
+// hex
+//============================================================================
+
+// EncodeHex 同 hex.EncodeToString
+func (ac *Allocator) EncodeHex(src []byte) string {
+	if len(src) == 0 {
+		return ""
+	}
+	b := ac.newBytes(hex.EncodedLen(len(src)))
+	hex.Encode(b, src)
+	return BytesToString(b)
+}
+
+// DecodeHex 同 hex.DecodeString
+func (ac *Allocator) DecodeHex(s string) ([]byte, error) {
+	src := StringToBytes(s)
+	b := ac.newBytes(hex.DecodedLen(len(src)))
+	n, err := hex.Decode(b, src)
+	return b[:n], err
+}
+
+//============================================================================
+// base64
+//============================================================================
+
+// EncodeBase64 同 enc.EncodeToString, enc 通常为 base64.StdEncoding/base64.URLEncoding 等
+func (ac *Allocator) EncodeBase64(enc *base64.Encoding, src []byte) string {
+	if len(src) == 0 {
+		return ""
+	}
+	b := ac.newBytes(enc.EncodedLen(len(src)))
+	enc.Encode(b, src)
+	return BytesToString(b)
+}
+
+// DecodeBase64 同 enc.DecodeString
+func (ac *Allocator) DecodeBase64(enc *base64.Encoding, s string) ([]byte, error) {
+	b := ac.newBytes(enc.DecodedLen(len(s)))
+	n, err := enc.Decode(b, StringToBytes(s))
+	return ac.trimBytes(b[:n]), err
+}
+
+//============================================================================
+// URL
+//============================================================================
+
+type urlEncoding int
+
+const (
+	encodePathSegment urlEncoding = iota
+	encodeQueryComponent
+)
+
+// shouldEscape 同 net/url 中对应的规则
+func shouldEscape(c byte, mode urlEncoding) bool {
+	if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+		return false
+	}
+	switch c {
+	case '-', '_', '.', '~':
+		return false
+	case '$', '&', '+', ',', '/', ':', ';', '=', '?', '@':
+		switch mode {
+		case encodePathSegment:
+			return c == '/' || c == ';' || c == ',' || c == '?'
+		case encodeQueryComponent:
+			return true
+		}
+	}
+	return true
+}
+
+// QueryEscape 同 url.QueryEscape
+func (ac *Allocator) QueryEscape(s string) string {
+	return ac.urlEscape(s, encodeQueryComponent)
+}
+
+// PathEscape 同 url.PathEscape
+func (ac *Allocator) PathEscape(s string) string {
+	return ac.urlEscape(s, encodePathSegment)
+}
+
+// QueryUnescape 同 url.QueryUnescape
+func (ac *Allocator) QueryUnescape(s string) (string, error) {
+	return ac.urlUnescape(s, encodeQueryComponent)
+}
+
+// PathUnescape 同 url.PathUnescape
+func (ac *Allocator) PathUnescape(s string) (string, error) {
+	return ac.urlUnescape(s, encodePathSegment)
+}
+
+func (ac *Allocator) urlEscape(s string, mode urlEncoding) string {
+	spaceCount, hexCount := 0, 0
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; shouldEscape(c, mode) {
+			if c == ' ' && mode == encodeQueryComponent {
+				spaceCount++
+			} else {
+				hexCount++
+			}
+		}
+	}
+	if spaceCount == 0 && hexCount == 0 {
+		return ac.NewString(s)
+	}
+
+	const upperhex = "0123456789ABCDEF"
+	b := ac.newBytes(len(s) + 2*hexCount)[:0]
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == ' ' && mode == encodeQueryComponent:
+			b = append(b, '+')
+		case shouldEscape(c, mode):
+			b = append(b, '%', upperhex[c>>4], upperhex[c&15])
+		default:
+			b = append(b, c)
+		}
+	}
+	return BytesToString(b)
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10
+	}
+	return 0
+}
+
+func ishex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func (ac *Allocator) urlUnescape(s string, mode urlEncoding) (string, error) {
+	n := 0
+	hasPlus := false
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case '%':
+			n++
+			if i+2 >= len(s) || !ishex(s[i+1]) || !ishex(s[i+2]) {
+				s = s[i:]
+				if len(s) > 3 {
+					s = s[:3]
+				}
+				return "", url.EscapeError(s)
+			}
+			i += 3
+		case '+':
+			hasPlus = mode == encodeQueryComponent
+			i++
+		default:
+			i++
+		}
+	}
+	if n == 0 && !hasPlus {
+		return ac.NewString(s), nil
+	}
+
+	b := ac.newBytes(len(s) - 2*n)[:0]
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '%':
+			b = append(b, unhex(s[i+1])<<4|unhex(s[i+2]))
+			i += 2
+		case '+':
+			if mode == encodeQueryComponent {
+				b = append(b, ' ')
+			} else {
+				b = append(b, '+')
+			}
+		default:
+			b = append(b, s[i])
+		}
+	}
+	return BytesToString(b), nil
+}
+
+//============================================================================
+// Go/JSON quoting
+//============================================================================
+
+// Quote 同 strconv.Quote
+func (ac *Allocator) Quote(s string) string {
+	b := ac.Builder()
+	b.AppendQuote(s)
+	return b.String()
+}
+
+// Unquote 同 strconv.Unquote
+func (ac *Allocator) Unquote(s string) (string, error) {
+	n := len(s)
+	if n < 2 {
+		return "", strconv.ErrSyntax
+	}
+	quote := s[0]
+	if quote != s[n-1] {
+		return "", strconv.ErrSyntax
+	}
+	if quote == '`' || quote == '\'' {
+		// raw string 和 rune 字面量没有需要展开的转义, 直接交给 strconv 校验
+		r, err := strconv.Unquote(s)
+		if err != nil {
+			return "", err
+		}
+		return ac.NewString(r), nil
+	}
+	if quote != '"' {
+		return "", strconv.ErrSyntax
+	}
+
+	s = s[1 : n-1]
+	if strings.IndexByte(s, '\n') >= 0 {
+		return "", strconv.ErrSyntax
+	}
+	b := ac.Builder()
+	b.Grow(len(s))
+	for len(s) > 0 {
+		c, multibyte, tail, err := strconv.UnquoteChar(s, '"')
+		if err != nil {
+			return "", err
+		}
+		s = tail
+		if c < utf8.RuneSelf || !multibyte {
+			b.WriteByte(byte(c))
+		} else {
+			b.WriteRune(c)
+		}
+	}
+	return b.String(), nil
+}
+
+// QuoteJSON 按 encoding/json 的规则把 s 编码为 JSON 字符串(包含 HTML 转义)
+func (ac *Allocator) QuoteJSON(s string) string {
+	b := ac.Builder()
+	b.Grow(2 + 6*len(s)) // 每个字节最多转义为 \u00XX
+	b.buf = AppendQuoteJSON(b.buf, s, true)
+	return b.String()
+}
+
+var errUnquoteJSON = errors.New("memorypool: invalid JSON string")
+
+// UnquoteJSON 解码带双引号的 JSON 字符串
+func (ac *Allocator) UnquoteJSON(s string) (string, error) {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return "", errUnquoteJSON
+	}
+	s = s[1 : len(s)-1]
+
+	// 没有转义时直接拷贝
+	r := 0
+	for r < len(s) {
+		c := s[r]
+		if c == '\\' || c == '"' || c < ' ' {
+			break
+		}
+		if c < utf8.RuneSelf {
+			r++
+			continue
+		}
+		rr, size := utf8.DecodeRuneInString(s[r:])
+		if rr == utf8.RuneError && size == 1 {
+			break
+		}
+		r += size
+	}
+	if r == len(s) {
+		return ac.NewString(s), nil
+	}
+
+	b := ac.Builder()
+	b.Grow(len(s) + 2*utf8.UTFMax)
+	b.WriteString(s[:r])
+	for r < len(s) {
+		switch c := s[r]; {
+		case c == '\\':
+			r++
+			if r >= len(s) {
+				return "", errUnquoteJSON
+			}
+			switch s[r] {
+			case '"', '\\', '/', '\'':
+				b.WriteByte(s[r])
+				r++
+			case 'b':
+				b.WriteByte('\b')
+				r++
+			case 'f':
+				b.WriteByte('\f')
+				r++
+			case 'n':
+				b.WriteByte('\n')
+				r++
+			case 'r':
+				b.WriteByte('\r')
+				r++
+			case 't':
+				b.WriteByte('\t')
+				r++
+			case 'u':
+				r--
+				rr := getu4(s[r:])
+				if rr < 0 {
+					return "", errUnquoteJSON
+				}
+				r += 6
+				if utf16.IsSurrogate(rr) {
+					rr1 := getu4(s[r:])
+					if dec := utf16.DecodeRune(rr, rr1); dec != utf8.RuneError {
+						r += 6
+						b.WriteRune(dec)
+						break
+					}
+					rr = utf8.RuneError
+				}
+				b.WriteRune(rr)
+			default:
+				return "", errUnquoteJSON
+			}
+
+		case c == '"', c < ' ':
+			return "", errUnquoteJSON
+
+		case c < utf8.RuneSelf:
+			b.WriteByte(c)
+			r++
+
+		default:
+			rr, size := utf8.DecodeRuneInString(s[r:])
+			r += size
+			b.WriteRune(rr)
+		}
+	}
+	return b.String(), nil
+}
+
+// getu4 解析 s 开头的 \uXXXX, 失败返回 -1
+func getu4(s string) rune {
+	if len(s) < 6 || s[0] != '\\' || s[1] != 'u' {
+		return -1
+	}
+	var r rune
+	for _, c := range []byte(s[2:6]) {
+		if !ishex(c) {
+			return -1
+		}
+		r = r*16 + rune(unhex(c))
+	}
+	return r
+}
+
+// AppendQuoteJSON 按 encoding/json 的规则把 s 编码为 JSON 字符串追加到 dst.
+// escapeHTML 为 true 时同时转义 <, >, &.
+func AppendQuoteJSON(dst []byte, s string, escapeHTML bool) []byte {
+	const hexDigits = "0123456789abcdef"
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if jsonSafe(c, escapeHTML) {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch c {
+			case '\\', '"':
+				dst = append(dst, '\\', c)
+			case '\b':
+				dst = append(dst, '\\', 'b')
+			case '\f':
+				dst = append(dst, '\\', 'f')
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				// 控制字符以及需要 HTML 转义的字符
+				dst = append(dst, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+
+		c, size := utf8.DecodeRuneInString(s[i:])
+		if c == utf8.RuneError && size == 1 {
+			dst = append(dst, s[start:i]...)
+			dst = utf8.AppendRune(dst, utf8.RuneError)
+			i += size
+			start = i
+			continue
+		}
+		// U+2028/U+2029 在 JSON 中合法, 但在 JavaScript 中是换行符
+		if c == '\u2028' || c == '\u2029' {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hexDigits[c&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
+
+func jsonSafe(c byte, escapeHTML bool) bool {
+	if c < ' ' || c == '"' || c == '\\' {
+		return false
+	}
+	return !escapeHTML || (c != '<' && c != '>' && c != '&')
+}
@@ -0,0 +1,98 @@
+package memorypool
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeHexBase64(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	src := []byte("\x00\x01hello\xff")
+
+	h := ac.EncodeHex(src)
+	std := ac.EncodeBase64(base64.StdEncoding, src)
+	raw := ac.EncodeBase64(base64.RawURLEncoding, src)
+	runtime.GC()
+	assert.EqualValues(t, "000168656c6c6fff", h)
+	assert.EqualValues(t, base64.StdEncoding.EncodeToString(src), std)
+	assert.EqualValues(t, base64.RawURLEncoding.EncodeToString(src), raw)
+
+	b, err := ac.DecodeHex(h)
+	assert.Nil(t, err)
+	assert.EqualValues(t, src, b)
+	b, err = ac.DecodeBase64(base64.StdEncoding, std)
+	assert.Nil(t, err)
+	assert.EqualValues(t, src, b)
+	assert.EqualValues(t, len(src), cap(b))
+	b, err = ac.DecodeBase64(base64.RawURLEncoding, raw)
+	assert.Nil(t, err)
+	assert.EqualValues(t, src, b)
+
+	_, err = ac.DecodeHex("0g")
+	assert.NotNil(t, err)
+	_, err = ac.DecodeBase64(base64.StdEncoding, "!!")
+	assert.NotNil(t, err)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestURLEscape(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	for _, s := range []string{"", "abc", "a b&c=d/e?f", "中文 +%", "a;b,c/d"} {
+		assert.EqualValues(t, url.QueryEscape(s), ac.QueryEscape(s))
+		assert.EqualValues(t, url.PathEscape(s), ac.PathEscape(s))
+
+		u, err := ac.QueryUnescape(url.QueryEscape(s))
+		assert.Nil(t, err)
+		assert.EqualValues(t, s, u)
+		u, err = ac.PathUnescape(url.PathEscape(s))
+		assert.Nil(t, err)
+		assert.EqualValues(t, s, u)
+	}
+	u, _ := ac.QueryUnescape("a+b")
+	assert.EqualValues(t, "a b", u)
+	u, _ = ac.PathUnescape("a+b")
+	assert.EqualValues(t, "a+b", u)
+	_, err := ac.QueryUnescape("%zz")
+	assert.EqualValues(t, url.EscapeError("%zz"), err)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestQuote(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	for _, s := range []string{"", "abc", "a\"b\\c\n", "中文\x00\xff", " <tag>&"} {
+		assert.EqualValues(t, strconv.Quote(s), ac.Quote(s))
+		u, err := ac.Unquote(strconv.Quote(s))
+		assert.Nil(t, err)
+		assert.EqualValues(t, s, u)
+
+		want, _ := json.Marshal(s)
+		q := ac.QuoteJSON(s)
+		assert.EqualValues(t, string(want), q)
+
+		var ref string
+		assert.Nil(t, json.Unmarshal(want, &ref))
+		u, err = ac.UnquoteJSON(q)
+		assert.Nil(t, err)
+		assert.EqualValues(t, ref, u)
+	}
+
+	u, err := ac.UnquoteJSON(`"😀 é \/ \ud800"`)
+	assert.Nil(t, err)
+	assert.EqualValues(t, "😀 é / �", u)
+	_, err = ac.UnquoteJSON(`"\x"`)
+	assert.NotNil(t, err)
+	_, err = ac.Unquote(`"a`)
+	assert.NotNil(t, err)
+	r, _ := ac.Unquote("`raw\\n`")
+	assert.EqualValues(t, `raw\n`, r)
+
+	runtime.KeepAlive(ac)
+}
@@ -0,0 +1,145 @@
+package memorypool
+
+import (
+	"container/heap"
+	"reflect"
+)
+
+// Heap 二叉堆(优先队列), 底层数组从 Allocator 分配, less(a, b) 为 true 时 a 先出堆.
+// 插入含指针的值时会在堆上保留副本保活其引用的对象
+type Heap[T any] struct {
+	ac     *Allocator
+	data   []T
+	less   func(a, b T) bool
+	ptrVal bool // T 含指针, 插入时需要保活
+}
+
+// NewHeap 新建堆, capacity 为预分配容量
+func NewHeap[T any](ac *Allocator, less func(a, b T) bool, capacity int) *Heap[T] {
+	h := New[Heap[T]](ac)
+	h.ac = ac
+	h.less = less
+	h.data = NewSlice[T](ac, 0, capacity)
+	h.ptrVal = !pointerFree(reflect.TypeOf((*T)(nil)).Elem())
+	ac.KeepAlive(less) // h 在内存池中, GC 不会扫描到 less
+	return h
+}
+
+// Len 元素个数
+func (h *Heap[T]) Len() int {
+	return len(h.data)
+}
+
+// At 第 i 个元素, 下标与 Fix/Remove 一致
+func (h *Heap[T]) At(i int) T {
+	return h.data[i]
+}
+
+// Push 入堆
+func (h *Heap[T]) Push(v T) {
+	h.append(v)
+	h.up(len(h.data) - 1)
+}
+
+func (h *Heap[T]) append(v T) {
+	h.data = Append[T](h.ac, h.data, v)
+	if h.ptrVal {
+		keepAliveValue(h.ac, v)
+	}
+}
+
+// Pop 删除并返回堆顶元素
+func (h *Heap[T]) Pop() (v T, ok bool) {
+	n := len(h.data) - 1
+	if n < 0 {
+		return v, false
+	}
+	h.swap(0, n)
+	h.down(0, n)
+	return h.removeLast(), true
+}
+
+// Peek 堆顶元素
+func (h *Heap[T]) Peek() (v T, ok bool) {
+	if len(h.data) == 0 {
+		return v, false
+	}
+	return h.data[0], true
+}
+
+// Fix 第 i 个元素的值改变后重新调整位置
+func (h *Heap[T]) Fix(i int) {
+	if !h.down(i, len(h.data)) {
+		h.up(i)
+	}
+}
+
+// Remove 删除并返回第 i 个元素
+func (h *Heap[T]) Remove(i int) T {
+	n := len(h.data) - 1
+	if n != i {
+		h.swap(i, n)
+		if !h.down(i, n) {
+			h.up(i)
+		}
+	}
+	return h.removeLast()
+}
+
+func (h *Heap[T]) removeLast() T {
+	var zero T
+	n := len(h.data) - 1
+	v := h.data[n]
+	h.data[n] = zero
+	h.data = h.data[:n]
+	return v
+}
+
+func (h *Heap[T]) swap(i, j int) {
+	h.data[i], h.data[j] = h.data[j], h.data[i]
+}
+
+func (h *Heap[T]) up(j int) {
+	for {
+		i := (j - 1) / 2 // parent
+		if i == j || !h.less(h.data[j], h.data[i]) {
+			break
+		}
+		h.swap(i, j)
+		j = i
+	}
+}
+
+func (h *Heap[T]) down(i0, n int) bool {
+	i := i0
+	for {
+		j1 := 2*i + 1
+		if j1 >= n || j1 < 0 { // j1 < 0 after int overflow
+			break
+		}
+		j := j1 // left child
+		if j2 := j1 + 1; j2 < n && h.less(h.data[j2], h.data[j1]) {
+			j = j2 // = 2*i + 2  // right child
+		}
+		if !h.less(h.data[j], h.data[i]) {
+			break
+		}
+		h.swap(i, j)
+		i = j
+	}
+	return i > i0
+}
+
+// Interface 返回共享同一份数据的 container/heap.Interface 适配器,
+// 方便已有的 heap.Push/heap.Pop 代码直接切换过来
+func (h *Heap[T]) Interface() heap.Interface {
+	return (*heapInterface[T])(h)
+}
+
+type heapInterface[T any] Heap[T]
+
+func (h *heapInterface[T]) Len() int           { return len(h.data) }
+func (h *heapInterface[T]) Less(i, j int) bool { return h.less(h.data[i], h.data[j]) }
+func (h *heapInterface[T]) Swap(i, j int)      { h.data[i], h.data[j] = h.data[j], h.data[i] }
+func (h *heapInterface[T]) Push(x any)         { (*Heap[T])(h).append(x.(T)) }
+func (h *heapInterface[T]) Pop() any           { return (*Heap[T])(h).removeLast() }
@@ -0,0 +1,115 @@
+package memorypool
+
+import (
+	"container/heap"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeap(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	h := NewHeap[int](ac, func(a, b int) bool { return a < b }, 1)
+	var ref []int
+	for i := 0; i < 10_000; i++ {
+		v := rand.Intn(1000)
+		h.Push(v)
+		ref = append(ref, v)
+	}
+	runtime.GC()
+	sort.Ints(ref)
+
+	top, _ := h.Peek()
+	assert.EqualValues(t, ref[0], top)
+	for _, want := range ref {
+		v, ok := h.Pop()
+		assert.True(t, ok)
+		assert.EqualValues(t, want, v)
+	}
+	_, ok := h.Pop()
+	assert.False(t, ok)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestHeapFixRemove(t *testing.T) {
+	type item struct {
+		prio int
+		name string
+	}
+	ac := NewAlloctorFromPool(0)
+	h := NewHeap[*item](ac, func(a, b *item) bool { return a.prio > b.prio }, 4)
+	for i, name := range []string{"a", "b", "c", "d", "e"} {
+		it := New[item](ac)
+		it.prio, it.name = i, name
+		h.Push(it)
+	}
+
+	// 把堆顶优先级调到最低
+	top, _ := h.Peek()
+	top.prio = -1
+	h.Fix(0)
+	top, _ = h.Peek()
+	assert.EqualValues(t, "d", top.name)
+
+	for i := 0; i < h.Len(); i++ {
+		if h.At(i).name == "c" {
+			assert.EqualValues(t, "c", h.Remove(i).name)
+			break
+		}
+	}
+
+	var got []string
+	for h.Len() > 0 {
+		v, _ := h.Pop()
+		got = append(got, v.name)
+	}
+	assert.EqualValues(t, []string{"d", "b", "a", "e"}, got)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestHeapInterface(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	h := NewHeap[int](ac, func(a, b int) bool { return a < b }, 0)
+	hi := h.Interface()
+	for _, v := range []int{5, 2, 8, 1, 9} {
+		heap.Push(hi, v)
+	}
+	assert.EqualValues(t, 5, h.Len())
+	assert.EqualValues(t, 1, heap.Pop(hi))
+	v, _ := h.Pop()
+	assert.EqualValues(t, 2, v)
+	assert.EqualValues(t, 5, heap.Pop(hi))
+
+	runtime.KeepAlive(ac)
+}
+
+func TestHeapPointerValue(t *testing.T) {
+	type item struct {
+		prio int
+		name string
+	}
+	ac := NewAlloctorFromPool(0)
+	h := NewHeap[*item](ac, func(a, b *item) bool { return a.prio < b.prio }, 1)
+	for i := 0; i < 1000; i++ {
+		if i%2 == 0 {
+			h.Push(&item{prio: i, name: strconv.Itoa(i)})
+		} else {
+			heap.Push(h.Interface(), &item{prio: i, name: strconv.Itoa(i)})
+		}
+	}
+	runtime.GC() // 值引用的堆对象只被内存池引用
+	runtime.GC()
+
+	for i := 0; i < 1000; i++ {
+		v, _ := h.Pop()
+		assert.EqualValues(t, item{prio: i, name: strconv.Itoa(i)}, *v)
+	}
+
+	runtime.KeepAlive(ac)
+}
@@ -0,0 +1,30 @@
+package memorypool
+
+const internTableHint = 64
+
+// Intern 字符串驻留: 相同内容的字符串在 Allocator 的生命周期内只拷贝一次.
+// 与 weakUniqQueue 一样用于去重以减少内存占用, 但使用内存池中的哈希表做精确去重, Reset 时自动清空.
+func (ac *Allocator) Intern(s string) string {
+	if len(s) == 0 {
+		return ""
+	}
+	return InternValue(ac, s)
+}
+
+// InternValue 返回与 v 相等的唯一副本. string 会拷贝进内存池,
+// 其他含指针的类型(例如带 string 字段的结构体)同 Map 的 key 一样在插入时保活.
+func InternValue[T comparable](ac *Allocator, v T) T {
+	e, _ := internTable[T](ac).findOrInsert(v)
+	return e.key
+}
+
+func internTable[T comparable](ac *Allocator) *Map[T, struct{}] {
+	for _, t := range ac.internTables {
+		if m, ok := t.(*Map[T, struct{}]); ok {
+			return m
+		}
+	}
+	m := NewMap[T, struct{}](ac, internTableHint)
+	ac.internTables = append(ac.internTables, m)
+	return m
+}
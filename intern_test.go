@@ -0,0 +1,43 @@
+package memorypool
+
+import (
+	"runtime"
+	"strconv"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntern(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	var strs []string
+	for i := 0; i < 1000; i++ {
+		strs = append(strs, ac.Intern("key"+strconv.Itoa(i%10)))
+	}
+	runtime.GC()
+
+	for i, s := range strs {
+		assert.EqualValues(t, "key"+strconv.Itoa(i%10), s)
+		// 相同内容共享同一份内存
+		assert.True(t, unsafe.StringData(s) == unsafe.StringData(strs[i%10]))
+	}
+	assert.EqualValues(t, 10, internTable[string](ac).Len())
+
+	type enum struct {
+		a int32
+		b bool
+	}
+	assert.EqualValues(t, enum{1, true}, InternValue(ac, enum{1, true}))
+	InternValue(ac, 42)
+	assert.EqualValues(t, 3, len(ac.internTables))
+
+	// Reset 后清空
+	ac.Reset()
+	assert.EqualValues(t, 0, len(ac.internTables))
+	s := ac.Intern("key1")
+	assert.EqualValues(t, "key1", s)
+	assert.EqualValues(t, 1, internTable[string](ac).Len())
+
+	runtime.KeepAlive(ac)
+}
@@ -0,0 +1,6 @@
+//go:build !race
+
+package race
+
+// Enabled 是否开启了 race 检测
+const Enabled = false
@@ -0,0 +1,8 @@
+//go:build race
+
+// Package race 报告是否开启了 race 检测.
+// 开启时 sync.Pool 会随机丢弃对象, 依赖对象复用的堆分配测试需要跳过
+package race
+
+// Enabled 是否开启了 race 检测
+const Enabled = true
@@ -0,0 +1,538 @@
+package memorypool
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+//============================================================================
+// List
+//============================================================================
+
+// Element List 的节点
+type Element[T any] struct {
+	next, prev *Element[T]
+	list       *List[T]
+	Value      T
+}
+
+// Next 下一个节点, 没有则返回 nil
+func (e *Element[T]) Next() *Element[T] {
+	if p := e.next; e.list != nil && p != &e.list.root {
+		return p
+	}
+	return nil
+}
+
+// Prev 上一个节点, 没有则返回 nil
+func (e *Element[T]) Prev() *Element[T] {
+	if p := e.prev; e.list != nil && p != &e.list.root {
+		return p
+	}
+	return nil
+}
+
+// List 双向链表(非侵入式), 用法同 container/list.
+// 节点从 Allocator 分配, Remove 后的节点在链表内部回收复用.
+// 插入含指针的值时会在堆上保留副本保活其引用的对象; 直接修改 Element.Value 时需要调用方自行保活.
+type List[T any] struct {
+	ac     *Allocator
+	root   Element[T] // 哨兵节点
+	len    int
+	free   *Element[T] // 回收的节点, 通过 next 串联
+	ptrVal bool        // T 含指针, 插入时需要保活
+}
+
+// NewList 新建链表
+func NewList[T any](ac *Allocator) *List[T] {
+	l := New[List[T]](ac)
+	l.ac = ac
+	l.root.next = &l.root
+	l.root.prev = &l.root
+	l.ptrVal = !pointerFree(reflect.TypeOf((*T)(nil)).Elem())
+	return l
+}
+
+// Len 元素个数
+func (l *List[T]) Len() int {
+	return l.len
+}
+
+// Front 第一个节点
+func (l *List[T]) Front() *Element[T] {
+	if l.len == 0 {
+		return nil
+	}
+	return l.root.next
+}
+
+// Back 最后一个节点
+func (l *List[T]) Back() *Element[T] {
+	if l.len == 0 {
+		return nil
+	}
+	return l.root.prev
+}
+
+func (l *List[T]) newElement(v T) *Element[T] {
+	e := l.free
+	if e != nil {
+		l.free = e.next
+	} else {
+		e = New[Element[T]](l.ac)
+	}
+	e.Value = v
+	if l.ptrVal {
+		keepAliveValue(l.ac, v)
+	}
+	return e
+}
+
+func (l *List[T]) insert(e, at *Element[T]) *Element[T] {
+	e.prev = at
+	e.next = at.next
+	e.prev.next = e
+	e.next.prev = e
+	e.list = l
+	l.len++
+	return e
+}
+
+func (l *List[T]) unlink(e *Element[T]) {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+}
+
+func (l *List[T]) move(e, at *Element[T]) {
+	if e == at {
+		return
+	}
+	l.unlink(e)
+	e.prev = at
+	e.next = at.next
+	e.prev.next = e
+	e.next.prev = e
+}
+
+// PushFront 在头部插入
+func (l *List[T]) PushFront(v T) *Element[T] {
+	return l.insert(l.newElement(v), &l.root)
+}
+
+// PushBack 在尾部插入
+func (l *List[T]) PushBack(v T) *Element[T] {
+	return l.insert(l.newElement(v), l.root.prev)
+}
+
+// InsertBefore 在 mark 之前插入, mark 不属于该链表时返回 nil
+func (l *List[T]) InsertBefore(v T, mark *Element[T]) *Element[T] {
+	if mark.list != l {
+		return nil
+	}
+	return l.insert(l.newElement(v), mark.prev)
+}
+
+// InsertAfter 在 mark 之后插入, mark 不属于该链表时返回 nil
+func (l *List[T]) InsertAfter(v T, mark *Element[T]) *Element[T] {
+	if mark.list != l {
+		return nil
+	}
+	return l.insert(l.newElement(v), mark)
+}
+
+// Remove 删除节点并返回其值, 节点会被回收, 之后不能再使用
+func (l *List[T]) Remove(e *Element[T]) T {
+	v := e.Value
+	if e.list != l {
+		return v
+	}
+	l.unlink(e)
+	l.len--
+
+	*e = Element[T]{next: l.free}
+	l.free = e
+	return v
+}
+
+// MoveToFront 移动到头部
+func (l *List[T]) MoveToFront(e *Element[T]) {
+	if e.list != l || l.root.next == e {
+		return
+	}
+	l.move(e, &l.root)
+}
+
+// MoveToBack 移动到尾部
+func (l *List[T]) MoveToBack(e *Element[T]) {
+	if e.list != l || l.root.prev == e {
+		return
+	}
+	l.move(e, l.root.prev)
+}
+
+//============================================================================
+// IList
+//============================================================================
+
+// Hook 侵入式链表挂钩, 嵌入到元素结构体中
+type Hook[T any] struct {
+	next, prev *T
+	list       unsafe.Pointer // 元素所在的 IList, 不在链表中时为 nil
+}
+
+// IList 侵入式双向链表, 元素由调用方分配(通常使用 New), 链表本身不分配节点.
+// PT 通过 ListHook 返回元素内嵌的 Hook, 同一个元素同时只能在一个 IList 中.
+// 同 container/list, Remove 和 Next/Prev 对不在该链表中的元素什么都不做.
+type IList[T any, PT interface {
+	*T
+	ListHook() *Hook[T]
+}] struct {
+	head, tail *T
+	len        int
+}
+
+// NewIList 新建侵入式链表
+func NewIList[T any, PT interface {
+	*T
+	ListHook() *Hook[T]
+}](ac *Allocator) *IList[T, PT] {
+	return New[IList[T, PT]](ac)
+}
+
+func hookOf[T any, PT interface {
+	*T
+	ListHook() *Hook[T]
+}](x *T) *Hook[T] {
+	return PT(x).ListHook()
+}
+
+// Len 元素个数
+func (l *IList[T, PT]) Len() int {
+	return l.len
+}
+
+// Front 第一个元素
+func (l *IList[T, PT]) Front() *T {
+	return l.head
+}
+
+// Back 最后一个元素
+func (l *IList[T, PT]) Back() *T {
+	return l.tail
+}
+
+// Next 下一个元素, x 不在 l 中时返回 nil
+func (l *IList[T, PT]) Next(x *T) *T {
+	if h := hookOf[T, PT](x); h.list == unsafe.Pointer(l) {
+		return h.next
+	}
+	return nil
+}
+
+// Prev 上一个元素, x 不在 l 中时返回 nil
+func (l *IList[T, PT]) Prev(x *T) *T {
+	if h := hookOf[T, PT](x); h.list == unsafe.Pointer(l) {
+		return h.prev
+	}
+	return nil
+}
+
+// PushFront 在头部插入
+func (l *IList[T, PT]) PushFront(x *T) {
+	h := hookOf[T, PT](x)
+	h.prev, h.next, h.list = nil, l.head, unsafe.Pointer(l)
+	if l.head != nil {
+		hookOf[T, PT](l.head).prev = x
+	} else {
+		l.tail = x
+	}
+	l.head = x
+	l.len++
+}
+
+// PushBack 在尾部插入
+func (l *IList[T, PT]) PushBack(x *T) {
+	h := hookOf[T, PT](x)
+	h.prev, h.next, h.list = l.tail, nil, unsafe.Pointer(l)
+	if l.tail != nil {
+		hookOf[T, PT](l.tail).next = x
+	} else {
+		l.head = x
+	}
+	l.tail = x
+	l.len++
+}
+
+// Remove 删除元素, x 不在 l 中时什么都不做
+func (l *IList[T, PT]) Remove(x *T) {
+	h := hookOf[T, PT](x)
+	if h.list != unsafe.Pointer(l) {
+		return
+	}
+	if h.prev != nil {
+		hookOf[T, PT](h.prev).next = h.next
+	} else {
+		l.head = h.next
+	}
+	if h.next != nil {
+		hookOf[T, PT](h.next).prev = h.prev
+	} else {
+		l.tail = h.prev
+	}
+	h.prev, h.next, h.list = nil, nil, nil
+	l.len--
+}
+
+// PopFront 删除并返回第一个元素
+func (l *IList[T, PT]) PopFront() *T {
+	x := l.head
+	if x != nil {
+		l.Remove(x)
+	}
+	return x
+}
+
+// PopBack 删除并返回最后一个元素
+func (l *IList[T, PT]) PopBack() *T {
+	x := l.tail
+	if x != nil {
+		l.Remove(x)
+	}
+	return x
+}
+
+//============================================================================
+// Deque
+//============================================================================
+
+const dequeChunkLen = 32
+
+type dequeChunk[T any] struct {
+	prev, next *dequeChunk[T]
+	items      [dequeChunkLen]T
+}
+
+// Deque 双端队列, 由固定大小的 chunk 串联而成, chunk 从 Allocator 分配并在内部回收复用.
+// 插入含指针的值时会在堆上保留副本保活其引用的对象
+type Deque[T any] struct {
+	ac         *Allocator
+	head, tail *dequeChunk[T]
+	hi, ti     int // head.items[hi] 为第一个元素, tail.items[ti-1] 为最后一个元素
+	len        int
+	free       *dequeChunk[T]
+	ptrVal     bool // T 含指针, 插入时需要保活
+}
+
+// NewDeque 新建双端队列
+func NewDeque[T any](ac *Allocator) *Deque[T] {
+	d := New[Deque[T]](ac)
+	d.ac = ac
+	d.ptrVal = !pointerFree(reflect.TypeOf((*T)(nil)).Elem())
+	return d
+}
+
+func (d *Deque[T]) newChunk() *dequeChunk[T] {
+	c := d.free
+	if c != nil {
+		d.free = c.next
+		c.next = nil
+		return c
+	}
+	return New[dequeChunk[T]](d.ac)
+}
+
+func (d *Deque[T]) releaseChunk(c *dequeChunk[T]) {
+	c.prev = nil
+	c.next = d.free
+	d.free = c
+}
+
+func (d *Deque[T]) init() {
+	c := d.newChunk()
+	d.head, d.tail = c, c
+	d.hi, d.ti = dequeChunkLen/2, dequeChunkLen/2
+}
+
+// Len 元素个数
+func (d *Deque[T]) Len() int {
+	return d.len
+}
+
+// PushBack 在尾部插入
+func (d *Deque[T]) PushBack(v T) {
+	if d.tail == nil {
+		d.init()
+	} else if d.ti == dequeChunkLen {
+		c := d.newChunk()
+		c.prev = d.tail
+		d.tail.next = c
+		d.tail = c
+		d.ti = 0
+	}
+	d.tail.items[d.ti] = v
+	d.ti++
+	d.len++
+	if d.ptrVal {
+		keepAliveValue(d.ac, v)
+	}
+}
+
+// PushFront 在头部插入
+func (d *Deque[T]) PushFront(v T) {
+	if d.head == nil {
+		d.init()
+	} else if d.hi == 0 {
+		c := d.newChunk()
+		c.next = d.head
+		d.head.prev = c
+		d.head = c
+		d.hi = dequeChunkLen
+	}
+	d.hi--
+	d.head.items[d.hi] = v
+	d.len++
+	if d.ptrVal {
+		keepAliveValue(d.ac, v)
+	}
+}
+
+// PopFront 删除并返回第一个元素
+func (d *Deque[T]) PopFront() (v T, ok bool) {
+	if d.len == 0 {
+		return v, false
+	}
+	var zero T
+	v, d.head.items[d.hi] = d.head.items[d.hi], zero
+	d.hi++
+	d.len--
+	if d.len == 0 {
+		d.releaseChunk(d.head)
+		d.head, d.tail = nil, nil
+	} else if d.hi == dequeChunkLen {
+		c := d.head
+		d.head = c.next
+		d.head.prev = nil
+		d.releaseChunk(c)
+		d.hi = 0
+	}
+	return v, true
+}
+
+// PopBack 删除并返回最后一个元素
+func (d *Deque[T]) PopBack() (v T, ok bool) {
+	if d.len == 0 {
+		return v, false
+	}
+	var zero T
+	d.ti--
+	v, d.tail.items[d.ti] = d.tail.items[d.ti], zero
+	d.len--
+	if d.len == 0 {
+		d.releaseChunk(d.tail)
+		d.head, d.tail = nil, nil
+	} else if d.ti == 0 {
+		c := d.tail
+		d.tail = c.prev
+		d.tail.next = nil
+		d.releaseChunk(c)
+		d.ti = dequeChunkLen
+	}
+	return v, true
+}
+
+// Front 第一个元素
+func (d *Deque[T]) Front() (v T, ok bool) {
+	if d.len == 0 {
+		return v, false
+	}
+	return d.head.items[d.hi], true
+}
+
+// Back 最后一个元素
+func (d *Deque[T]) Back() (v T, ok bool) {
+	if d.len == 0 {
+		return v, false
+	}
+	return d.tail.items[d.ti-1], true
+}
+
+//============================================================================
+// Ring
+//============================================================================
+
+// Ring 固定容量的环形缓冲区, 插入含指针的值时会在堆上保留副本保活其引用的对象
+type Ring[T any] struct {
+	ac     *Allocator
+	buf    []T
+	head   int
+	len    int
+	ptrVal bool // T 含指针, 插入时需要保活
+}
+
+// NewRing 新建容量为 capacity 的环形缓冲区
+func NewRing[T any](ac *Allocator, capacity int) *Ring[T] {
+	if capacity <= 0 {
+		panic("NewRing: capacity must be positive")
+	}
+	r := New[Ring[T]](ac)
+	r.ac = ac
+	r.buf = NewSlice[T](ac, capacity, capacity)
+	r.ptrVal = !pointerFree(reflect.TypeOf((*T)(nil)).Elem())
+	return r
+}
+
+// Len 元素个数
+func (r *Ring[T]) Len() int {
+	return r.len
+}
+
+// Cap 容量
+func (r *Ring[T]) Cap() int {
+	return len(r.buf)
+}
+
+// Full 是否已满
+func (r *Ring[T]) Full() bool {
+	return r.len == len(r.buf)
+}
+
+// Push 在尾部插入, 已满时返回 false
+func (r *Ring[T]) Push(v T) bool {
+	if r.Full() {
+		return false
+	}
+	r.buf[(r.head+r.len)%len(r.buf)] = v
+	r.len++
+	if r.ptrVal {
+		keepAliveValue(r.ac, v)
+	}
+	return true
+}
+
+// Pop 删除并返回第一个元素
+func (r *Ring[T]) Pop() (v T, ok bool) {
+	if r.len == 0 {
+		return v, false
+	}
+	var zero T
+	v, r.buf[r.head] = r.buf[r.head], zero
+	r.head = (r.head + 1) % len(r.buf)
+	r.len--
+	return v, true
+}
+
+// Peek 第一个元素
+func (r *Ring[T]) Peek() (v T, ok bool) {
+	if r.len == 0 {
+		return v, false
+	}
+	return r.buf[r.head], true
+}
+
+// At 第 i 个元素
+func (r *Ring[T]) At(i int) T {
+	if i < 0 || i >= r.len {
+		panic("Ring: index out of range")
+	}
+	return r.buf[(r.head+i)%len(r.buf)]
+}
@@ -0,0 +1,178 @@
+package memorypool
+
+import (
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestList(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	l := NewList[int](ac)
+	e2 := l.PushBack(2)
+	l.PushFront(1)
+	e4 := l.PushBack(4)
+	l.InsertBefore(3, e4)
+	l.InsertAfter(5, e4)
+
+	var got []int
+	for e := l.Front(); e != nil; e = e.Next() {
+		got = append(got, e.Value)
+	}
+	assert.EqualValues(t, []int{1, 2, 3, 4, 5}, got)
+
+	assert.EqualValues(t, 2, l.Remove(e2))
+	l.MoveToFront(e4)
+	got = got[:0]
+	for e := l.Back(); e != nil; e = e.Prev() {
+		got = append(got, e.Value)
+	}
+	assert.EqualValues(t, []int{5, 3, 1, 4}, got)
+
+	// 删除的节点会被复用
+	e6 := l.PushBack(6)
+	assert.True(t, e2 == e6)
+	assert.EqualValues(t, 5, l.Len())
+
+	runtime.KeepAlive(ac)
+}
+
+type ilistNode struct {
+	hook Hook[ilistNode]
+	v    int
+}
+
+func (n *ilistNode) ListHook() *Hook[ilistNode] { return &n.hook }
+
+func TestIList(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	l := NewIList[ilistNode](ac)
+	nodes := make([]*ilistNode, 5)
+	for i := range nodes {
+		nodes[i] = New[ilistNode](ac)
+		nodes[i].v = i
+		l.PushBack(nodes[i])
+	}
+	l.Remove(nodes[2])
+	l.PushFront(nodes[2])
+	assert.EqualValues(t, 5, l.Len())
+
+	var got []int
+	for n := l.Front(); n != nil; n = l.Next(n) {
+		got = append(got, n.v)
+	}
+	assert.EqualValues(t, []int{2, 0, 1, 3, 4}, got)
+	assert.EqualValues(t, 4, l.PopBack().v)
+	assert.EqualValues(t, 2, l.PopFront().v)
+	assert.EqualValues(t, 3, l.Len())
+
+	// 不在链表中的元素: 已删除的, 在另一个链表中的
+	l.Remove(nodes[2])
+	other := NewIList[ilistNode](ac)
+	x := New[ilistNode](ac)
+	other.PushBack(x)
+	l.Remove(x)
+	assert.Nil(t, l.Next(x))
+	assert.Nil(t, l.Next(nodes[4]))
+	assert.EqualValues(t, 3, l.Len())
+	assert.EqualValues(t, 1, other.Len())
+	assert.Equal(t, x, other.Front())
+	got = got[:0]
+	for n := l.Front(); n != nil; n = l.Next(n) {
+		got = append(got, n.v)
+	}
+	assert.EqualValues(t, []int{0, 1, 3}, got)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestDeque(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	d := NewDeque[int](ac)
+	var ref []int
+	for i := 0; i < 10_000; i++ {
+		switch i % 7 {
+		case 0, 1, 2:
+			d.PushBack(i)
+			ref = append(ref, i)
+		case 3, 4:
+			d.PushFront(i)
+			ref = append([]int{i}, ref...)
+		case 5:
+			v, ok := d.PopFront()
+			if assert.True(t, ok) {
+				assert.EqualValues(t, ref[0], v)
+				ref = ref[1:]
+			}
+		case 6:
+			v, ok := d.PopBack()
+			if assert.True(t, ok) {
+				assert.EqualValues(t, ref[len(ref)-1], v)
+				ref = ref[:len(ref)-1]
+			}
+		}
+	}
+	assert.EqualValues(t, len(ref), d.Len())
+	for len(ref) > 0 {
+		v, _ := d.PopFront()
+		assert.EqualValues(t, ref[0], v)
+		ref = ref[1:]
+	}
+	_, ok := d.PopBack()
+	assert.False(t, ok)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestRing(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	r := NewRing[int](ac, 3)
+	assert.True(t, r.Push(1))
+	assert.True(t, r.Push(2))
+	assert.True(t, r.Push(3))
+	assert.False(t, r.Push(4))
+
+	v, _ := r.Pop()
+	assert.EqualValues(t, 1, v)
+	assert.True(t, r.Push(4))
+	assert.EqualValues(t, 2, r.At(0))
+	assert.EqualValues(t, 4, r.At(2))
+	v, _ = r.Peek()
+	assert.EqualValues(t, 2, v)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestListPointerValue(t *testing.T) {
+	type item struct {
+		s string
+		n int
+	}
+	ac := NewAlloctorFromPool(0)
+	l := NewList[*item](ac)
+	d := NewDeque[*item](ac)
+	r := NewRing[struct{ p *item }](ac, 1000)
+	for i := 0; i < 1000; i++ {
+		l.PushBack(&item{s: "l" + strconv.Itoa(i), n: i})
+		d.PushFront(&item{s: "d" + strconv.Itoa(i), n: i})
+		r.Push(struct{ p *item }{&item{s: "r" + strconv.Itoa(i), n: i}})
+	}
+	runtime.GC() // 值引用的堆对象只被内存池引用
+	runtime.GC()
+
+	i := 0
+	for e := l.Front(); e != nil; e = e.Next() {
+		assert.EqualValues(t, item{s: "l" + strconv.Itoa(i), n: i}, *e.Value)
+		i++
+	}
+	for i := 999; i >= 0; i-- {
+		v, _ := d.PopFront()
+		assert.EqualValues(t, item{s: "d" + strconv.Itoa(i), n: i}, *v)
+		v2, _ := r.Pop()
+		assert.EqualValues(t, item{s: "r" + strconv.Itoa(999-i), n: 999 - i}, *v2.p)
+	}
+
+	runtime.KeepAlive(ac)
+}
@@ -0,0 +1,136 @@
+package lpcsv
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	memorypool "github.com/userpro/linearpool"
+)
+
+var (
+	errNoHeader = errors.New("lpcsv: Decode called before ReadHeader")
+
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// decodePlan 表头中每一列对应的结构体字段, 按结构体类型缓存在 Reader 中
+type decodePlan struct {
+	typ    reflect.Type
+	fields []int // 第 i 列对应的字段下标, -1 表示忽略
+}
+
+// Decode 读取下一条记录, 按 ReadHeader 读到的列名填充 v (指向结构体的指针).
+//
+// 列名来自字段的 `csv:"name"` tag, 默认为 Go 字段名, `csv:"-"` 忽略该字段, 表头中没有对应字段的列被忽略.
+// 支持 string, bool, 整数, 浮点数, encoding.TextUnmarshaler 以及它们的指针; 指针字段在列为空时为 nil.
+// v 会先被清空. string 字段直接引用记录中的字符串, 生命周期同记录. 没有更多记录时返回 io.EOF
+func (r *Reader) Decode(v any) error {
+	if r.header == nil {
+		return errNoHeader
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("lpcsv: Decode(non-nil pointer to struct expected, got %T)", v)
+	}
+	rv = rv.Elem()
+
+	if r.plan == nil || r.plan.typ != rv.Type() {
+		r.plan = newDecodePlan(rv.Type(), r.header)
+	}
+	record, err := r.Read()
+	if err != nil {
+		return err
+	}
+	ac := r.Allocator()
+	rv.SetZero()
+	for i, s := range record {
+		if i >= len(r.plan.fields) || r.plan.fields[i] < 0 {
+			continue
+		}
+		if err := setField(ac, rv.Field(r.plan.fields[i]), s); err != nil {
+			return fmt.Errorf("lpcsv: line %d, column %q: %w", r.numLine, r.header[i], err)
+		}
+	}
+	return nil
+}
+
+func newDecodePlan(t reflect.Type, header []string) *decodePlan {
+	byName := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(sf.Tag.Get("csv"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		byName[name] = i
+	}
+
+	p := &decodePlan{typ: t, fields: make([]int, len(header))}
+	for i, h := range header {
+		if j, ok := byName[h]; ok {
+			p.fields[i] = j
+		} else {
+			p.fields[i] = -1
+		}
+	}
+	return p
+}
+
+// setField 把 s 解析到字段 v, ac 是当前记录的分配器
+func setField(ac *memorypool.Allocator, v reflect.Value, s string) error {
+	if v.Kind() == reflect.Pointer {
+		if s == "" {
+			v.SetZero()
+			return nil
+		}
+		// 每条记录都分配新的值, 不修改上一条记录留下的指针
+		v.Set(ac.NewValue(v.Type().Elem()))
+		v = v.Elem()
+	}
+
+	if v.CanAddr() && reflect.PointerTo(v.Type()).Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type %v", v.Type())
+	}
+	return nil
+}
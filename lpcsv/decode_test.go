@@ -0,0 +1,87 @@
+package lpcsv
+
+import (
+	"io"
+	"net/netip"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	memorypool "github.com/userpro/linearpool"
+)
+
+type row struct {
+	Name    string     `csv:"name"`
+	Age     int        `csv:"age"`
+	Score   *float64   `csv:"score"`
+	Active  bool       `csv:"active"`
+	Addr    netip.Addr `csv:"addr"`
+	Ignored string     `csv:"-"`
+	Count   uint16
+	private int
+}
+
+func TestDecode(t *testing.T) {
+	ac := memorypool.NewAlloctorFromPool(0)
+	in := "name,extra,age,score,active,addr,Count,Ignored\n" +
+		"alice,x,30,1.5,true,10.0.0.1,7,skip\n" +
+		"\"bob, jr\",y,-1,,false,::1,0,skip\n"
+	r := NewReader(ac, strings.NewReader(in))
+
+	var v row
+	assert.Equal(t, errNoHeader, r.Decode(&v))
+	header, err := r.ReadHeader()
+	assert.Nil(t, err)
+	assert.EqualValues(t, 8, len(header))
+
+	var rows []row
+	for {
+		err := r.Decode(&v)
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		rows = append(rows, v)
+	}
+	runtime.GC()
+
+	assert.EqualValues(t, 2, len(rows))
+	assert.EqualValues(t, "alice", rows[0].Name)
+	assert.EqualValues(t, 30, rows[0].Age)
+	assert.EqualValues(t, 1.5, *rows[0].Score)
+	assert.True(t, rows[0].Active)
+	assert.EqualValues(t, netip.MustParseAddr("10.0.0.1"), rows[0].Addr)
+	assert.EqualValues(t, 7, rows[0].Count)
+	assert.EqualValues(t, "", rows[0].Ignored)
+	assert.EqualValues(t, "bob, jr", rows[1].Name)
+	assert.EqualValues(t, -1, rows[1].Age)
+	assert.Nil(t, rows[1].Score)
+	assert.EqualValues(t, netip.MustParseAddr("::1"), rows[1].Addr)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	ac := memorypool.NewAlloctorFromPool(0)
+	for _, in := range []string{
+		"age\nx\n",
+		"Count\n70000\n",
+		"active\nmaybe\n",
+		"addr\nnot-an-ip\n",
+	} {
+		r := NewReader(ac, strings.NewReader(in))
+		_, err := r.ReadHeader()
+		assert.Nil(t, err)
+		var v row
+		assert.NotNil(t, r.Decode(&v), in)
+	}
+
+	r := NewReader(ac, strings.NewReader("A\n1\n"))
+	_, _ = r.ReadHeader()
+	assert.NotNil(t, r.Decode(row{}))
+	var bad struct{ A []int }
+	assert.NotNil(t, r.Decode(&bad))
+
+	runtime.KeepAlive(ac)
+}
@@ -0,0 +1,331 @@
+// Package lpcsv 记录分配在内存池中的 CSV 读取器.
+//
+// 格式同 encoding/csv (RFC 4180), 错误也使用 encoding/csv 的 *csv.ParseError 和 ErrQuote 等.
+// 每条记录的 []string 和其中的字符串都从 Allocator 分配, 一条记录的所有字段共享一次分配,
+// 读取时堆上只有复用的行缓冲.
+package lpcsv
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"unicode"
+	"unicode/utf8"
+
+	memorypool "github.com/userpro/linearpool"
+)
+
+var errInvalidDelim = errors.New("lpcsv: invalid field or comment delimiter")
+
+// Reader 从 io.Reader 读取 CSV 记录, 导出字段的含义同 csv.Reader
+type Reader struct {
+	// Comma 字段分隔符, NewReader 设置为 ','
+	Comma rune
+	// Comment 不为 0 时, 以它开头的行被忽略
+	Comment rune
+	// FieldsPerRecord 大于 0 时每条记录必须有这么多字段; 为 0 时以第一条记录为准; 小于 0 时不检查
+	FieldsPerRecord int
+	// LazyQuotes 允许不带引号的字段中出现引号, 以及带引号的字段中出现单个引号
+	LazyQuotes bool
+	// TrimLeadingSpace 忽略字段开头的空白
+	TrimLeadingSpace bool
+
+	// BatchRows 大于 0 时记录改为从一个子分配器分配, 每读取 BatchRows 条记录后 Reset 这个子分配器,
+	// 之前返回的记录随之失效. 用于逐批处理大文件, 内存占用不随行数增长.
+	// 子分配器通过 AddSubAlloctor 挂在创建 Reader 的 Allocator 上, 父分配器 Reset 后重新从分配池获取,
+	// 不再使用时调用 Release 归还
+	BatchRows int
+
+	ac    *memorypool.Allocator
+	batch *memorypool.Allocator
+	rows  int // 当前批次已读取的记录数
+
+	r *bufio.Reader
+
+	numLine int
+
+	rawBuffer    []byte // 超过 bufio 缓冲区的行
+	recordBuffer []byte // 去掉引号和分隔符后的记录内容
+	fieldIndexes []int  // 每个字段在 recordBuffer 中的结束位置
+
+	header []string
+	plan   *decodePlan
+}
+
+// NewReader 新建 Reader, 记录从 ac 分配, 生命周期不能超过 ac
+func NewReader(ac *memorypool.Allocator, r io.Reader) *Reader {
+	return &Reader{
+		Comma: ',',
+		ac:    ac,
+		r:     bufio.NewReader(r),
+	}
+}
+
+// Allocator 下一条记录所使用的分配器, 设置了 BatchRows 时是当前批次的子分配器
+func (r *Reader) Allocator() *memorypool.Allocator {
+	if r.BatchRows <= 0 {
+		return r.ac
+	}
+	if r.batch != nil && !r.attached() {
+		// 父分配器 Reset 时已经重置并移除了子分配器, 归还后重新获取
+		r.batch.ReturnAlloctorToPool()
+		r.batch = nil
+	}
+	if r.batch == nil {
+		r.batch = memorypool.NewAlloctorFromPool(r.ac.BlockSize())
+		r.ac.AddSubAlloctor(r.batch)
+		r.rows = 0
+	}
+	return r.batch
+}
+
+// attached 批次的子分配器是否仍挂在父分配器上
+func (r *Reader) attached() bool {
+	for _, sub := range r.ac.SubAlloctor() {
+		if sub == r.batch {
+			return true
+		}
+	}
+	return false
+}
+
+// Release 把批次的子分配器从父分配器上移除并归还分配池, 从中分配的记录随之失效.
+// 之后仍可以继续读取, 下一批记录会重新获取子分配器
+func (r *Reader) Release() {
+	if r.batch == nil {
+		return
+	}
+	// 父分配器 Reset 后子分配器已不在父分配器上, 同样归还
+	r.ac.RemoveSubAlloctor(r.batch)
+	r.batch.ReturnAlloctorToPool()
+	r.batch = nil
+	r.rows = 0
+}
+
+// Read 读取一条记录, 没有更多记录时返回 nil, io.EOF.
+// 字段数不符时同 csv.Reader 返回记录和 csv.ErrFieldCount
+func (r *Reader) Read() ([]string, error) {
+	return r.readRecord(r.Allocator(), r.BatchRows > 0)
+}
+
+// ReadAll 读取剩下的所有记录, 外层切片同样从 ac 分配. 需要保留所有记录, 因此忽略 BatchRows
+func (r *Reader) ReadAll() ([][]string, error) {
+	var records [][]string
+	for {
+		record, err := r.readRecord(r.ac, false)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = memorypool.Append(r.ac, records, record)
+	}
+}
+
+// ReadHeader 读取一条记录作为表头, 之后可以用 Decode 按列名映射到结构体.
+// 表头从创建 Reader 的 Allocator 分配, 不受 BatchRows 影响
+func (r *Reader) ReadHeader() ([]string, error) {
+	header, err := r.readRecord(r.ac, false)
+	if err != nil {
+		return nil, err
+	}
+	r.header = header
+	r.plan = nil
+	return header, nil
+}
+
+// readLine 读取一行, 行尾的 \r\n 统一为 \n
+func (r *Reader) readLine() ([]byte, error) {
+	line, err := r.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		r.rawBuffer = append(r.rawBuffer[:0], line...)
+		for err == bufio.ErrBufferFull {
+			line, err = r.r.ReadSlice('\n')
+			r.rawBuffer = append(r.rawBuffer, line...)
+		}
+		line = r.rawBuffer
+	}
+	if len(line) > 0 && err == io.EOF {
+		err = nil
+		// 文件末尾的 \r 去掉
+		if line[len(line)-1] == '\r' {
+			line = line[:len(line)-1]
+		}
+	}
+	r.numLine++
+	if n := len(line); n >= 2 && line[n-2] == '\r' && line[n-1] == '\n' {
+		line[n-2] = '\n'
+		line = line[:n-1]
+	}
+	return line, err
+}
+
+// readRecord 读取一条记录并从 ac 分配. batch 为 true 时 ac 是批次的子分配器,
+// 读到记录之后, 分配之前才 Reset, 因此读到 io.EOF 不会使上一批记录失效
+func (r *Reader) readRecord(ac *memorypool.Allocator, batch bool) ([]string, error) {
+	if r.Comma == r.Comment || !validDelim(r.Comma) || (r.Comment != 0 && !validDelim(r.Comment)) {
+		return nil, errInvalidDelim
+	}
+
+	// 跳过空行和注释
+	var line []byte
+	var errRead error
+	for errRead == nil {
+		line, errRead = r.readLine()
+		if r.Comment != 0 && nextRune(line) == r.Comment {
+			line = nil
+			continue
+		}
+		if errRead == nil && len(line) == lengthNL(line) {
+			line = nil
+			continue
+		}
+		break
+	}
+	if errRead == io.EOF {
+		return nil, errRead
+	}
+
+	var err error
+	const quoteLen = len(`"`)
+	commaLen := utf8.RuneLen(r.Comma)
+	recLine := r.numLine
+	full, pos := line, recLine // 当前行和行号, 用于计算出错的位置
+	r.recordBuffer = r.recordBuffer[:0]
+	r.fieldIndexes = r.fieldIndexes[:0]
+parseField:
+	for {
+		if r.TrimLeadingSpace {
+			i := bytes.IndexFunc(line, func(r rune) bool { return !unicode.IsSpace(r) })
+			if i < 0 {
+				i = len(line)
+			}
+			line = line[i:]
+		}
+		if len(line) == 0 || line[0] != '"' {
+			// 不带引号的字段
+			i := bytes.IndexRune(line, r.Comma)
+			field := line
+			if i >= 0 {
+				field = field[:i]
+			} else {
+				field = field[:len(field)-lengthNL(field)]
+			}
+			if !r.LazyQuotes {
+				if j := bytes.IndexByte(field, '"'); j >= 0 {
+					line = line[j:]
+					err = parseError(recLine, pos, len(full)-len(line)+1, csv.ErrBareQuote)
+					break parseField
+				}
+			}
+			r.recordBuffer = append(r.recordBuffer, field...)
+			r.fieldIndexes = append(r.fieldIndexes, len(r.recordBuffer))
+			if i >= 0 {
+				line = line[i+commaLen:]
+				continue parseField
+			}
+			break parseField
+		}
+
+		// 带引号的字段, 可以跨行
+		line = line[quoteLen:]
+		for {
+			i := bytes.IndexByte(line, '"')
+			switch {
+			case i >= 0:
+				r.recordBuffer = append(r.recordBuffer, line[:i]...)
+				line = line[i+quoteLen:]
+				switch rn := nextRune(line); {
+				case rn == '"': // `""` 转义的引号
+					r.recordBuffer = append(r.recordBuffer, '"')
+					line = line[quoteLen:]
+				case rn == r.Comma: // `",` 字段结束
+					line = line[commaLen:]
+					r.fieldIndexes = append(r.fieldIndexes, len(r.recordBuffer))
+					continue parseField
+				case lengthNL(line) == len(line): // `"\n` 记录结束
+					r.fieldIndexes = append(r.fieldIndexes, len(r.recordBuffer))
+					break parseField
+				case r.LazyQuotes:
+					r.recordBuffer = append(r.recordBuffer, '"')
+				default:
+					err = parseError(recLine, pos, len(full)-len(line)+1-quoteLen, csv.ErrQuote)
+					break parseField
+				}
+			case len(line) > 0: // 行尾, 继续读下一行
+				r.recordBuffer = append(r.recordBuffer, line...)
+				if errRead != nil {
+					break parseField
+				}
+				line, errRead = r.readLine()
+				if len(line) > 0 {
+					full, pos = line, r.numLine
+				}
+				if errRead == io.EOF {
+					errRead = nil
+				}
+			default: // 文件在引号内结束
+				if !r.LazyQuotes && errRead == nil {
+					err = parseError(recLine, pos, len(full)-len(line)+1, csv.ErrQuote)
+					break parseField
+				}
+				r.fieldIndexes = append(r.fieldIndexes, len(r.recordBuffer))
+				break parseField
+			}
+		}
+	}
+	if err == nil {
+		err = errRead
+	}
+
+	if batch {
+		if r.rows >= r.BatchRows {
+			ac.Reset()
+			r.rows = 0
+		}
+		r.rows++
+	}
+
+	// 所有字段共享一个字符串
+	str := ac.NewString(memorypool.BytesToString(r.recordBuffer))
+	record := memorypool.NewSlice[string](ac, len(r.fieldIndexes), len(r.fieldIndexes))
+	pre := 0
+	for i, idx := range r.fieldIndexes {
+		record[i] = str[pre:idx]
+		pre = idx
+	}
+
+	if r.FieldsPerRecord > 0 {
+		if len(record) != r.FieldsPerRecord && err == nil {
+			err = &csv.ParseError{StartLine: recLine, Line: recLine, Column: 1, Err: csv.ErrFieldCount}
+		}
+	} else if r.FieldsPerRecord == 0 {
+		r.FieldsPerRecord = len(record)
+	}
+	return record, err
+}
+
+func parseError(recLine, line, col int, err error) error {
+	return &csv.ParseError{StartLine: recLine, Line: line, Column: col, Err: err}
+}
+
+func validDelim(r rune) bool {
+	return r != 0 && r != '"' && r != '\r' && r != '\n' && utf8.ValidRune(r) && r != utf8.RuneError
+}
+
+// lengthNL 行尾是否有换行符
+func lengthNL(b []byte) int {
+	if len(b) > 0 && b[len(b)-1] == '\n' {
+		return 1
+	}
+	return 0
+}
+
+// nextRune b 的第一个字符
+func nextRune(b []byte) rune {
+	r, _ := utf8.DecodeRune(b)
+	return r
+}
@@ -0,0 +1,148 @@
+package lpcsv
+
+import (
+	"encoding/csv"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	memorypool "github.com/userpro/linearpool"
+)
+
+func TestRead(t *testing.T) {
+	ac := memorypool.NewAlloctorFromPool(0)
+	for _, c := range []struct {
+		in      string
+		setup   func(r *Reader, std *csv.Reader)
+		wantErr bool
+	}{
+		{in: "a,b,c\n1,2,3\n"},
+		{in: "a,b\r\n\r\n\"x\"\"y\",\"multi\nline\"\r\nlast,\"\"\n"},
+		{in: "no newline at end,x\r"},
+		{in: "a;b;c\n# comment\n1; 2;3\n", setup: func(r *Reader, std *csv.Reader) {
+			r.Comma, std.Comma = ';', ';'
+			r.Comment, std.Comment = '#', '#'
+			r.TrimLeadingSpace, std.TrimLeadingSpace = true, true
+		}},
+		{in: "a\tβ\tc\n", setup: func(r *Reader, std *csv.Reader) { r.Comma, std.Comma = '\t', '\t' }},
+		{in: "a,b\n1\n", setup: func(r *Reader, std *csv.Reader) {
+			r.FieldsPerRecord, std.FieldsPerRecord = -1, -1
+		}},
+		{in: "a,b\n1\n", wantErr: true},
+		{in: "a,b\"c\n", wantErr: true},
+		{in: "a,\"b\"c\n", wantErr: true},
+		{in: "a,\"bc\n", wantErr: true},
+		{in: "a,b\"c\",\"d\"e\"\n", setup: func(r *Reader, std *csv.Reader) { r.LazyQuotes, std.LazyQuotes = true, true }},
+		{in: "a,b\n", setup: func(r *Reader, std *csv.Reader) { r.Comma, std.Comma = '"', '"' }, wantErr: true},
+		{in: strings.Repeat("x", 10000) + "," + strings.Repeat("y", 5000) + "\n"},
+	} {
+		r := NewReader(ac, strings.NewReader(c.in))
+		std := csv.NewReader(strings.NewReader(c.in))
+		if c.setup != nil {
+			c.setup(r, std)
+		}
+		for {
+			want, wantErr := std.Read()
+			got, err := r.Read()
+			if _, ok := wantErr.(*csv.ParseError); ok || wantErr == nil || wantErr == io.EOF {
+				assert.EqualValues(t, wantErr, err, "%q", c.in)
+			} else {
+				assert.NotNil(t, err, "%q", c.in)
+			}
+			if wantErr != nil {
+				assert.True(t, c.wantErr || wantErr == io.EOF, "%q: %v", c.in, wantErr)
+				break
+			}
+			assert.EqualValues(t, want, got, "%q", c.in)
+		}
+	}
+
+	all, err := NewReader(ac, strings.NewReader("a,b\nc,d\n")).ReadAll()
+	assert.Nil(t, err)
+	runtime.GC()
+	assert.EqualValues(t, [][]string{{"a", "b"}, {"c", "d"}}, all)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestReadBatch(t *testing.T) {
+	ac := memorypool.NewAlloctorFromPool(0)
+	in := strings.Repeat("hello,world,\"quoted, field\",12345\n", 10000)
+	r := NewReader(ac, strings.NewReader(in))
+	r.BatchRows = 100
+
+	var last []string
+	maxBytes := int64(0)
+	n := 0
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		if n%100 == 99 {
+			st := r.Allocator().Stats()
+			if b := st.AlignedBytes + st.PackedBytes; b > maxBytes {
+				maxBytes = b
+			}
+		}
+		last = record
+		n++
+	}
+	assert.EqualValues(t, 10000, n)
+	assert.EqualValues(t, []string{"hello", "world", "quoted, field", "12345"}, last)
+	// 每批记录占用的内存在 Reset 后复用
+	assert.Less(t, maxBytes, int64(100*100))
+	assert.EqualValues(t, 1, len(ac.SubAlloctor()))
+	assert.EqualValues(t, 1, ac.Stats().Blocks)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestReadBatchRelease(t *testing.T) {
+	ac := memorypool.NewAlloctorFromPool(0)
+	r := NewReader(ac, strings.NewReader(strings.Repeat("a,b\n", 100)))
+	r.BatchRows = 10
+
+	for i := 0; i < 5; i++ {
+		_, err := r.Read()
+		assert.Nil(t, err)
+	}
+	batch := r.Allocator()
+	assert.EqualValues(t, []*memorypool.Allocator{batch}, ac.SubAlloctor())
+
+	// 父分配器 Reset 后重新获取子分配器并挂到父分配器上, 新的批次从头计数
+	ac.Reset()
+	record, err := r.Read()
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"a", "b"}, record)
+	assert.EqualValues(t, []*memorypool.Allocator{r.Allocator()}, ac.SubAlloctor())
+	assert.EqualValues(t, 1, r.rows)
+
+	r.Release()
+	assert.EqualValues(t, 0, len(ac.SubAlloctor()))
+	r.Release()
+	record, err = r.Read()
+	assert.Nil(t, err)
+	assert.EqualValues(t, []string{"a", "b"}, record)
+	assert.EqualValues(t, 1, len(ac.SubAlloctor()))
+
+	r.Release()
+	runtime.KeepAlive(ac)
+}
+
+func TestReadNoHeapAlloc(t *testing.T) {
+	ac := memorypool.NewAlloctorFromPool(0)
+	r := NewReader(ac, strings.NewReader(strings.Repeat("a,\"b\"\"c\",d\n", 200)))
+	r.BatchRows = 10
+	_, _ = r.Read()
+
+	n := testing.AllocsPerRun(100, func() {
+		_, _ = r.Read()
+	})
+	assert.EqualValues(t, 0, n)
+
+	runtime.KeepAlive(ac)
+}
@@ -0,0 +1,111 @@
+// Package lpframe 读取带长度前缀的消息帧, 每一帧读入一个单独的 Allocator.
+//
+// 帧的格式为 长度前缀 + payload, 长度前缀可以是 uvarint 或固定宽度的整数.
+// 每帧使用 NewAlloctorFromPool 取得的分配器, 处理完后调用 ReturnAlloctorToPool 整体释放,
+// 帧的 payload 以及处理过程中分配的对象都不会给 GC 带来负担.
+package lpframe
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	memorypool "github.com/userpro/linearpool"
+)
+
+// DefaultMaxFrameSize NewReader 默认的单帧大小上限
+const DefaultMaxFrameSize = 4 << 20
+
+// ErrFrameTooLarge 帧长度超过 MaxFrameSize
+var ErrFrameTooLarge = errors.New("lpframe: frame too large")
+
+// Prefix 长度前缀的编码方式
+type Prefix int
+
+const (
+	Uvarint Prefix = iota // encoding/binary 的 uvarint
+	Uint8                 // 1 字节
+	Uint16                // 2 字节, 字节序由 Reader.ByteOrder 决定
+	Uint32                // 4 字节
+	Uint64                // 8 字节
+)
+
+// Reader 从 io.Reader 按帧读取消息
+type Reader struct {
+	// ByteOrder 固定宽度长度前缀的字节序, NewReader 设置为 binary.BigEndian
+	ByteOrder binary.ByteOrder
+	// MaxFrameSize 单帧 payload 的最大字节数, NewReader 设置为 DefaultMaxFrameSize, 小于等于 0 时不限制
+	MaxFrameSize int
+	// BlockSize 每帧分配器的 blocksize, 传给 NewAlloctorFromPool
+	BlockSize int64
+
+	prefix Prefix
+	r      *bufio.Reader
+	hdr    [8]byte
+}
+
+// NewReader 新建 Reader, 长度前缀的编码方式为 prefix
+func NewReader(r io.Reader, prefix Prefix) *Reader {
+	if prefix < Uvarint || prefix > Uint64 {
+		panic(fmt.Sprintf("lpframe: invalid prefix %d", prefix))
+	}
+	return &Reader{
+		ByteOrder:    binary.BigEndian,
+		MaxFrameSize: DefaultMaxFrameSize,
+		prefix:       prefix,
+		r:            bufio.NewReader(r),
+	}
+}
+
+// ReadFrame 读取下一帧, payload 分配在新取得的 ac 中, 生命周期同 ac.
+// 调用方处理完后需要 ac.ReturnAlloctorToPool(). 出错时 ac 为 nil.
+// 在帧边界上读到结尾时返回 io.EOF, 帧不完整时返回 io.ErrUnexpectedEOF
+func (r *Reader) ReadFrame() (payload []byte, ac *memorypool.Allocator, err error) {
+	n, err := r.readLength()
+	if err != nil {
+		return nil, nil, err
+	}
+	if n > math.MaxInt || (r.MaxFrameSize > 0 && n > uint64(r.MaxFrameSize)) {
+		return nil, nil, ErrFrameTooLarge
+	}
+
+	ac = memorypool.NewAlloctorFromPool(r.BlockSize)
+	payload = memorypool.NewSlice[byte](ac, int(n), int(n))
+	if _, err = io.ReadFull(r.r, payload); err != nil {
+		ac.ReturnAlloctorToPool()
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, nil, err
+	}
+	return payload, ac, nil
+}
+
+// readLength 读取长度前缀
+func (r *Reader) readLength() (uint64, error) {
+	if r.prefix == Uvarint {
+		n, err := binary.ReadUvarint(r.r)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			err = fmt.Errorf("lpframe: %w", err)
+		}
+		return n, err
+	}
+
+	hdr := r.hdr[:1<<(r.prefix-Uint8)]
+	if _, err := io.ReadFull(r.r, hdr); err != nil {
+		return 0, err
+	}
+	switch r.prefix {
+	case Uint8:
+		return uint64(hdr[0]), nil
+	case Uint16:
+		return uint64(r.ByteOrder.Uint16(hdr)), nil
+	case Uint32:
+		return uint64(r.ByteOrder.Uint32(hdr)), nil
+	default:
+		return r.ByteOrder.Uint64(hdr), nil
+	}
+}
@@ -0,0 +1,113 @@
+package lpframe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/userpro/linearpool/internal/race"
+)
+
+// frames 按 prefix 编码若干帧
+func frames(prefix Prefix, order binary.AppendByteOrder, payloads ...string) []byte {
+	var b []byte
+	for _, p := range payloads {
+		switch prefix {
+		case Uvarint:
+			b = binary.AppendUvarint(b, uint64(len(p)))
+		case Uint8:
+			b = append(b, byte(len(p)))
+		case Uint16:
+			b = order.AppendUint16(b, uint16(len(p)))
+		case Uint32:
+			b = order.AppendUint32(b, uint32(len(p)))
+		case Uint64:
+			b = order.AppendUint64(b, uint64(len(p)))
+		}
+		b = append(b, p...)
+	}
+	return b
+}
+
+func TestReadFrame(t *testing.T) {
+	payloads := []string{"hello", "", strings.Repeat("x", 300), "world"}
+	for _, order := range []interface {
+		binary.ByteOrder
+		binary.AppendByteOrder
+	}{binary.BigEndian, binary.LittleEndian} {
+		for prefix := Uvarint; prefix <= Uint64; prefix++ {
+			ps := payloads
+			if prefix == Uint8 {
+				ps = []string{"hello", "", strings.Repeat("x", 255)}
+			}
+			// 逐字节读取, 覆盖长度前缀和 payload 被拆开的情况
+			r := NewReader(iotest.OneByteReader(bytes.NewReader(frames(prefix, order, ps...))), prefix)
+			r.ByteOrder = order
+			for _, want := range ps {
+				payload, ac, err := r.ReadFrame()
+				assert.Nil(t, err)
+				runtime.GC()
+				assert.EqualValues(t, want, string(payload))
+				ac.ReturnAlloctorToPool()
+			}
+			_, ac, err := r.ReadFrame()
+			assert.Equal(t, io.EOF, err)
+			assert.Nil(t, ac)
+		}
+	}
+}
+
+func TestReadFrameErrors(t *testing.T) {
+	for _, c := range []struct {
+		prefix Prefix
+		max    int
+		in     []byte
+		err    error
+	}{
+		{Uvarint, 0, nil, io.EOF},
+		{Uvarint, 0, []byte{0x80}, io.ErrUnexpectedEOF},
+		{Uvarint, 0, []byte{0x05, 'a', 'b'}, io.ErrUnexpectedEOF},
+		{Uint32, 0, []byte{0, 0}, io.ErrUnexpectedEOF},
+		{Uint16, 0, []byte{0, 3, 'a'}, io.ErrUnexpectedEOF},
+		{Uvarint, 4, []byte{0x05, 'a', 'b', 'c', 'd', 'e'}, ErrFrameTooLarge},
+		{Uint64, 0, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, ErrFrameTooLarge},
+	} {
+		r := NewReader(bytes.NewReader(c.in), c.prefix)
+		r.MaxFrameSize = c.max
+		_, ac, err := r.ReadFrame()
+		assert.Equal(t, c.err, err, "%x", c.in)
+		assert.Nil(t, ac)
+	}
+
+	// 超过 64 位的 uvarint
+	r := NewReader(bytes.NewReader(bytes.Repeat([]byte{0xff}, 11)), Uvarint)
+	_, _, err := r.ReadFrame()
+	assert.NotNil(t, err)
+
+	assert.Panics(t, func() { NewReader(nil, Uint64+1) })
+}
+
+func TestReadFrameNoHeapAlloc(t *testing.T) {
+	if race.Enabled {
+		t.Skip("sync.Pool drops objects randomly under the race detector")
+	}
+	data := frames(Uvarint, binary.BigEndian, "hello", strings.Repeat("y", 100))
+	rd := bytes.NewReader(data)
+	r := NewReader(rd, Uvarint)
+	n := testing.AllocsPerRun(100, func() {
+		rd.Reset(data)
+		for i := 0; i < 2; i++ {
+			_, ac, err := r.ReadFrame()
+			if err != nil {
+				panic(err)
+			}
+			ac.ReturnAlloctorToPool()
+		}
+	})
+	assert.EqualValues(t, 0, n)
+}
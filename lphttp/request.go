@@ -0,0 +1,385 @@
+// Package lphttp 把 HTTP/1.1 请求头解析到内存池中, 用于代理等只需要读取请求头的快速路径.
+// 需要完整的 net/http 语义时可以用 Request.HTTPRequest 转换为 *http.Request.
+package lphttp
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	memorypool "github.com/userpro/linearpool"
+)
+
+var (
+	ErrLineTooLong         = errors.New("lphttp: header line too long")
+	ErrMalformedRequest    = errors.New("lphttp: malformed request line")
+	ErrMalformedHeader     = errors.New("lphttp: malformed header line")
+	ErrBadVersion          = errors.New("lphttp: unsupported protocol version")
+	ErrBadContentLength    = errors.New("lphttp: bad Content-Length")
+	ErrBadTransferEncoding = errors.New("lphttp: unsupported Transfer-Encoding")
+	ErrBadEscape           = errors.New("lphttp: invalid URL escape")
+	ErrMissingHost         = errors.New("lphttp: missing required Host header")
+)
+
+// HeaderField 一个请求头, Name 已规范化为 textproto.CanonicalMIMEHeaderKey 的形式
+type HeaderField struct {
+	Name  string
+	Value string
+}
+
+// Param 一个 query 参数, 已经做过 URL 解码
+type Param struct {
+	Key   string
+	Value string
+}
+
+// Request 请求行和请求头, 所有字符串和切片都分配在内存池中, 生命周期不能超过 Allocator
+type Request struct {
+	Method     string
+	RequestURI string // 请求行中未修改的 request-target
+	Path       string // 解码后的路径, CONNECT 请求为空
+	RawQuery   string // '?' 之后未解码的部分
+	Query      []Param
+	Proto      string // "HTTP/1.1"
+	ProtoMajor int
+	ProtoMinor int
+
+	Header []HeaderField // 按出现顺序
+
+	Host          string // Host 头, absolute-form 和 CONNECT 请求取 request-target 中的主机
+	ContentLength int64  // chunked 时为 -1
+	Chunked       bool   // Transfer-Encoding: chunked
+	Close         bool   // 处理完这个请求后需要关闭连接
+}
+
+// ReadRequest 从 br 读取请求行和请求头, 不读取 body.
+// 单行长度不能超过 br 的缓冲区大小, 否则返回 ErrLineTooLong. 请求头不完整时返回 io.ErrUnexpectedEOF
+func ReadRequest(ac *memorypool.Allocator, br *bufio.Reader) (*Request, error) {
+	line, err := readLine(br)
+	if err != nil {
+		if err == io.ErrUnexpectedEOF && line == nil {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+
+	r := memorypool.New[Request](ac)
+	if err := r.parseRequestLine(ac, line); err != nil {
+		return nil, err
+	}
+
+	r.ContentLength = -1
+	for {
+		if line, err = readLine(br); err != nil {
+			return nil, err
+		}
+		if len(line) == 0 {
+			break
+		}
+		if err := r.parseHeader(ac, line); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.Chunked {
+		// RFC 7230 3.3.3: 同时带有 Content-Length 和 Transfer-Encoding 的请求可能被用于请求走私, 直接拒绝
+		if r.ContentLength >= 0 {
+			return nil, ErrBadTransferEncoding
+		}
+	} else if r.ContentLength < 0 {
+		r.ContentLength = 0 // 同 net/http, 请求没有 Content-Length 时没有 body
+	}
+	// RFC 7230 5.4: HTTP/1.1 请求必须带 Host 头, 值可以为空; 同 net/http, CONNECT 除外
+	if r.ProtoMinor == 1 && r.Method != "CONNECT" && !r.hasHeader("Host") {
+		return nil, ErrMissingHost
+	}
+	r.Close = shouldClose(r)
+	return r, nil
+}
+
+// readLine 读取一行并去掉行尾的 \r\n, 返回的内容只在下一次读取之前有效
+func readLine(br *bufio.Reader) ([]byte, error) {
+	line, err := br.ReadSlice('\n')
+	switch {
+	case err == bufio.ErrBufferFull:
+		return nil, ErrLineTooLong
+	case err == io.EOF:
+		if len(line) == 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return line, io.ErrUnexpectedEOF
+	case err != nil:
+		return nil, err
+	}
+	line = line[:len(line)-1]
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	return line, nil
+}
+
+func (r *Request) parseRequestLine(ac *memorypool.Allocator, line []byte) error {
+	s := ac.NewString(memorypool.BytesToString(line))
+	method, rest, ok1 := strings.Cut(s, " ")
+	target, proto, ok2 := strings.Cut(rest, " ")
+	if !ok1 || !ok2 || !validToken(method) || target == "" {
+		return ErrMalformedRequest
+	}
+	major, minor, ok := http.ParseHTTPVersion(proto)
+	if !ok || major != 1 {
+		return ErrBadVersion
+	}
+	r.Method, r.RequestURI, r.Proto, r.ProtoMajor, r.ProtoMinor = method, target, proto, major, minor
+
+	if method == "CONNECT" && target[0] != '/' {
+		r.Host = target // authority-form
+		return nil
+	}
+
+	// absolute-form
+	if i := strings.Index(target, "://"); i > 0 && target[0] != '/' {
+		authority := target[i+3:]
+		j := strings.IndexAny(authority, "/?")
+		if j < 0 {
+			j = len(authority)
+		}
+		r.Host = authority[:j]
+		target = authority[j:]
+		if target == "" || target[0] == '?' {
+			target = "/" + target
+		}
+	} else if target[0] != '/' && target != "*" {
+		return ErrMalformedRequest
+	}
+
+	path, query, _ := strings.Cut(target, "?")
+	var err error
+	if r.Path, err = ac.PathUnescape(path); err != nil {
+		return ErrBadEscape
+	}
+	r.RawQuery = query
+	return r.parseQuery(ac, query)
+}
+
+func (r *Request) parseQuery(ac *memorypool.Allocator, query string) error {
+	if query == "" {
+		return nil
+	}
+	r.Query = memorypool.NewSlice[Param](ac, 0, strings.Count(query, "&")+1)
+	for query != "" {
+		var kv string
+		kv, query, _ = strings.Cut(query, "&")
+		if kv == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(kv, "=")
+		var p Param
+		var err error
+		if p.Key, err = ac.QueryUnescape(k); err != nil {
+			return ErrBadEscape
+		}
+		if p.Value, err = ac.QueryUnescape(v); err != nil {
+			return ErrBadEscape
+		}
+		r.Query = append(r.Query, p) // 容量已按 '&' 的个数分配
+	}
+	return nil
+}
+
+func (r *Request) parseHeader(ac *memorypool.Allocator, line []byte) error {
+	// 续行 (obs-fold) 已被 RFC 7230 废弃, 直接拒绝
+	if line[0] == ' ' || line[0] == '\t' {
+		return ErrMalformedHeader
+	}
+	i := 0
+	for i < len(line) && line[i] != ':' {
+		i++
+	}
+	if i == 0 || i == len(line) || !validToken(memorypool.BytesToString(line[:i])) ||
+		!validFieldValue(line[i+1:]) {
+		return ErrMalformedHeader
+	}
+
+	// 整行拷贝进内存池后原地规范化名字
+	b := ac.Bytes(line)
+	canonicalize(b[:i])
+	f := HeaderField{
+		Name:  memorypool.BytesToString(b[:i]),
+		Value: strings.Trim(memorypool.BytesToString(b[i+1:]), " \t"),
+	}
+	r.Header = memorypool.Append(ac, r.Header, f)
+
+	switch f.Name {
+	case "Host":
+		if r.Host == "" {
+			r.Host = f.Value
+		}
+	case "Content-Length":
+		n, err := strconv.ParseInt(f.Value, 10, 64)
+		if err != nil || n < 0 || f.Value[0] == '+' || (r.ContentLength >= 0 && r.ContentLength != n) {
+			return ErrBadContentLength
+		}
+		r.ContentLength = n
+	case "Transfer-Encoding":
+		// 同 net/http, 只支持单个 chunked, 重复的 Transfer-Encoding 头也拒绝
+		if r.Chunked || !strings.EqualFold(f.Value, "chunked") {
+			return ErrBadTransferEncoding
+		}
+		r.Chunked = true
+	}
+	return nil
+}
+
+// hasHeader 是否有规范化名字为 name 的请求头
+func (r *Request) hasHeader(name string) bool {
+	for i := range r.Header {
+		if r.Header[i].Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Get 名字为 name 的第一个请求头的值, 不区分大小写
+func (r *Request) Get(name string) string {
+	for i := range r.Header {
+		if strings.EqualFold(r.Header[i].Name, name) {
+			return r.Header[i].Value
+		}
+	}
+	return ""
+}
+
+// QueryValue 名字为 key 的第一个 query 参数的值
+func (r *Request) QueryValue(key string) string {
+	for i := range r.Query {
+		if r.Query[i].Key == key {
+			return r.Query[i].Value
+		}
+	}
+	return ""
+}
+
+// shouldClose 同 net/http: HTTP/1.0 默认关闭, HTTP/1.1 默认保持
+func shouldClose(r *Request) bool {
+	for i := range r.Header {
+		if r.Header[i].Name != "Connection" {
+			continue
+		}
+		for _, v := range strings.Split(r.Header[i].Value, ",") {
+			switch v = strings.TrimSpace(v); {
+			case strings.EqualFold(v, "close"):
+				return true
+			case r.ProtoMinor == 0 && strings.EqualFold(v, "keep-alive"):
+				return false
+			}
+		}
+	}
+	return r.ProtoMinor == 0
+}
+
+// HTTPRequest 转换为 *http.Request, 用于需要 net/http 处理的慢路径.
+// 结果全部位于堆上, 不引用内存池, 可以在 Allocator 重置后继续使用. body 为 nil 时为 http.NoBody
+func (r *Request) HTTPRequest(body io.Reader) (*http.Request, error) {
+	var u *url.URL
+	if r.Method == "CONNECT" && r.Path == "" {
+		u = &url.URL{Host: strings.Clone(r.RequestURI)}
+	} else {
+		var err error
+		if u, err = url.ParseRequestURI(strings.Clone(r.RequestURI)); err != nil {
+			return nil, err
+		}
+	}
+
+	h := make(http.Header, len(r.Header))
+	for _, f := range r.Header {
+		if f.Name == "Host" {
+			continue // 同 net/http, Host 只保存在 Request.Host 中
+		}
+		vs, ok := h[f.Name]
+		if !ok {
+			f.Name = strings.Clone(f.Name)
+		}
+		h[f.Name] = append(vs, strings.Clone(f.Value))
+	}
+
+	req := &http.Request{
+		Method:        strings.Clone(r.Method),
+		URL:           u,
+		Proto:         strings.Clone(r.Proto),
+		ProtoMajor:    r.ProtoMajor,
+		ProtoMinor:    r.ProtoMinor,
+		Header:        h,
+		Host:          strings.Clone(r.Host),
+		RequestURI:    strings.Clone(r.RequestURI),
+		ContentLength: r.ContentLength,
+		Close:         r.Close,
+		Body:          http.NoBody,
+	}
+	if r.Chunked {
+		req.TransferEncoding = []string{"chunked"}
+	}
+	if body != nil {
+		req.Body = io.NopCloser(body)
+	}
+	return req, nil
+}
+
+//============================================================================
+// 工具函数
+//============================================================================
+
+// validToken RFC 7230 中的 token
+func validToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 0x80 || !tokenTable[c] {
+			return false
+		}
+	}
+	return true
+}
+
+// validFieldValue 同 httpguts.ValidHeaderFieldValue: 除 HTAB 外不能包含控制字符
+func validFieldValue(b []byte) bool {
+	for _, c := range b {
+		if (c < ' ' && c != '\t') || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+var tokenTable = func() (t [128]bool) {
+	for c := '0'; c <= '9'; c++ {
+		t[c] = true
+	}
+	for c := 'a'; c <= 'z'; c++ {
+		t[c] = true
+		t[c-'a'+'A'] = true
+	}
+	for _, c := range "!#$%&'*+-.^_`|~" {
+		t[c] = true
+	}
+	return
+}()
+
+// canonicalize 原地转换为 textproto.CanonicalMIMEHeaderKey 的形式, b 必须是合法的 token
+func canonicalize(b []byte) {
+	upper := true
+	for i, c := range b {
+		if upper && 'a' <= c && c <= 'z' {
+			b[i] = c - ('a' - 'A')
+		} else if !upper && 'A' <= c && c <= 'Z' {
+			b[i] = c + ('a' - 'A')
+		}
+		upper = c == '-'
+	}
+}
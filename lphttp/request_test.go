@@ -0,0 +1,177 @@
+package lphttp
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	memorypool "github.com/userpro/linearpool"
+)
+
+const rawRequest = "POST /api/v1/items%20x?id=42&name=a+b%21&flag&&empty= HTTP/1.1\r\n" +
+	"Host: example.com\r\n" +
+	"content-type: application/json\r\n" +
+	"X-FORWARDED-FOR:  10.0.0.1 \r\n" +
+	"x-forwarded-for: 10.0.0.2\r\n" +
+	"Content-Length: 7\r\n" +
+	"\r\n" +
+	"{\"a\":1}"
+
+func TestReadRequest(t *testing.T) {
+	ac := memorypool.NewAlloctorFromPool(0)
+	br := bufio.NewReader(strings.NewReader(rawRequest))
+	r, err := ReadRequest(ac, br)
+	assert.Nil(t, err)
+	runtime.GC()
+
+	assert.EqualValues(t, "POST", r.Method)
+	assert.EqualValues(t, "/api/v1/items x", r.Path)
+	assert.EqualValues(t, "id=42&name=a+b%21&flag&&empty=", r.RawQuery)
+	assert.EqualValues(t, []Param{{"id", "42"}, {"name", "a b!"}, {"flag", ""}, {"empty", ""}}, r.Query)
+	assert.EqualValues(t, "a b!", r.QueryValue("name"))
+	assert.EqualValues(t, "HTTP/1.1", r.Proto)
+	assert.EqualValues(t, "example.com", r.Host)
+	assert.EqualValues(t, 7, r.ContentLength)
+	assert.False(t, r.Close)
+	assert.EqualValues(t, []HeaderField{
+		{"Host", "example.com"},
+		{"Content-Type", "application/json"},
+		{"X-Forwarded-For", "10.0.0.1"},
+		{"X-Forwarded-For", "10.0.0.2"},
+		{"Content-Length", "7"},
+	}, r.Header)
+	assert.EqualValues(t, "application/json", r.Get("CONTENT-TYPE"))
+	assert.EqualValues(t, "", r.Get("Accept"))
+
+	// 转换后与 http.ReadRequest 的结果一致
+	got, err := r.HTTPRequest(br)
+	assert.Nil(t, err)
+	want, err := http.ReadRequest(bufio.NewReader(strings.NewReader(rawRequest)))
+	assert.Nil(t, err)
+	for _, req := range []*http.Request{want, got} {
+		req.Body.(io.Closer).Close()
+	}
+	assert.EqualValues(t, want.Method, got.Method)
+	assert.EqualValues(t, want.URL, got.URL)
+	assert.EqualValues(t, want.Header, got.Header)
+	assert.EqualValues(t, want.Host, got.Host)
+	assert.EqualValues(t, want.RequestURI, got.RequestURI)
+	assert.EqualValues(t, want.ContentLength, got.ContentLength)
+	assert.EqualValues(t, want.Close, got.Close)
+
+	// 重置内存池后转换结果仍然可用
+	body, _ := io.ReadAll(got.Body)
+	ac.Reset()
+	runtime.GC()
+	assert.EqualValues(t, `{"a":1}`, string(body))
+	assert.EqualValues(t, "10.0.0.2", got.Header["X-Forwarded-For"][1])
+
+	runtime.KeepAlive(ac)
+}
+
+func TestReadRequestForms(t *testing.T) {
+	ac := memorypool.NewAlloctorFromPool(0)
+	for _, c := range []struct {
+		raw   string
+		check func(r *Request)
+	}{
+		{"GET http://upstream:8080?x=1 HTTP/1.1\r\nHost: ignored\r\n\r\n", func(r *Request) {
+			assert.EqualValues(t, "upstream:8080", r.Host)
+			assert.EqualValues(t, "/", r.Path)
+			assert.EqualValues(t, "1", r.QueryValue("x"))
+			assert.EqualValues(t, 0, r.ContentLength)
+		}},
+		{"CONNECT example.com:443 HTTP/1.1\r\n\r\n", func(r *Request) {
+			assert.EqualValues(t, "example.com:443", r.Host)
+			assert.EqualValues(t, "", r.Path)
+		}},
+		{"OPTIONS * HTTP/1.0\r\nConnection: keep-alive\r\n\r\n", func(r *Request) {
+			assert.EqualValues(t, "*", r.Path)
+			assert.False(t, r.Close)
+		}},
+		{"GET / HTTP/1.1\r\nHost:\r\nA: x\ty\r\n\r\n", func(r *Request) {
+			assert.EqualValues(t, "", r.Host)
+			assert.EqualValues(t, "x\ty", r.Get("a"))
+		}},
+		{"GET / HTTP/1.0\n\n", func(r *Request) {
+			assert.True(t, r.Close)
+		}},
+		{"POST /up HTTP/1.1\r\nHost: h\r\nTransfer-Encoding: chunked\r\nConnection: Close\r\n\r\n", func(r *Request) {
+			assert.True(t, r.Chunked)
+			assert.True(t, r.Close)
+			assert.EqualValues(t, -1, r.ContentLength)
+		}},
+	} {
+		r, err := ReadRequest(ac, bufio.NewReader(strings.NewReader(c.raw)))
+		assert.Nil(t, err, c.raw)
+		c.check(r)
+		got, err := r.HTTPRequest(nil)
+		assert.Nil(t, err)
+		want, err := http.ReadRequest(bufio.NewReader(strings.NewReader(c.raw)))
+		assert.Nil(t, err)
+		assert.EqualValues(t, want.URL, got.URL, c.raw)
+		assert.EqualValues(t, want.Host, got.Host, c.raw)
+		assert.EqualValues(t, want.Close, got.Close, c.raw)
+		assert.EqualValues(t, want.ContentLength, got.ContentLength, c.raw)
+	}
+	runtime.KeepAlive(ac)
+}
+
+func TestReadRequestErrors(t *testing.T) {
+	ac := memorypool.NewAlloctorFromPool(0)
+	for _, c := range []struct {
+		raw string
+		err error
+	}{
+		{"", io.EOF},
+		{"GET / HTTP/1.1\r\nHost: x\r\n", io.ErrUnexpectedEOF},
+		{"GET / HTTP/1.1", io.ErrUnexpectedEOF},
+		{"GET /\r\n\r\n", ErrMalformedRequest},
+		{"G(T / HTTP/1.1\r\n\r\n", ErrMalformedRequest},
+		{"GET foo HTTP/1.1\r\n\r\n", ErrMalformedRequest},
+		{"GET / HTTP/2.0\r\n\r\n", ErrBadVersion},
+		{"GET / HTTP/1.1\r\nBad Name: x\r\n\r\n", ErrMalformedHeader},
+		{"GET / HTTP/1.1\r\nNoColon\r\n\r\n", ErrMalformedHeader},
+		{"GET / HTTP/1.1\r\nA: x\r\n folded\r\n\r\n", ErrMalformedHeader},
+		{"GET / HTTP/1.1\r\nHost: h\r\nA: x\x00y\r\n\r\n", ErrMalformedHeader},
+		{"GET / HTTP/1.1\r\nHost: h\r\nA: x\ry\r\n\r\n", ErrMalformedHeader},
+		{"GET / HTTP/1.1\r\nHost: h\r\nA: x\x7f\r\n\r\n", ErrMalformedHeader},
+		{"GET / HTTP/1.1\r\n\r\n", ErrMissingHost},
+		{"GET http://h/ HTTP/1.1\r\nA: b\r\n\r\n", ErrMissingHost},
+		{"GET / HTTP/1.1\r\nContent-Length: -1\r\n\r\n", ErrBadContentLength},
+		{"GET / HTTP/1.1\r\nContent-Length: 1\r\nContent-Length: 2\r\n\r\n", ErrBadContentLength},
+		{"POST / HTTP/1.1\r\nHost: h\r\nTransfer-Encoding: gzip, chunked\r\n\r\n", ErrBadTransferEncoding},
+		{"POST / HTTP/1.1\r\nHost: h\r\nTransfer-Encoding: identity\r\n\r\n", ErrBadTransferEncoding},
+		{"POST / HTTP/1.1\r\nHost: h\r\nTransfer-Encoding: chunked\r\nTransfer-Encoding: chunked\r\n\r\n", ErrBadTransferEncoding},
+		{"POST / HTTP/1.1\r\nHost: h\r\nContent-Length: 3\r\nTransfer-Encoding: chunked\r\n\r\n", ErrBadTransferEncoding},
+		{"POST / HTTP/1.1\r\nHost: h\r\nTransfer-Encoding: chunked\r\nContent-Length: 3\r\n\r\n", ErrBadTransferEncoding},
+		{"GET /%zz HTTP/1.1\r\n\r\n", ErrBadEscape},
+		{"GET /?a=%4 HTTP/1.1\r\n\r\n", ErrBadEscape},
+		{"GET / HTTP/1.1\r\nX: " + strings.Repeat("a", 5000) + "\r\n\r\n", ErrLineTooLong},
+	} {
+		_, err := ReadRequest(ac, bufio.NewReader(strings.NewReader(c.raw)))
+		assert.Equal(t, c.err, err, c.raw)
+	}
+	runtime.KeepAlive(ac)
+}
+
+func TestReadRequestNoHeapAlloc(t *testing.T) {
+	ac := memorypool.NewAlloctorFromPool(0)
+	data := []byte(rawRequest)
+	rd := bytes.NewReader(data)
+	br := bufio.NewReader(rd)
+	n := testing.AllocsPerRun(100, func() {
+		rd.Reset(data)
+		br.Reset(rd)
+		if _, err := ReadRequest(ac, br); err != nil {
+			panic(err)
+		}
+	})
+	assert.EqualValues(t, 0, n)
+	runtime.KeepAlive(ac)
+}
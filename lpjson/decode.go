@@ -0,0 +1,702 @@
+// Package lpjson 基于 linearpool 内存池的 JSON 编解码, 规则与 encoding/json 保持一致.
+package lpjson
+
+import (
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	memorypool "github.com/userpro/linearpool"
+)
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	numberType          = reflect.TypeOf(json.Number(""))
+)
+
+// Unmarshal 同 json.Unmarshal, 解码过程中新建的结构体指针, 切片和字符串都从 ac 分配.
+//
+// 内存池不会被 GC 扫描, 因此:
+//   - map 使用堆上的 map, 并通过 ac.KeepAlive 保活;
+//   - interface{} 交给 encoding/json 解码到堆上, 同样通过 ac.KeepAlive 保活;
+//   - 实现了 json.Unmarshaler/encoding.TextUnmarshaler 的类型如果在堆上分配内存,
+//     需要自行保证其存活(json.RawMessage 除外, 它会被拷贝进内存池).
+//
+// 解码结果的生命周期不能超过 ac.
+func Unmarshal(ac *memorypool.Allocator, data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return &json.InvalidUnmarshalError{Type: reflect.TypeOf(v)}
+	}
+
+	// 先整体校验, 语法错误时不修改 v, 并返回与 encoding/json 相同的 *json.SyntaxError
+	if !json.Valid(data) {
+		return syntaxError(data)
+	}
+
+	d := decodeStatePool.Get().(*decodeState)
+	*d = decodeState{scanner: scanner{data: data}, ac: ac, root: rv.Type().Elem()}
+	d.path = d.pathBuf[:0]
+	err := d.value(rv)
+	if err == nil {
+		err = d.savedError
+	}
+	*d = decodeState{}
+	decodeStatePool.Put(d)
+	return err
+}
+
+var decodeStatePool = sync.Pool{New: func() any { return new(decodeState) }}
+
+type decodeState struct {
+	scanner
+	ac *memorypool.Allocator
+
+	// 类型不匹配时记录第一个错误并继续解码, 同 encoding/json
+	savedError error
+	root       reflect.Type
+	path       []pathElem // 当前值在 JSON 中的路径, 只在出错时拼成字符串
+	pathBuf    [8]pathElem
+}
+
+// pathElem 对象成员的 key 或数组下标
+type pathElem struct {
+	key   string
+	index int // 对象成员时为 -1
+}
+
+func (d *decodeState) saveError(err error) {
+	if d.savedError == nil {
+		d.savedError = err
+	}
+}
+
+// typeError 生成 *json.UnmarshalTypeError, Struct/Field 的格式同 encoding/json:
+// Struct 为根类型的名字, Field 为 "." 分隔的 JSON 路径
+func (d *decodeState) typeError(what string, t reflect.Type, off int) {
+	if d.savedError != nil {
+		return
+	}
+	err := &json.UnmarshalTypeError{Value: what, Type: t, Offset: int64(off)}
+	if len(d.path) > 0 {
+		var b strings.Builder
+		for i, p := range d.path {
+			if i > 0 {
+				b.WriteByte('.')
+			}
+			if p.index >= 0 {
+				b.WriteString(strconv.Itoa(p.index))
+			} else {
+				b.WriteString(p.key)
+			}
+		}
+		err.Struct = d.root.Name()
+		err.Field = b.String()
+	}
+	d.savedError = err
+}
+
+// syntaxError 返回 data 中的语法错误, 与 encoding/json 相同
+func syntaxError(data []byte) error {
+	var discard struct{}
+	return json.Unmarshal(data, &discard)
+}
+
+// unquote 把带引号的 JSON 字符串解码到内存池
+func unquote(ac *memorypool.Allocator, item []byte, escaped bool) string {
+	if !escaped {
+		return ac.NewString(memorypool.BytesToString(item[1 : len(item)-1]))
+	}
+	s, _ := ac.UnquoteJSON(memorypool.BytesToString(item))
+	return s
+}
+
+//============================================================================
+// 解码
+//============================================================================
+
+func (d *decodeState) value(v reflect.Value) error {
+	d.skipWS()
+	if !v.IsValid() {
+		d.skipValue()
+		return nil
+	}
+	switch d.data[d.off] {
+	case '{':
+		return d.object(v)
+	case '[':
+		return d.array(v)
+	default:
+		start := d.off
+		escaped := false
+		if d.data[start] == '"' {
+			escaped = d.scanString()
+		} else {
+			d.scanLiteral()
+		}
+		return d.literalStore(d.data[start:d.off], escaped, v, false)
+	}
+}
+
+// indirect 沿指针向下找到可以赋值的值, 遇到 nil 指针时从内存池分配.
+// 如果途中某一层实现了 json.Unmarshaler/encoding.TextUnmarshaler 则直接返回.
+// decodingNull 为 true 时停在最后一个可以置 nil 的指针上.
+func (d *decodeState) indirect(v reflect.Value, decodingNull bool) (json.Unmarshaler, encoding.TextUnmarshaler, reflect.Value) {
+	v0 := v
+	haveAddr := false
+
+	// 命名类型的方法可能定义在指针上, 先取地址
+	if v.Kind() != reflect.Pointer && v.Type().Name() != "" && v.CanAddr() {
+		haveAddr = true
+		v = v.Addr()
+	}
+	for {
+		// interface 中已经存有非 nil 指针时, 解码到指针指向的对象
+		if v.Kind() == reflect.Interface && !v.IsNil() {
+			e := v.Elem()
+			if e.Kind() == reflect.Pointer && !e.IsNil() && (!decodingNull || e.Elem().Kind() == reflect.Pointer) {
+				haveAddr = false
+				v = e
+				continue
+			}
+		}
+
+		if v.Kind() != reflect.Pointer {
+			break
+		}
+		if decodingNull && v.CanSet() {
+			break
+		}
+		// 指向自身的 interface, 例如 var v any; v = &v
+		if v.Elem().Kind() == reflect.Interface && v.Elem().Elem().Equal(v) {
+			v = v.Elem()
+			break
+		}
+		if v.IsNil() {
+			v.Set(d.ac.NewValue(v.Type().Elem()))
+		}
+		if v.Type().NumMethod() > 0 && v.CanInterface() {
+			if u, ok := v.Interface().(json.Unmarshaler); ok {
+				return u, nil, reflect.Value{}
+			}
+			if !decodingNull {
+				if u, ok := v.Interface().(encoding.TextUnmarshaler); ok {
+					return nil, u, reflect.Value{}
+				}
+			}
+		}
+
+		if haveAddr {
+			v = v0
+			haveAddr = false
+		} else {
+			v = v.Elem()
+		}
+	}
+	return nil, nil, v
+}
+
+// callUnmarshaler json.RawMessage 直接拷贝进内存池, 其余交给类型自身
+func (d *decodeState) callUnmarshaler(u json.Unmarshaler, item []byte) error {
+	if m, ok := u.(*json.RawMessage); ok {
+		*m = memorypool.StringToBytes(d.ac.NewString(memorypool.BytesToString(item)))
+		return nil
+	}
+	return u.UnmarshalJSON(item)
+}
+
+// setInterface 把堆上的 x 存入 interface 类型的 v, 并保证 x 在内存池存活期间不被回收
+func (d *decodeState) setInterface(v reflect.Value, x any) {
+	p := new(any)
+	*p = x
+	d.ac.KeepAlive(p)
+	v.Set(reflect.ValueOf(x))
+}
+
+// valueInterface 解码到 interface{}, 结果与 encoding/json 相同且位于堆上
+func (d *decodeState) valueInterface(v reflect.Value) error {
+	start := d.off
+	d.skipValue()
+	var x any
+	if err := json.Unmarshal(d.data[start:d.off], &x); err != nil {
+		return err
+	}
+	if x == nil {
+		v.SetZero()
+		return nil
+	}
+	d.setInterface(v, x)
+	return nil
+}
+
+func (d *decodeState) object(v reflect.Value) error {
+	u, ut, pv := d.indirect(v, false)
+	if u != nil {
+		start := d.off
+		d.skipValue()
+		return d.callUnmarshaler(u, d.data[start:d.off])
+	}
+	if ut != nil {
+		d.typeError("object", v.Type(), d.off)
+		d.skipValue()
+		return nil
+	}
+	v = pv
+	t := v.Type()
+
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		return d.valueInterface(v)
+	}
+
+	var fields *structFields
+	switch v.Kind() {
+	case reflect.Map:
+		switch t.Key().Kind() {
+		case reflect.String,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		default:
+			if !reflect.PointerTo(t.Key()).Implements(textUnmarshalerType) {
+				d.typeError("object", t, d.off)
+				d.skipValue()
+				return nil
+			}
+		}
+		if v.IsNil() {
+			m := reflect.MakeMap(t)
+			v.Set(m)
+			d.ac.KeepAlive(m.Interface())
+		}
+	case reflect.Struct:
+		fields = cachedTypeFields(t)
+	default:
+		d.typeError("object", t, d.off)
+		d.skipValue()
+		return nil
+	}
+
+	var mapElem reflect.Value
+
+	d.off++ // '{'
+	for {
+		d.skipWS()
+		if d.data[d.off] == '}' {
+			d.off++
+			break
+		}
+
+		start := d.off
+		escaped := d.scanString()
+		item := d.data[start:d.off]
+		var key string
+		if escaped {
+			key = unquote(d.ac, item, true)
+		} else {
+			key = memorypool.BytesToString(item[1 : len(item)-1]) // 只用于查找, 需要保存时再拷贝
+		}
+		d.skipWS()
+		d.off++ // ':'
+		d.path = append(d.path, pathElem{key: key, index: -1})
+
+		var subv reflect.Value
+		quoted := false
+		if v.Kind() == reflect.Map {
+			// 复用同一个元素暂存解码结果, SetMapIndex 时拷贝进 map
+			if !mapElem.IsValid() {
+				mapElem = d.ac.NewValue(t.Elem()).Elem()
+			} else {
+				mapElem.SetZero()
+			}
+			subv = mapElem
+		} else if f := fields.lookup(key); f != nil {
+			subv = v
+			quoted = f.quoted
+			for _, i := range f.index {
+				if subv.Kind() == reflect.Pointer {
+					if subv.IsNil() {
+						// 未导出的嵌入结构体指针无法赋值, 跳过这个值
+						if !subv.CanSet() {
+							d.saveError(fmt.Errorf("json: cannot set embedded pointer to unexported struct: %v", subv.Type().Elem()))
+							subv = reflect.Value{}
+							quoted = false
+							break
+						}
+						subv.Set(d.ac.NewValue(subv.Type().Elem()))
+					}
+					subv = subv.Elem()
+				}
+				subv = subv.Field(i)
+			}
+		}
+
+		if quoted {
+			if err := d.quotedValue(subv); err != nil {
+				return err
+			}
+		} else if err := d.value(subv); err != nil {
+			return err
+		}
+
+		if v.Kind() == reflect.Map {
+			if kv := d.mapKey(t.Key(), item, key, escaped, start); kv.IsValid() {
+				v.SetMapIndex(kv, subv)
+			}
+		}
+
+		d.path = d.path[:len(d.path)-1]
+
+		d.skipWS()
+		if d.data[d.off] == '}' {
+			d.off++
+			break
+		}
+		d.off++ // ','
+	}
+	return nil
+}
+
+// quotedValue 处理带 ",string" 选项的字段, 值本身是一个 JSON 字符串
+func (d *decodeState) quotedValue(v reflect.Value) error {
+	d.skipWS()
+	start := d.off
+	switch d.data[start] {
+	case 'n':
+		d.scanLiteral()
+		return d.literalStore(d.data[start:d.off], false, v, false)
+	case '"':
+		escaped := d.scanString()
+		inner := d.data[start+1 : d.off-1]
+		if escaped {
+			inner = memorypool.StringToBytes(unquote(d.ac, d.data[start:d.off], true))
+		}
+		// string 类型的字段内层仍是一个带引号的 JSON 字符串
+		if len(inner) > 0 && inner[0] == '"' && !json.Valid(inner) {
+			d.saveError(fmt.Errorf("json: invalid use of ,string struct tag, trying to unmarshal %q into %v", inner, v.Type()))
+			return nil
+		}
+		return d.literalStore(inner, true, v, true)
+	default:
+		d.skipValue()
+		d.saveError(fmt.Errorf("json: invalid use of ,string struct tag, trying to unmarshal unquoted value into %v", v.Type()))
+		return nil
+	}
+}
+
+// mapKey 把 JSON 对象的 key 转换为 map 的 key 类型, 失败时记录错误并返回无效值
+func (d *decodeState) mapKey(kt reflect.Type, item []byte, key string, escaped bool, off int) reflect.Value {
+	if reflect.PointerTo(kt).Implements(textUnmarshalerType) {
+		kv := d.ac.NewValue(kt)
+		if !escaped {
+			key = d.ac.NewString(key)
+		}
+		if err := kv.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(key)); err != nil {
+			d.saveError(err)
+			return reflect.Value{}
+		}
+		return kv.Elem()
+	}
+
+	kv := d.ac.NewValue(kt).Elem()
+	switch kt.Kind() {
+	case reflect.String:
+		if !escaped {
+			key = d.ac.NewString(key)
+		}
+		kv.SetString(key)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(key, 10, 64)
+		if err != nil || kv.OverflowInt(n) {
+			d.typeError("number "+key, kt, off+1)
+			return reflect.Value{}
+		}
+		kv.SetInt(n)
+	default:
+		n, err := strconv.ParseUint(key, 10, 64)
+		if err != nil || kv.OverflowUint(n) {
+			d.typeError("number "+key, kt, off+1)
+			return reflect.Value{}
+		}
+		kv.SetUint(n)
+	}
+	return kv
+}
+
+func (d *decodeState) array(v reflect.Value) error {
+	u, ut, pv := d.indirect(v, false)
+	if u != nil {
+		start := d.off
+		d.skipValue()
+		return d.callUnmarshaler(u, d.data[start:d.off])
+	}
+	if ut != nil {
+		d.typeError("array", v.Type(), d.off)
+		d.skipValue()
+		return nil
+	}
+	v = pv
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.NumMethod() == 0 {
+			return d.valueInterface(v)
+		}
+		d.typeError("array", v.Type(), d.off)
+		d.skipValue()
+		return nil
+	case reflect.Array, reflect.Slice:
+	default:
+		d.typeError("array", v.Type(), d.off)
+		d.skipValue()
+		return nil
+	}
+
+	i := 0
+	d.off++ // '['
+	for {
+		d.skipWS()
+		if d.data[d.off] == ']' {
+			d.off++
+			break
+		}
+
+		d.path = append(d.path, pathElem{index: i})
+		if v.Kind() == reflect.Slice && i >= v.Len() {
+			// 同 append, 容量不足时按两倍从内存池扩容
+			if c := 2 * v.Cap(); i >= v.Cap() {
+				if c < 4 {
+					c = 4
+				}
+				d.ac.ReallocSlice(v, c)
+			}
+			v.SetLen(i + 1)
+		}
+		if i < v.Len() {
+			if err := d.value(v.Index(i)); err != nil {
+				return err
+			}
+		} else {
+			d.skipValue() // 超出数组长度的部分丢弃
+		}
+		d.path = d.path[:len(d.path)-1]
+		i++
+
+		d.skipWS()
+		if d.data[d.off] == ']' {
+			d.off++
+			break
+		}
+		d.off++ // ','
+	}
+
+	if i < v.Len() {
+		if v.Kind() == reflect.Array {
+			for ; i < v.Len(); i++ {
+				v.Index(i).SetZero()
+			}
+		} else {
+			v.SetLen(i)
+		}
+	}
+	if i == 0 && v.Kind() == reflect.Slice && v.IsNil() {
+		d.ac.ReallocSlice(v, 0)
+	}
+	return nil
+}
+
+// literalStore 解码字符串/数字/true/false/null, fromQuoted 表示 item 来自 ",string" 字段
+func (d *decodeState) literalStore(item []byte, escaped bool, v reflect.Value, fromQuoted bool) error {
+	if len(item) == 0 {
+		d.saveError(fmt.Errorf("json: invalid use of ,string struct tag, trying to unmarshal %q into %v", item, v.Type()))
+		return nil
+	}
+	isNull := item[0] == 'n'
+	u, ut, pv := d.indirect(v, isNull)
+	if u != nil {
+		return d.callUnmarshaler(u, item)
+	}
+	if ut != nil {
+		if item[0] != '"' {
+			if fromQuoted {
+				d.saveError(fmt.Errorf("json: invalid use of ,string struct tag, trying to unmarshal %q into %v", item, v.Type()))
+				return nil
+			}
+			what := "number"
+			switch item[0] {
+			case 'n':
+				what = "null"
+			case 't', 'f':
+				what = "bool"
+			}
+			d.typeError(what, v.Type(), d.off)
+			return nil
+		}
+		return ut.UnmarshalText([]byte(unquote(d.ac, item, escaped)))
+	}
+	v = pv
+
+	switch c := item[0]; c {
+	case 'n': // null
+		if fromQuoted && string(item) != "null" {
+			d.saveError(fmt.Errorf("json: invalid use of ,string struct tag, trying to unmarshal %q into %v", item, v.Type()))
+			break
+		}
+		switch v.Kind() {
+		case reflect.Interface, reflect.Pointer, reflect.Map, reflect.Slice:
+			v.SetZero()
+		}
+
+	case 't', 'f':
+		value := c == 't'
+		if fromQuoted && string(item) != "true" && string(item) != "false" {
+			d.saveError(fmt.Errorf("json: invalid use of ,string struct tag, trying to unmarshal %q into %v", item, v.Type()))
+			break
+		}
+		switch v.Kind() {
+		case reflect.Bool:
+			v.SetBool(value)
+		case reflect.Interface:
+			if v.NumMethod() == 0 {
+				v.Set(reflect.ValueOf(value)) // bool 装箱不会分配内存
+				break
+			}
+			d.typeError("bool", v.Type(), d.off)
+		default:
+			if fromQuoted {
+				d.saveError(fmt.Errorf("json: invalid use of ,string struct tag, trying to unmarshal %q into %v", item, v.Type()))
+			} else {
+				d.typeError("bool", v.Type(), d.off)
+			}
+		}
+
+	case '"':
+		switch v.Kind() {
+		case reflect.String:
+			s := unquote(d.ac, item, escaped)
+			if v.Type() == numberType && !isValidNumber(s) {
+				return fmt.Errorf("json: invalid number literal, trying to unmarshal %q into Number", item)
+			}
+			v.SetString(s)
+		case reflect.Slice:
+			if v.Type().Elem().Kind() != reflect.Uint8 {
+				d.typeError("string", v.Type(), d.off)
+				break
+			}
+			src := memorypool.BytesToString(item[1 : len(item)-1])
+			if escaped {
+				src, _ = d.ac.UnquoteJSON(memorypool.BytesToString(item))
+			}
+			b, err := d.ac.DecodeBase64(base64.StdEncoding, src)
+			if err != nil {
+				d.saveError(err)
+				break
+			}
+			v.SetBytes(b)
+		case reflect.Interface:
+			if v.NumMethod() == 0 {
+				d.setInterface(v, unquote(d.ac, item, escaped))
+				break
+			}
+			d.typeError("string", v.Type(), d.off)
+		default:
+			d.typeError("string", v.Type(), d.off)
+		}
+
+	default: // number
+		s := memorypool.BytesToString(item)
+		if c != '-' && (c < '0' || c > '9') || fromQuoted && !isValidNumber(s) {
+			return fmt.Errorf("json: invalid use of ,string struct tag, trying to unmarshal %q into %v", item, v.Type())
+		}
+		switch v.Kind() {
+		case reflect.Interface:
+			if v.NumMethod() != 0 {
+				d.typeError("number", v.Type(), d.off)
+				break
+			}
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				d.typeError("number "+s, reflect.TypeOf(0.0), d.off)
+				break
+			}
+			d.setInterface(v, f)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil || v.OverflowInt(n) {
+				d.typeError("number "+s, v.Type(), d.off)
+				break
+			}
+			v.SetInt(n)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			n, err := strconv.ParseUint(s, 10, 64)
+			if err != nil || v.OverflowUint(n) {
+				d.typeError("number "+s, v.Type(), d.off)
+				break
+			}
+			v.SetUint(n)
+		case reflect.Float32, reflect.Float64:
+			n, err := strconv.ParseFloat(s, v.Type().Bits())
+			if err != nil || v.OverflowFloat(n) {
+				d.typeError("number "+s, v.Type(), d.off)
+				break
+			}
+			v.SetFloat(n)
+		default:
+			if v.Kind() == reflect.String && v.Type() == numberType {
+				v.SetString(d.ac.NewString(s))
+				break
+			}
+			if fromQuoted {
+				return fmt.Errorf("json: invalid use of ,string struct tag, trying to unmarshal %q into %v", item, v.Type())
+			}
+			d.typeError("number", v.Type(), d.off)
+		}
+	}
+	return nil
+}
+
+// isValidNumber 判断 s 是否为合法的 JSON 数字
+func isValidNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	if s[0] == '-' {
+		s = s[1:]
+		if s == "" {
+			return false
+		}
+	}
+	switch {
+	case s[0] == '0':
+		s = s[1:]
+	case '1' <= s[0] && s[0] <= '9':
+		s = s[1:]
+		for len(s) > 0 && '0' <= s[0] && s[0] <= '9' {
+			s = s[1:]
+		}
+	default:
+		return false
+	}
+	if len(s) >= 2 && s[0] == '.' && '0' <= s[1] && s[1] <= '9' {
+		s = s[2:]
+		for len(s) > 0 && '0' <= s[0] && s[0] <= '9' {
+			s = s[1:]
+		}
+	}
+	if len(s) >= 2 && (s[0] == 'e' || s[0] == 'E') {
+		s = s[1:]
+		if s[0] == '+' || s[0] == '-' {
+			s = s[1:]
+			if s == "" {
+				return false
+			}
+		}
+		for len(s) > 0 && '0' <= s[0] && s[0] <= '9' {
+			s = s[1:]
+		}
+	}
+	return s == ""
+}
@@ -0,0 +1,201 @@
+package lpjson
+
+import (
+	"encoding/json"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	memorypool "github.com/userpro/linearpool"
+)
+
+type Base struct {
+	ID    int64  `json:"id"`
+	Kind  string `json:"kind,omitempty"`
+	Dummy string `json:"-"`
+}
+
+type Meta struct {
+	Tags []string `json:"tags"`
+}
+
+type item struct {
+	Name  string  `json:"name"`
+	Price float64 `json:"price"`
+	Next  *item   `json:"next,omitempty"`
+}
+
+type upperText string
+
+func (u *upperText) UnmarshalText(b []byte) error {
+	*u = upperText(strings.ToUpper(string(b)))
+	return nil
+}
+
+type document struct {
+	Base
+	*Meta
+	Title   string            `json:"title"`
+	Count   uint16            `json:"count,string"`
+	Ratio   float32           `json:"ratio"`
+	OK      bool              `json:"ok"`
+	Items   []item            `json:"items"`
+	Ptrs    []*item           `json:"ptrs"`
+	Fixed   [3]int            `json:"fixed"`
+	Empty   []int             `json:"empty"`
+	Null    []int             `json:"null"`
+	Attrs   map[string]int    `json:"attrs"`
+	ByID    map[int]item      `json:"by_id"`
+	Any     any               `json:"any"`
+	AnyStr  any               `json:"any_str"`
+	Raw     json.RawMessage   `json:"raw"`
+	Data    []byte            `json:"data"`
+	Num     json.Number       `json:"num"`
+	IP      net.IP            `json:"ip"`
+	Upper   upperText         `json:"upper"`
+	Escaped string            `json:"escaped"`
+	Nested  map[string][]item `json:"nested"`
+}
+
+const documentJSON = `{
+	"id": 42, "kind": "doc", "Dummy": "ignored",
+	"tags": ["a", "bé"],
+	"TITLE": "hello \"world\"",
+	"count": "65535",
+	"ratio": 0.5, "ok": true,
+	"items": [{"name": "x", "price": 1.5, "next": {"name": "y", "price": 2}}, {"name": "z"}],
+	"ptrs": [null, {"name": "p"}],
+	"fixed": [1, 2],
+	"empty": [],
+	"null": null,
+	"attrs": {"a": 1, "b": 2},
+	"by_id": {"1": {"name": "one"}, "-2": {"name": "minus two"}},
+	"any": {"k": [1, "v", null, true]},
+	"any_str": "str",
+	"raw": {"keep": [1, 2, 3]},
+	"data": "aGVsbG8=",
+	"num": 1e10,
+	"ip": "127.0.0.1",
+	"upper": "abc",
+	"escaped": "tab\there 😀 中",
+	"nested": {"n": [{"name": "deep"}]},
+	"unknown": {"a": [1, {"b": null}]}
+}`
+
+func TestUnmarshal(t *testing.T) {
+	ac := memorypool.NewAlloctorFromPool(0)
+	var got document
+	assert.Nil(t, Unmarshal(ac, []byte(documentJSON), &got))
+	runtime.GC()
+	// 触发 GC 后内存池之外的对象如果没有保活就会被复用
+	for i := 0; i < 1000; i++ {
+		_ = strings.Repeat("x", 64)
+	}
+	runtime.GC()
+
+	var want document
+	assert.Nil(t, json.Unmarshal([]byte(documentJSON), &want))
+	assert.EqualValues(t, want, got)
+	assert.NotNil(t, got.Empty)
+	assert.Nil(t, got.Null)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestUnmarshalInto(t *testing.T) {
+	ac := memorypool.NewAlloctorFromPool(0)
+
+	// 已有的值与 encoding/json 一样合并
+	got := document{Title: "old", Items: []item{{Name: "a", Price: 1}, {Name: "b"}}, Fixed: [3]int{9, 9, 9}}
+	want := got
+	want.Items = append([]item(nil), got.Items...)
+	data := []byte(`{"items": [{"price": 3}], "fixed": [1]}`)
+	assert.Nil(t, Unmarshal(ac, data, &got))
+	assert.Nil(t, json.Unmarshal(data, &want))
+	assert.EqualValues(t, want, got)
+
+	var x any
+	assert.Nil(t, Unmarshal(ac, []byte(`[1, {"a": "b"}]`), &x))
+	runtime.GC()
+	assert.EqualValues(t, []any{1.0, map[string]any{"a": "b"}}, x)
+
+	type quoted struct {
+		S string  `json:"s,string"`
+		B bool    `json:",string"`
+		F float64 `json:"f,string"`
+		P *int    `json:"p,string"`
+	}
+	var q, wantQ quoted
+	data = []byte(`{"s": "\"a\\tb\"", "B": "true", "f": "1.5", "p": "3"}`)
+	assert.Nil(t, Unmarshal(ac, data, &q))
+	assert.Nil(t, json.Unmarshal(data, &wantQ))
+	assert.EqualValues(t, wantQ.S, q.S)
+	assert.EqualValues(t, wantQ.B, q.B)
+	assert.EqualValues(t, wantQ.F, q.F)
+	assert.EqualValues(t, *wantQ.P, *q.P)
+
+	var p *int
+	assert.Nil(t, Unmarshal(ac, []byte(` 7 `), &p))
+	assert.EqualValues(t, 7, *p)
+	assert.Nil(t, Unmarshal(ac, []byte(`null`), &p))
+	assert.Nil(t, p)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	ac := memorypool.NewAlloctorFromPool(0)
+
+	for _, data := range []string{
+		`{"id": "x", "title": 1}`,
+		`{"count": "70000"}`,
+		`{"items": [{"price": "1"}]}`,
+		`{"fixed": {}}`,
+		`{"by_id": {"x": {}}}`,
+	} {
+		var got, want document
+		err := Unmarshal(ac, []byte(data), &got)
+		wantErr := json.Unmarshal([]byte(data), &want)
+		assert.EqualValues(t, wantErr.Error(), err.Error(), data)
+		assert.IsType(t, wantErr, err)
+		// 出错的字段之外仍然正常解码
+		assert.EqualValues(t, want, got)
+	}
+
+	var v document
+	for _, data := range []string{``, `{`, `{"id": 1,}`, `[1] 2`, `"\x"`} {
+		err := Unmarshal(ac, []byte(data), &v)
+		wantErr := json.Unmarshal([]byte(data), &v)
+		assert.EqualValues(t, wantErr, err, data)
+	}
+
+	assert.IsType(t, &json.InvalidUnmarshalError{}, Unmarshal(ac, []byte(`1`), v))
+	assert.IsType(t, &json.InvalidUnmarshalError{}, Unmarshal(ac, []byte(`1`), nil))
+
+	runtime.KeepAlive(ac)
+}
+
+func TestUnmarshalNoHeapAlloc(t *testing.T) {
+	type small struct {
+		Name  string   `json:"name"`
+		Tags  []string `json:"tags"`
+		Items []*item  `json:"items"`
+	}
+	data := []byte(`{"name": "n", "tags": ["a", "b"], "items": [{"name": "x", "price": 1}, {"name": "y"}]}`)
+	ac := memorypool.NewAlloctorFromPool(0)
+	var v small
+	assert.Nil(t, Unmarshal(ac, data, &v)) // 预热字段缓存
+
+	n := testing.AllocsPerRun(100, func() {
+		v = small{}
+		if err := Unmarshal(ac, data, &v); err != nil {
+			panic(err)
+		}
+	})
+	assert.EqualValues(t, 0, n)
+	assert.EqualValues(t, "y", v.Items[1].Name)
+
+	runtime.KeepAlive(ac)
+}
@@ -0,0 +1,485 @@
+package lpjson
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+
+	memorypool "github.com/userpro/linearpool"
+)
+
+var (
+	marshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// startDetectingCyclesAfter 同 encoding/json, 嵌套超过这个深度后开始记录经过的指针/map/切片, 再次遇到时认为存在环
+const startDetectingCyclesAfter = 1000
+
+// Marshal 同 json.Marshal, 输出与 encoding/json 逐字节相同.
+// 编码过程中的临时数据和返回的 []byte 都分配在 ac 中, 生命周期不能超过 ac.
+func Marshal(ac *memorypool.Allocator, v any) ([]byte, error) {
+	e := encodeStatePool.Get().(*encodeState)
+	*e = encodeState{ac: ac, buf: ac.NewBuffer()}
+	err := e.value(reflect.ValueOf(v), false)
+	b := e.buf.Bytes()
+	*e = encodeState{}
+	encodeStatePool.Put(e)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+type encodeState struct {
+	ac    *memorypool.Allocator
+	buf   *memorypool.Buffer
+	depth int
+	seen  *memorypool.Map[ptrKey, struct{}] // 当前路径上的指针/map/切片, 超过 startDetectingCyclesAfter 后才创建
+}
+
+// ptrKey 同 encoding/json 的 ptrSeen: 切片还需要比较长度, 同一个数组的不同前缀不是环
+type ptrKey struct {
+	ptr uintptr
+	len int
+}
+
+var encodeStatePool = sync.Pool{New: func() any { return new(encodeState) }}
+
+// value 编码任意值, quoted 表示来自 ",string" 字段, 需要再包一层引号
+func (e *encodeState) value(v reflect.Value, quoted bool) error {
+	if !v.IsValid() {
+		e.buf.WriteString("null")
+		return nil
+	}
+
+	// 优先级同 encoding/json: 指针上的 Marshaler, Marshaler, 指针上的 TextMarshaler, TextMarshaler
+	t := v.Type()
+	if t.Kind() != reflect.Pointer && v.CanAddr() && reflect.PointerTo(t).Implements(marshalerType) {
+		return e.marshaler(v.Addr())
+	}
+	if t.Implements(marshalerType) {
+		return e.marshaler(v)
+	}
+	if t.Kind() != reflect.Pointer && v.CanAddr() && reflect.PointerTo(t).Implements(textMarshalerType) {
+		return e.textMarshaler(v.Addr())
+	}
+	if t.Implements(textMarshalerType) {
+		return e.textMarshaler(v)
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		b := e.available(7)
+		b = appendQuoteIf(b, quoted)
+		b = strconv.AppendBool(b, v.Bool())
+		e.buf.Write(appendQuoteIf(b, quoted))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		b := e.available(22)
+		b = appendQuoteIf(b, quoted)
+		b = strconv.AppendInt(b, v.Int(), 10)
+		e.buf.Write(appendQuoteIf(b, quoted))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		b := e.available(22)
+		b = appendQuoteIf(b, quoted)
+		b = strconv.AppendUint(b, v.Uint(), 10)
+		e.buf.Write(appendQuoteIf(b, quoted))
+	case reflect.Float32, reflect.Float64:
+		return e.float(v, quoted)
+	case reflect.String:
+		return e.string(v, quoted)
+	case reflect.Struct:
+		return e.structValue(v)
+	case reflect.Map:
+		return e.mapValue(v)
+	case reflect.Slice:
+		if v.IsNil() {
+			e.buf.WriteString("null")
+			return nil
+		}
+		// []byte 编码为 base64, 元素类型自定义了编码的除外
+		if t.Elem().Kind() == reflect.Uint8 {
+			p := reflect.PointerTo(t.Elem())
+			if !p.Implements(marshalerType) && !p.Implements(textMarshalerType) {
+				e.bytes(v.Bytes())
+				return nil
+			}
+		}
+		return e.array(v)
+	case reflect.Array:
+		return e.array(v)
+	case reflect.Pointer:
+		if v.IsNil() {
+			e.buf.WriteString("null")
+			return nil
+		}
+		return e.nested(v, func() error { return e.value(v.Elem(), quoted) })
+	case reflect.Interface:
+		if v.IsNil() {
+			e.buf.WriteString("null")
+			return nil
+		}
+		return e.value(v.Elem(), false)
+	default:
+		return &json.UnsupportedTypeError{Type: t}
+	}
+	return nil
+}
+
+// available 保证至少有 n 字节空闲容量, 返回长度为 0 的空闲部分
+func (e *encodeState) available(n int) []byte {
+	e.buf.Grow(n)
+	return e.buf.AvailableBuffer()
+}
+
+func appendQuoteIf(b []byte, quoted bool) []byte {
+	if quoted {
+		return append(b, '"')
+	}
+	return b
+}
+
+// nested 进入指针/map/切片时计数, 嵌套超过 startDetectingCyclesAfter 后检查当前路径上是否出现过同一个值
+func (e *encodeState) nested(v reflect.Value, f func() error) error {
+	e.depth++
+	defer func() { e.depth-- }()
+	if e.depth <= startDetectingCyclesAfter || v.Kind() == reflect.Array {
+		return f()
+	}
+
+	k := ptrKey{ptr: uintptr(v.UnsafePointer())}
+	if v.Kind() == reflect.Slice {
+		k.len = v.Len()
+	}
+	if e.seen == nil {
+		e.seen = memorypool.NewMap[ptrKey, struct{}](e.ac, 0)
+	}
+	if _, ok := e.seen.Get(k); ok {
+		return &json.UnsupportedValueError{Value: v, Str: fmt.Sprintf("encountered a cycle via %s", v.Type())}
+	}
+	e.seen.Set(k, struct{}{})
+	defer e.seen.Delete(k)
+	return f()
+}
+
+func (e *encodeState) marshaler(v reflect.Value) error {
+	if v.Kind() == reflect.Pointer && v.IsNil() {
+		e.buf.WriteString("null")
+		return nil
+	}
+	m, ok := v.Interface().(json.Marshaler)
+	if !ok { // nil interface
+		e.buf.WriteString("null")
+		return nil
+	}
+	b, err := m.MarshalJSON()
+	if err == nil && !json.Valid(b) {
+		err = json.Compact(new(bytes.Buffer), b) // 生成与 encoding/json 相同的 *json.SyntaxError
+	}
+	if err != nil {
+		return &json.MarshalerError{Type: v.Type(), Err: err}
+	}
+	e.buf.Write(appendCompact(e.available(compactLen(b)), b))
+	return nil
+}
+
+func (e *encodeState) textMarshaler(v reflect.Value) error {
+	if v.Kind() == reflect.Pointer && v.IsNil() {
+		e.buf.WriteString("null")
+		return nil
+	}
+	m, ok := v.Interface().(encoding.TextMarshaler)
+	if !ok {
+		e.buf.WriteString("null")
+		return nil
+	}
+	b, err := m.MarshalText()
+	if err != nil {
+		return &json.MarshalerError{Type: v.Type(), Err: err}
+	}
+	e.quote(memorypool.BytesToString(b))
+	return nil
+}
+
+// quote 写入 JSON 字符串
+func (e *encodeState) quote(s string) {
+	writeQuote(e.buf, s)
+}
+
+func (e *encodeState) float(v reflect.Value, quoted bool) error {
+	f := v.Float()
+	bits := v.Type().Bits()
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return &json.UnsupportedValueError{Value: v, Str: strconv.FormatFloat(f, 'g', -1, bits)}
+	}
+
+	b := e.available(32)
+	b = appendQuoteIf(b, quoted)
+	b = appendFloat(b, f, bits)
+	e.buf.Write(appendQuoteIf(b, quoted))
+	return nil
+}
+
+// appendFloat 按 encoding/json 的规则格式化浮点数, f 不能是 NaN/Inf
+func appendFloat(b []byte, f float64, bits int) []byte {
+	// 同 ES6: 绝对值很大或很小时使用科学计数法
+	abs := math.Abs(f)
+	format := byte('f')
+	if abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	start := len(b)
+	b = strconv.AppendFloat(b, f, format, -1, bits)
+	if format == 'e' {
+		// e-09 => e-9
+		if n := len(b); n-start >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b
+}
+
+func (e *encodeState) string(v reflect.Value, quoted bool) error {
+	s := v.String()
+	if v.Type() == numberType {
+		if s == "" {
+			s = "0"
+		}
+		if !isValidNumber(s) {
+			return fmt.Errorf("json: invalid number literal %q", s)
+		}
+		b := e.available(len(s) + 2)
+		b = appendQuoteIf(b, quoted)
+		b = append(b, s...)
+		e.buf.Write(appendQuoteIf(b, quoted))
+		return nil
+	}
+	if quoted {
+		s = e.ac.QuoteJSON(s)
+	}
+	e.quote(s)
+	return nil
+}
+
+func (e *encodeState) bytes(src []byte) {
+	n := base64.StdEncoding.EncodedLen(len(src))
+	b := e.available(n + 2)
+	b = append(b, '"')
+	base64.StdEncoding.Encode(b[1:1+n], src)
+	b = append(b[:1+n], '"')
+	e.buf.Write(b)
+}
+
+func (e *encodeState) array(v reflect.Value) error {
+	return e.nested(v, func() error {
+		e.buf.WriteByte('[')
+		for i, n := 0, v.Len(); i < n; i++ {
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+			if err := e.value(v.Index(i), false); err != nil {
+				return err
+			}
+		}
+		e.buf.WriteByte(']')
+		return nil
+	})
+}
+
+func (e *encodeState) structValue(v reflect.Value) error {
+	fields := cachedTypeFields(v.Type())
+	e.buf.WriteByte('{')
+	first := true
+next:
+	for i := range fields.list {
+		f := &fields.list[i]
+		fv := v
+		for _, i := range f.index {
+			if fv.Kind() == reflect.Pointer {
+				if fv.IsNil() { // 嵌入的 nil 指针, 其中的字段都不输出
+					continue next
+				}
+				fv = fv.Elem()
+			}
+			fv = fv.Field(i)
+		}
+		if f.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+
+		if !first {
+			e.buf.WriteByte(',')
+		}
+		first = false
+		e.buf.WriteString(f.nameEsc)
+		if err := e.value(fv, f.quoted); err != nil {
+			return err
+		}
+	}
+	e.buf.WriteByte('}')
+	return nil
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+	return false
+}
+
+// mapSorter 按编码后的 key 对 map 元素排序, 分配在内存池中
+type mapSorter struct {
+	keys  []string
+	order []int
+}
+
+func (s *mapSorter) Len() int           { return len(s.order) }
+func (s *mapSorter) Less(i, j int) bool { return s.keys[s.order[i]] < s.keys[s.order[j]] }
+func (s *mapSorter) Swap(i, j int)      { s.order[i], s.order[j] = s.order[j], s.order[i] }
+
+func (e *encodeState) mapValue(v reflect.Value) error {
+	if v.IsNil() {
+		e.buf.WriteString("null")
+		return nil
+	}
+	t := v.Type()
+	kt := t.Key()
+	if kt.Kind() != reflect.String && !kt.Implements(textMarshalerType) {
+		switch kt.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		default:
+			return &json.UnsupportedTypeError{Type: t}
+		}
+	}
+
+	textKey := kt.Kind() != reflect.String && kt.Implements(textMarshalerType)
+	return e.nested(v, func() error {
+		// 元素先拷贝进内存池, 排序后再编码; 其中引用的堆对象仍由 map 持有
+		n := v.Len()
+		keys := e.ac.MakeSlice(reflect.SliceOf(kt), n, n)
+		vals := e.ac.MakeSlice(reflect.SliceOf(t.Elem()), n, n)
+		s := memorypool.New[mapSorter](e.ac)
+		s.keys = memorypool.NewSlice[string](e.ac, n, n)
+		s.order = memorypool.NewSlice[int](e.ac, n, n)
+
+		iter := v.MapRange()
+		for i := 0; iter.Next(); i++ {
+			k := keys.Index(i)
+			k.SetIterKey(iter)
+			vals.Index(i).SetIterValue(iter)
+			ks, err := e.mapKey(k, textKey)
+			if err != nil {
+				return err
+			}
+			s.keys[i] = ks
+			s.order[i] = i
+		}
+		sort.Sort(s)
+
+		e.buf.WriteByte('{')
+		for i, j := range s.order {
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+			e.quote(s.keys[j])
+			e.buf.WriteByte(':')
+			// map 元素不可寻址, 指针方法的 Marshaler 不生效, 同 encoding/json
+			if err := e.value(memorypool.Unaddressable(vals.Index(j)), false); err != nil {
+				return err
+			}
+		}
+		e.buf.WriteByte('}')
+		return nil
+	})
+}
+
+// mapKey map 的 key 转换为 JSON 对象的 key, 规则同 encoding/json
+func (e *encodeState) mapKey(k reflect.Value, textKey bool) (string, error) {
+	if k.Kind() == reflect.String {
+		return k.String(), nil
+	}
+	if textKey {
+		if k.Kind() == reflect.Pointer && k.IsNil() {
+			return "", nil
+		}
+		b, err := k.Interface().(encoding.TextMarshaler).MarshalText()
+		return e.ac.NewString(memorypool.BytesToString(b)), err
+	}
+
+	var tmp [24]byte
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return e.ac.NewString(memorypool.BytesToString(strconv.AppendInt(tmp[:0], k.Int(), 10))), nil
+	default:
+		return e.ac.NewString(memorypool.BytesToString(strconv.AppendUint(tmp[:0], k.Uint(), 10))), nil
+	}
+}
+
+// compactLen appendCompact 输出长度的上限
+func compactLen(src []byte) int {
+	n := len(src)
+	for _, c := range src {
+		switch c {
+		case '<', '>', '&':
+			n += 5
+		case 0xE2:
+			n += 3
+		}
+	}
+	return n
+}
+
+// appendCompact 去掉合法 JSON 中的空白, 并按 encoding/json 的规则转义 HTML 字符
+func appendCompact(dst, src []byte) []byte {
+	const hexDigits = "0123456789abcdef"
+	inString := false
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		if !inString {
+			switch c {
+			case ' ', '\t', '\n', '\r':
+				continue
+			case '"':
+				inString = true
+			}
+			dst = append(dst, c)
+			continue
+		}
+
+		switch {
+		case c == '\\':
+			dst = append(dst, c, src[i+1])
+			i++
+		case c == '"':
+			inString = false
+			dst = append(dst, c)
+		case c == '<' || c == '>' || c == '&':
+			dst = append(dst, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xF])
+		case c == 0xE2 && i+2 < len(src) && src[i+1] == 0x80 && src[i+2]&^1 == 0xA8:
+			// U+2028/U+2029
+			dst = append(dst, '\\', 'u', '2', '0', '2', hexDigits[src[i+2]&0xF])
+			i += 2
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
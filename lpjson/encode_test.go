@@ -0,0 +1,206 @@
+package lpjson
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	memorypool "github.com/userpro/linearpool"
+)
+
+type textKey struct{ a, b int }
+
+func (k textKey) MarshalText() ([]byte, error) {
+	return []byte(string(rune('a'+k.a)) + "-" + string(rune('a'+k.b))), nil
+}
+
+func (k *textKey) UnmarshalText(b []byte) error {
+	if len(b) != 3 {
+		return errors.New("bad key")
+	}
+	k.a, k.b = int(b[0]-'a'), int(b[2]-'a')
+	return nil
+}
+
+type ptrMarshaler struct{ N int }
+
+func (p *ptrMarshaler) MarshalJSON() ([]byte, error) {
+	return []byte(`{ "m" : [ 1, "<&>" ] }`), nil
+}
+
+type badMarshaler struct{}
+
+func (badMarshaler) MarshalJSON() ([]byte, error) {
+	return []byte(`{`), nil
+}
+
+type errMarshaler struct{}
+
+func (errMarshaler) MarshalText() ([]byte, error) {
+	return nil, errors.New("boom")
+}
+
+type encodeDoc struct {
+	Base
+	*Meta
+	Title    string             `json:"title"`
+	Skip     string             `json:"skip,omitempty"`
+	Count    int64              `json:"count,string"`
+	Flag     bool               `json:"flag,string"`
+	Str      string             `json:"str,string"`
+	Floats   []float64          `json:"floats"`
+	F32      float32            `json:"f32"`
+	U8       uint8              `json:"u8"`
+	Bytes    []byte             `json:"bytes"`
+	NilBytes []byte             `json:"nil_bytes"`
+	Array    [2]bool            `json:"array"`
+	Items    []item             `json:"items"`
+	Ptr      *item              `json:"ptr"`
+	NilPtr   *item              `json:"nil_ptr"`
+	Omit     *item              `json:"omit,omitempty"`
+	Map      map[string]int     `json:"map"`
+	IntMap   map[int]string     `json:"int_map"`
+	TextMap  map[textKey]bool   `json:"text_map"`
+	NilMap   map[string]int     `json:"nil_map"`
+	Any      any                `json:"any"`
+	Raw      json.RawMessage    `json:"raw"`
+	Num      json.Number        `json:"num"`
+	Time     time.Time          `json:"time"`
+	IP       net.IP             `json:"ip"`
+	Custom   ptrMarshaler       `json:"custom"`
+	Escape   string             `json:"escape"`
+	Nested   map[string][]*item `json:"nested"`
+	private  int
+}
+
+func newEncodeDoc() *encodeDoc {
+	return &encodeDoc{
+		Base:    Base{ID: 7, Kind: "k"},
+		Meta:    &Meta{Tags: []string{"x", "y"}},
+		Title:   "t",
+		Count:   -12,
+		Flag:    true,
+		Str:     `a"b`,
+		Floats:  []float64{0, 1, -1.5, 1e21, 1e-7, 123456789.125, math.SmallestNonzeroFloat64, math.MaxFloat64},
+		F32:     3.14,
+		U8:      255,
+		Bytes:   []byte("hello world"),
+		Array:   [2]bool{true, false},
+		Items:   []item{{Name: "a", Price: 1}, {Name: "b", Next: &item{Name: "c"}}},
+		Ptr:     &item{Name: "p"},
+		Map:     map[string]int{"z": 1, "a": 2, "<m>": 3},
+		IntMap:  map[int]string{10: "ten", -1: "minus", 2: "two"},
+		TextMap: map[textKey]bool{{1, 2}: true, {0, 3}: false},
+		Any:     map[string]any{"k": []any{1, "v", nil, true, 2.5}},
+		Raw:     json.RawMessage(` [1, 2] `),
+		Num:     "1e10",
+		Time:    time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC),
+		IP:      net.IPv4(127, 0, 0, 1),
+		Escape:  "<script>&  \x01\xff\t中文",
+		Nested:  map[string][]*item{"n": {{Name: "deep"}, nil}},
+		private: 1,
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	ac := memorypool.NewAlloctorFromPool(0)
+	for _, v := range []any{
+		nil, true, 12, -3.5, float32(0.1), "s", []int(nil), []int{}, map[string]int{},
+		[]byte{}, new(int), &ptrMarshaler{}, ptrMarshaler{}, json.RawMessage(nil),
+		newEncodeDoc(), *newEncodeDoc(), []any{newEncodeDoc(), nil}, encodeDoc{},
+		// map 元素不可寻址, 指针方法的 MarshalJSON 不生效
+		map[string]ptrMarshaler{"a": {N: 1}}, map[string]struct{ P ptrMarshaler }{"a": {}},
+	} {
+		want, err := json.Marshal(v)
+		assert.Nil(t, err)
+		got, err := Marshal(ac, v)
+		assert.Nil(t, err)
+		assert.EqualValues(t, string(want), string(got))
+	}
+
+	// 输出可以再被 Unmarshal 解码回来
+	b, _ := Marshal(ac, newEncodeDoc())
+	runtime.GC()
+	var doc, want encodeDoc
+	assert.Nil(t, Unmarshal(ac, b, &doc))
+	assert.Nil(t, json.Unmarshal(b, &want))
+	assert.EqualValues(t, want, doc)
+	assert.EqualValues(t, "deep", doc.Nested["n"][0].Name)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestMarshalErrors(t *testing.T) {
+	ac := memorypool.NewAlloctorFromPool(0)
+	type cycle struct {
+		Next *cycle
+	}
+	c := &cycle{}
+	c.Next = c
+	for _, v := range []any{
+		math.NaN(), math.Inf(-1), make(chan int), badMarshaler{}, []any{errMarshaler{}},
+	} {
+		_, wantErr := json.Marshal(v)
+		_, err := Marshal(ac, v)
+		assert.NotNil(t, err)
+		assert.IsType(t, wantErr, err)
+	}
+	_, err := Marshal(ac, map[[2]int]int{{1, 2}: 3})
+	assert.IsType(t, &json.UnsupportedTypeError{}, err)
+	_, err = Marshal(ac, json.Number("x"))
+	assert.NotNil(t, err)
+	_, err = Marshal(ac, c)
+	assert.IsType(t, &json.UnsupportedValueError{}, err)
+	m := map[string]any{}
+	m["m"] = m
+	_, err = Marshal(ac, m)
+	assert.IsType(t, &json.UnsupportedValueError{}, err)
+	s := []any{nil}
+	s[0] = s
+	_, err = Marshal(ac, s)
+	assert.IsType(t, &json.UnsupportedValueError{}, err)
+
+	// 很深但没有环的值可以正常编码, 同一个指针在不同分支中重复出现也不是环
+	type tree struct {
+		L, R *tree
+	}
+	leaf := &tree{}
+	deep := &tree{L: leaf, R: leaf}
+	for i := 0; i < 5000; i++ {
+		deep = &tree{L: deep}
+	}
+	want, err := json.Marshal(deep)
+	assert.Nil(t, err)
+	b, err := Marshal(ac, deep)
+	assert.Nil(t, err)
+	assert.EqualValues(t, want, b)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestMarshalNoHeapAlloc(t *testing.T) {
+	v := &struct {
+		Name  string         `json:"name"`
+		Tags  []string       `json:"tags"`
+		Items []*item        `json:"items"`
+		Attrs map[string]int `json:"attrs"`
+	}{"n", []string{"a", "b"}, []*item{{Name: "x", Price: 1.5}, nil}, map[string]int{"b": 1, "a": 2}}
+	ac := memorypool.NewAlloctorFromPool(0)
+	_, err := Marshal(ac, v) // 预热字段缓存
+	assert.Nil(t, err)
+
+	var b []byte
+	n := testing.AllocsPerRun(100, func() {
+		b, _ = Marshal(ac, v)
+	})
+	assert.EqualValues(t, 0, n)
+	want, _ := json.Marshal(v)
+	assert.EqualValues(t, string(want), string(b))
+
+	runtime.KeepAlive(ac)
+}
@@ -0,0 +1,76 @@
+package lpjson
+
+import "unicode/utf8"
+
+// scanner 在已经过 json.Valid 校验的输入上定位各个值的边界, 不再处理语法错误
+type scanner struct {
+	data []byte
+	off  int
+}
+
+func (s *scanner) skipWS() {
+	for s.off < len(s.data) {
+		switch s.data[s.off] {
+		case ' ', '\t', '\n', '\r':
+			s.off++
+		default:
+			return
+		}
+	}
+}
+
+// scanString 跳过从 s.off 开始的字符串, escaped 表示其中含有转义或非 ASCII 字符
+func (s *scanner) scanString() (escaped bool) {
+	i := s.off + 1
+	for {
+		switch c := s.data[i]; {
+		case c == '"':
+			s.off = i + 1
+			return escaped
+		case c == '\\':
+			escaped = true
+			i += 2
+		default:
+			if c >= utf8.RuneSelf {
+				escaped = true
+			}
+			i++
+		}
+	}
+}
+
+// scanLiteral 跳过从 s.off 开始的数字/true/false/null
+func (s *scanner) scanLiteral() {
+	for s.off < len(s.data) {
+		switch s.data[s.off] {
+		case ',', '}', ']', ':', ' ', '\t', '\n', '\r':
+			return
+		}
+		s.off++
+	}
+}
+
+// skipValue 跳过一个完整的值
+func (s *scanner) skipValue() {
+	s.skipWS()
+	depth := 0
+	for {
+		switch c := s.data[s.off]; c {
+		case '{', '[':
+			depth++
+			s.off++
+		case '}', ']':
+			depth--
+			s.off++
+		case '"':
+			s.scanString()
+		case ',', ':', ' ', '\t', '\n', '\r':
+			s.off++
+		default:
+			s.scanLiteral()
+		}
+		if depth == 0 {
+			return
+		}
+	}
+}
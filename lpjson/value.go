@@ -0,0 +1,423 @@
+package lpjson
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+
+	memorypool "github.com/userpro/linearpool"
+)
+
+// Kind Value 的类型
+type Kind uint8
+
+const (
+	KindNull Kind = iota
+	KindBool
+	KindNumber
+	KindString
+	KindArray
+	KindObject
+)
+
+var kindNames = [...]string{"null", "bool", "number", "string", "array", "object"}
+
+func (k Kind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return "Kind(" + strconv.Itoa(int(k)) + ")"
+}
+
+var errNotNumber = errors.New("lpjson: value is not a number")
+
+// Value 不需要预先定义结构体的 JSON 文档树. 节点, 数组和对象的成员列表都分配在内存池中,
+// 生命周期不能超过创建它的 Allocator.
+// 查找不到时返回 nil, nil 上的只读方法都返回零值, 因此可以连续调用.
+type Value struct {
+	ac   *memorypool.Allocator
+	kind Kind
+	b    bool
+	s    string // 字符串的内容, 或数字的原始文本
+	arr  []*Value
+	obj  []Member
+}
+
+// Member 对象的一个成员, 保持原始顺序
+type Member struct {
+	Key   string
+	Value *Value
+}
+
+func newValue(ac *memorypool.Allocator, kind Kind) *Value {
+	v := memorypool.New[Value](ac)
+	v.ac = ac
+	v.kind = kind
+	return v
+}
+
+// NewNull 新建 null
+func NewNull(ac *memorypool.Allocator) *Value {
+	return newValue(ac, KindNull)
+}
+
+// NewBool 新建 true/false
+func NewBool(ac *memorypool.Allocator, b bool) *Value {
+	v := newValue(ac, KindBool)
+	v.b = b
+	return v
+}
+
+// NewString 新建字符串, s 会拷贝进内存池
+func NewString(ac *memorypool.Allocator, s string) *Value {
+	v := newValue(ac, KindString)
+	v.s = ac.NewString(s)
+	return v
+}
+
+// NewInt64 新建整数
+func NewInt64(ac *memorypool.Allocator, i int64) *Value {
+	var tmp [24]byte
+	v := newValue(ac, KindNumber)
+	v.s = ac.NewString(memorypool.BytesToString(strconv.AppendInt(tmp[:0], i, 10)))
+	return v
+}
+
+// NewFloat64 新建浮点数, 格式同 encoding/json. f 为 NaN/Inf 时 panic
+func NewFloat64(ac *memorypool.Allocator, f float64) *Value {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		panic("lpjson: unsupported float value " + strconv.FormatFloat(f, 'g', -1, 64))
+	}
+	var tmp [32]byte
+	v := newValue(ac, KindNumber)
+	v.s = ac.NewString(memorypool.BytesToString(appendFloat(tmp[:0], f, 64)))
+	return v
+}
+
+// NewArray 新建数组, capacity 为预计元素个数
+func NewArray(ac *memorypool.Allocator, capacity int) *Value {
+	v := newValue(ac, KindArray)
+	v.arr = memorypool.NewSlice[*Value](ac, 0, capacity)
+	return v
+}
+
+// NewObject 新建对象, capacity 为预计成员个数
+func NewObject(ac *memorypool.Allocator, capacity int) *Value {
+	v := newValue(ac, KindObject)
+	v.obj = memorypool.NewSlice[Member](ac, 0, capacity)
+	return v
+}
+
+//============================================================================
+// 解析
+//============================================================================
+
+// Parse 把 JSON 解析为 Value, 语法错误时返回与 encoding/json 相同的 *json.SyntaxError
+func Parse(ac *memorypool.Allocator, data []byte) (*Value, error) {
+	if !json.Valid(data) {
+		return nil, syntaxError(data)
+	}
+	p := parser{scanner: scanner{data: data}, ac: ac}
+	return p.value(), nil
+}
+
+type parser struct {
+	scanner
+	ac *memorypool.Allocator
+}
+
+func (p *parser) value() *Value {
+	p.skipWS()
+	start := p.off
+	switch c := p.data[start]; c {
+	case '{':
+		v := NewObject(p.ac, 0)
+		p.off++
+		for {
+			p.skipWS()
+			if p.data[p.off] == '}' {
+				p.off++
+				return v
+			}
+			start := p.off
+			escaped := p.scanString()
+			key := unquote(p.ac, p.data[start:p.off], escaped)
+			p.skipWS()
+			p.off++ // ':'
+			m := Member{Key: key, Value: p.value()}
+			v.obj = memorypool.Append(p.ac, v.obj, m)
+			p.skipWS()
+			if p.data[p.off] == '}' {
+				p.off++
+				return v
+			}
+			p.off++ // ','
+		}
+
+	case '[':
+		v := NewArray(p.ac, 0)
+		p.off++
+		for {
+			p.skipWS()
+			if p.data[p.off] == ']' {
+				p.off++
+				return v
+			}
+			e := p.value()
+			v.arr = memorypool.Append(p.ac, v.arr, e)
+			p.skipWS()
+			if p.data[p.off] == ']' {
+				p.off++
+				return v
+			}
+			p.off++ // ','
+		}
+
+	case '"':
+		escaped := p.scanString()
+		v := newValue(p.ac, KindString)
+		v.s = unquote(p.ac, p.data[start:p.off], escaped)
+		return v
+
+	case 't', 'f':
+		p.scanLiteral()
+		return NewBool(p.ac, c == 't')
+
+	case 'n':
+		p.scanLiteral()
+		return NewNull(p.ac)
+
+	default:
+		p.scanLiteral()
+		v := newValue(p.ac, KindNumber)
+		v.s = p.ac.NewString(memorypool.BytesToString(p.data[start:p.off]))
+		return v
+	}
+}
+
+//============================================================================
+// 读取
+//============================================================================
+
+// Kind 类型, nil 视为 KindNull
+func (v *Value) Kind() Kind {
+	if v == nil {
+		return KindNull
+	}
+	return v.kind
+}
+
+// Bool true/false 的值
+func (v *Value) Bool() bool {
+	return v != nil && v.kind == KindBool && v.b
+}
+
+// Text 字符串的内容, 或数字的原始文本, 其他类型返回 ""
+func (v *Value) Text() string {
+	if v == nil || (v.kind != KindString && v.kind != KindNumber) {
+		return ""
+	}
+	return v.s
+}
+
+// Float64 数字的值
+func (v *Value) Float64() (float64, error) {
+	if v.Kind() != KindNumber {
+		return 0, errNotNumber
+	}
+	return strconv.ParseFloat(v.s, 64)
+}
+
+// Int64 整数的值, 数字带有小数或超出范围时返回错误
+func (v *Value) Int64() (int64, error) {
+	if v.Kind() != KindNumber {
+		return 0, errNotNumber
+	}
+	return strconv.ParseInt(v.s, 10, 64)
+}
+
+// Len 数组的元素个数或对象的成员个数
+func (v *Value) Len() int {
+	switch v.Kind() {
+	case KindArray:
+		return len(v.arr)
+	case KindObject:
+		return len(v.obj)
+	}
+	return 0
+}
+
+// Index 数组的第 i 个元素, 越界时返回 nil
+func (v *Value) Index(i int) *Value {
+	if v.Kind() != KindArray || i < 0 || i >= len(v.arr) {
+		return nil
+	}
+	return v.arr[i]
+}
+
+// Members 对象的成员列表, 与 Value 共享内存
+func (v *Value) Members() []Member {
+	if v.Kind() != KindObject {
+		return nil
+	}
+	return v.obj
+}
+
+// Lookup 对象中 key 对应的值, key 重复时同 encoding/json 取最后一个
+func (v *Value) Lookup(key string) *Value {
+	if i := v.find(key); i >= 0 {
+		return v.obj[i].Value
+	}
+	return nil
+}
+
+func (v *Value) find(key string) int {
+	if v.Kind() != KindObject {
+		return -1
+	}
+	for i := len(v.obj) - 1; i >= 0; i-- {
+		if v.obj[i].Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// Get 按路径查找, 路径中的 string 查找对象成员, int 查找数组元素, 例如 v.Get("a", "b", 0).
+// 找不到时返回 nil
+func (v *Value) Get(path ...any) *Value {
+	for _, p := range path {
+		switch k := p.(type) {
+		case string:
+			v = v.Lookup(k)
+		case int:
+			v = v.Index(k)
+		default:
+			panic("lpjson: path element must be string or int")
+		}
+		if v == nil {
+			return nil
+		}
+	}
+	return v
+}
+
+//============================================================================
+// 修改
+//============================================================================
+
+// Set 设置对象成员, key 已存在时替换, 否则追加到末尾
+func (v *Value) Set(key string, x *Value) {
+	v.mustBe(KindObject)
+	if i := v.find(key); i >= 0 {
+		v.obj[i].Value = x
+		return
+	}
+	v.obj = memorypool.Append(v.ac, v.obj, Member{Key: v.ac.NewString(key), Value: x})
+}
+
+// Delete 删除对象中所有名为 key 的成员, 返回是否存在
+func (v *Value) Delete(key string) bool {
+	if v.Kind() != KindObject {
+		return false
+	}
+	n := 0
+	for _, m := range v.obj {
+		if m.Key != key {
+			v.obj[n] = m
+			n++
+		}
+	}
+	found := n < len(v.obj)
+	for i := n; i < len(v.obj); i++ {
+		v.obj[i] = Member{}
+	}
+	v.obj = v.obj[:n]
+	return found
+}
+
+// Append 向数组末尾追加元素
+func (v *Value) Append(x *Value) {
+	v.mustBe(KindArray)
+	v.arr = memorypool.Append(v.ac, v.arr, x)
+}
+
+// SetIndex 替换数组的第 i 个元素
+func (v *Value) SetIndex(i int, x *Value) {
+	v.mustBe(KindArray)
+	v.arr[i] = x
+}
+
+func (v *Value) mustBe(k Kind) {
+	if v.Kind() != k {
+		panic("lpjson: call on " + v.Kind().String() + " value, want " + k.String())
+	}
+}
+
+//============================================================================
+// 序列化
+//============================================================================
+
+// MarshalJSON 实现 json.Marshaler, 结果分配在内存池中
+func (v *Value) MarshalJSON() ([]byte, error) {
+	if v == nil {
+		return []byte("null"), nil
+	}
+	b := v.ac.NewBuffer()
+	v.encode(b)
+	return b.Bytes(), nil
+}
+
+// String 返回紧凑格式的 JSON, 分配在内存池中
+func (v *Value) String() string {
+	b, _ := v.MarshalJSON()
+	return memorypool.BytesToString(b)
+}
+
+func (v *Value) encode(b *memorypool.Buffer) {
+	if v == nil {
+		b.WriteString("null")
+		return
+	}
+	switch v.kind {
+	case KindNull:
+		b.WriteString("null")
+	case KindBool:
+		if v.b {
+			b.WriteString("true")
+		} else {
+			b.WriteString("false")
+		}
+	case KindNumber:
+		b.WriteString(v.s)
+	case KindString:
+		writeQuote(b, v.s)
+	case KindArray:
+		b.WriteByte('[')
+		for i, x := range v.arr {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			x.encode(b)
+		}
+		b.WriteByte(']')
+	case KindObject:
+		b.WriteByte('{')
+		for i, m := range v.obj {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeQuote(b, m.Key)
+			b.WriteByte(':')
+			m.Value.encode(b)
+		}
+		b.WriteByte('}')
+	}
+}
+
+// writeQuote 写入 JSON 字符串
+func writeQuote(b *memorypool.Buffer, s string) {
+	b.Grow(2 + 6*len(s))
+	b.Write(memorypool.AppendQuoteJSON(b.AvailableBuffer(), s, true))
+}
@@ -0,0 +1,85 @@
+package lpjson
+
+import (
+	"encoding/json"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	memorypool "github.com/userpro/linearpool"
+)
+
+func TestValueParse(t *testing.T) {
+	ac := memorypool.NewAlloctorFromPool(0)
+	v, err := Parse(ac, []byte(documentJSON))
+	assert.Nil(t, err)
+	runtime.GC()
+
+	assert.EqualValues(t, KindObject, v.Kind())
+	assert.EqualValues(t, 42, must(v.Get("id").Int64()))
+	assert.EqualValues(t, "bé", v.Get("tags", 1).Text())
+	assert.EqualValues(t, `hello "world"`, v.Get("TITLE").Text())
+	assert.EqualValues(t, 2.0, must(v.Get("items", 0, "next", "price").Float64()))
+	assert.EqualValues(t, true, v.Get("ok").Bool())
+	assert.EqualValues(t, KindNull, v.Get("ptrs", 0).Kind())
+	assert.EqualValues(t, "1e10", v.Get("num").Text())
+	assert.EqualValues(t, 0, v.Get("empty").Len())
+	assert.EqualValues(t, KindArray, v.Get("empty").Kind())
+	assert.Nil(t, v.Get("items", 5, "name"))
+	assert.Nil(t, v.Get("missing", "x"))
+	assert.EqualValues(t, "", v.Get("missing").Text())
+
+	// 序列化后与 encoding/json 重新编码的结果相同
+	var ref any
+	assert.Nil(t, json.Unmarshal([]byte(documentJSON), &ref))
+	got, err := json.Marshal(v)
+	assert.Nil(t, err)
+	var back any
+	assert.Nil(t, json.Unmarshal(got, &back))
+	assert.EqualValues(t, ref, back)
+
+	_, err = Parse(ac, []byte(`{"a":}`))
+	assert.IsType(t, &json.SyntaxError{}, err)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestValueMutate(t *testing.T) {
+	ac := memorypool.NewAlloctorFromPool(0)
+	v, err := Parse(ac, []byte(`{"a": {"b": [1, 2]}, "c": "x", "c": "y"}`))
+	assert.Nil(t, err)
+	assert.EqualValues(t, "y", v.Get("c").Text())
+
+	v.Get("a", "b").Append(NewFloat64(ac, 1e-7))
+	v.Get("a", "b").SetIndex(0, NewString(ac, "<one>"))
+	v.Get("a").Set("b2", NewBool(ac, false))
+	v.Set("c", NewNull(ac))
+	assert.True(t, v.Delete("c"))
+	assert.False(t, v.Delete("c"))
+
+	arr := NewArray(ac, 0)
+	for i := 0; i < 100; i++ {
+		arr.Append(NewInt64(ac, int64(i)))
+	}
+	obj := NewObject(ac, 0)
+	obj.Set("arr", arr)
+	v.Set("new", obj)
+	runtime.GC()
+
+	assert.True(t, strings.HasPrefix(v.String(), `{"a":{"b":["\u003cone\u003e",2,1e-7],"b2":false},"new":{"arr":[0,1,2,`))
+	assert.EqualValues(t, 99, must(v.Get("new", "arr", 99).Int64()))
+	assert.EqualValues(t, 100, v.Get("new", "arr").Len())
+	assert.EqualValues(t, 2, len(v.Members()))
+
+	assert.Panics(t, func() { v.Append(NewNull(ac)) })
+
+	runtime.KeepAlive(ac)
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
@@ -0,0 +1,457 @@
+// Package lplog 在内存池中构建结构化日志记录, 编码为 JSON 或 logfmt 后整行写入 io.Writer.
+//
+// 一条记录的内容 (键值对, 嵌套分组, 格式化后的时间) 都写在请求的 Allocator 中, 不产生堆分配,
+// Allocator Reset 之前日志不会给 GC 带来负担:
+//
+//	enc := lplog.NewEncoder(os.Stderr, lplog.JSON)
+//	enc.Info(ac, "request done").Str("path", path).Group("resp").Int("status", 200).End().Dur("cost", d).Flush()
+package lplog
+
+import (
+	"io"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	memorypool "github.com/userpro/linearpool"
+)
+
+// Format 输出格式
+type Format int
+
+const (
+	JSON   Format = iota // 每行一个 JSON 对象, 分组为嵌套对象
+	Logfmt               // key=value, 分组的 key 以 "分组名." 为前缀
+)
+
+// Level 日志级别
+type Level int
+
+const (
+	LevelDebug Level = iota - 1
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String 输出中使用的级别名
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return "level(" + strconv.Itoa(int(l)) + ")"
+}
+
+// Encoder 把记录编码后写入 w, 可以被多个 goroutine 共用, 每行一次 Write
+type Encoder struct {
+	// Level 低于该级别的记录被丢弃, 对应的 Record 为 nil
+	Level Level
+	// TimeFormat 时间字段的格式, NewEncoder 设置为 time.RFC3339Nano
+	TimeFormat string
+	// Now 记录的时间, NewEncoder 设置为 time.Now, 为 nil 时不输出 time 字段
+	Now func() time.Time
+
+	format Format
+	mu     sync.Mutex
+	w      io.Writer
+}
+
+// NewEncoder 新建 Encoder
+func NewEncoder(w io.Writer, format Format) *Encoder {
+	return &Encoder{
+		TimeFormat: time.RFC3339Nano,
+		Now:        time.Now,
+		format:     format,
+		w:          w,
+	}
+}
+
+// Debug 新建 debug 级别的记录
+func (e *Encoder) Debug(ac *memorypool.Allocator, msg string) *Record {
+	return e.Record(ac, LevelDebug, msg)
+}
+
+// Info 新建 info 级别的记录
+func (e *Encoder) Info(ac *memorypool.Allocator, msg string) *Record {
+	return e.Record(ac, LevelInfo, msg)
+}
+
+// Warn 新建 warn 级别的记录
+func (e *Encoder) Warn(ac *memorypool.Allocator, msg string) *Record {
+	return e.Record(ac, LevelWarn, msg)
+}
+
+// Error 新建 error 级别的记录
+func (e *Encoder) Error(ac *memorypool.Allocator, msg string) *Record {
+	return e.Record(ac, LevelError, msg)
+}
+
+// Record 新建一条记录, 编码的内容从 ac 分配, 依次写入 time, level, msg 字段.
+// level 低于 e.Level 时返回 nil, nil 的 Record 上的方法什么都不做
+func (e *Encoder) Record(ac *memorypool.Allocator, level Level, msg string) *Record {
+	if level < e.Level {
+		return nil
+	}
+	// Record 引用堆上的 Encoder, 放在堆上并通过 recordPool 复用, 不需要在内存池中保活 Encoder
+	r := recordPool.Get().(*Record)
+	*r = Record{ac: ac, enc: e, buf: ac.NewBuffer()}
+
+	if e.format == JSON {
+		r.buf.WriteByte('{')
+	}
+	if e.Now != nil {
+		r.Time("time", e.Now())
+	}
+	r.Str("level", level.String())
+	return r.Str("msg", msg)
+}
+
+// Record 一条正在构建的日志记录, 方法可以链式调用, 最后调用 Flush 输出
+type Record struct {
+	ac     *memorypool.Allocator
+	enc    *Encoder
+	buf    *memorypool.Buffer
+	prefix []byte // logfmt 当前分组的 key 前缀
+	groups []int  // 每层分组开始前 prefix 的长度
+}
+
+var recordPool = sync.Pool{New: func() any { return new(Record) }}
+
+// key 写入分隔符和 key, 之后紧跟着写入值
+func (r *Record) key(k string) {
+	b := r.buf
+	if r.enc.format == JSON {
+		if n := b.Len(); n > 0 && b.Bytes()[n-1] != '{' {
+			b.WriteByte(',')
+		}
+		writeQuote(b, k)
+		b.WriteByte(':')
+		return
+	}
+	if b.Len() > 0 {
+		b.WriteByte(' ')
+	}
+	b.Write(r.prefix)
+	if needQuote(k) {
+		writeQuote(b, k)
+	} else {
+		b.WriteString(k)
+	}
+	b.WriteByte('=')
+}
+
+// available 保证至少有 n 字节空闲容量, 返回长度为 0 的空闲部分
+func (r *Record) available(n int) []byte {
+	r.buf.Grow(n)
+	return r.buf.AvailableBuffer()
+}
+
+// Str 字符串字段
+func (r *Record) Str(key, val string) *Record {
+	if r == nil {
+		return r
+	}
+	r.key(key)
+	if r.enc.format == JSON || needQuote(val) {
+		writeQuote(r.buf, val)
+	} else {
+		r.buf.WriteString(val)
+	}
+	return r
+}
+
+// Bytes 字符串字段, 内容为 val
+func (r *Record) Bytes(key string, val []byte) *Record {
+	return r.Str(key, memorypool.BytesToString(val))
+}
+
+// Int 整数字段
+func (r *Record) Int(key string, val int) *Record {
+	return r.Int64(key, int64(val))
+}
+
+// Int64 整数字段
+func (r *Record) Int64(key string, val int64) *Record {
+	if r == nil {
+		return r
+	}
+	r.key(key)
+	r.buf.Write(strconv.AppendInt(r.available(20), val, 10))
+	return r
+}
+
+// Uint64 无符号整数字段
+func (r *Record) Uint64(key string, val uint64) *Record {
+	if r == nil {
+		return r
+	}
+	r.key(key)
+	r.buf.Write(strconv.AppendUint(r.available(20), val, 10))
+	return r
+}
+
+// Float64 浮点数字段, NaN 和 Inf 在 JSON 中输出为字符串
+func (r *Record) Float64(key string, val float64) *Record {
+	if r == nil {
+		return r
+	}
+	r.key(key)
+	b := r.available(32)
+	quoted := r.enc.format == JSON && (math.IsNaN(val) || math.IsInf(val, 0))
+	if quoted {
+		b = append(b, '"')
+	}
+	b = strconv.AppendFloat(b, val, 'g', -1, 64)
+	if quoted {
+		b = append(b, '"')
+	}
+	r.buf.Write(b)
+	return r
+}
+
+// Bool 布尔字段
+func (r *Record) Bool(key string, val bool) *Record {
+	if r == nil {
+		return r
+	}
+	r.key(key)
+	r.buf.Write(strconv.AppendBool(r.available(5), val))
+	return r
+}
+
+// Time 时间字段, 按 Encoder.TimeFormat 直接格式化进内存池
+func (r *Record) Time(key string, val time.Time) *Record {
+	if r == nil {
+		return r
+	}
+	r.key(key)
+	format := r.enc.TimeFormat
+	b := r.available(len(format) + 32)
+	if r.enc.format == JSON {
+		b = append(b, '"')
+	}
+	start := len(b)
+	b = val.AppendFormat(b, format)
+	s := memorypool.BytesToString(b[start:])
+	switch {
+	case r.enc.format == JSON && jsonPlain(s):
+		b = append(b, '"')
+	case r.enc.format == Logfmt && !needQuote(s):
+	default:
+		// 自定义格式中有需要转义的字符, 拷贝出来再写入
+		writeQuote(r.buf, r.ac.NewString(s))
+		return r
+	}
+	r.buf.Write(b)
+	return r
+}
+
+// Dur 时长字段, 格式同 time.Duration.String
+func (r *Record) Dur(key string, val time.Duration) *Record {
+	if r == nil {
+		return r
+	}
+	r.key(key)
+	b := r.available(34)
+	if r.enc.format == JSON {
+		b = append(b, '"')
+		b = appendDuration(b, val)
+		b = append(b, '"')
+	} else {
+		b = appendDuration(b, val)
+	}
+	r.buf.Write(b)
+	return r
+}
+
+// Err 错误字段, key 为 "error", err 为 nil 时不输出
+func (r *Record) Err(err error) *Record {
+	if r == nil || err == nil {
+		return r
+	}
+	return r.Str("error", err.Error())
+}
+
+// Group 开始一个分组, 之后的字段都属于该分组, 直到对应的 End
+func (r *Record) Group(name string) *Record {
+	if r == nil {
+		return r
+	}
+	r.groups = memorypool.Append(r.ac, r.groups, len(r.prefix))
+	if r.enc.format == JSON {
+		r.key(name)
+		r.buf.WriteByte('{')
+		return r
+	}
+	r.prefix = memorypool.AppendMulti(r.ac, r.prefix, memorypool.StringToBytes(name)...)
+	r.prefix = memorypool.Append(r.ac, r.prefix, '.')
+	return r
+}
+
+// End 结束最近的一个分组
+func (r *Record) End() *Record {
+	if r == nil || len(r.groups) == 0 {
+		return r
+	}
+	n := len(r.groups) - 1
+	r.prefix = r.prefix[:r.groups[n]]
+	r.groups = r.groups[:n]
+	if r.enc.format == JSON {
+		r.buf.WriteByte('}')
+	}
+	return r
+}
+
+// Flush 结束未关闭的分组, 把记录作为一行写入 Encoder 的 io.Writer. r 随后被复用, 之后不能再使用 r
+func (r *Record) Flush() error {
+	if r == nil {
+		return nil
+	}
+	for len(r.groups) > 0 {
+		r.End()
+	}
+	if r.enc.format == JSON {
+		r.buf.WriteByte('}')
+	}
+	r.buf.WriteByte('\n')
+
+	e := r.enc
+	e.mu.Lock()
+	_, err := e.w.Write(r.buf.Bytes())
+	e.mu.Unlock()
+	*r = Record{}
+	recordPool.Put(r)
+	return err
+}
+
+// writeQuote 写入 JSON 字符串, logfmt 中需要引号的值也使用同样的转义
+func writeQuote(b *memorypool.Buffer, s string) {
+	b.Grow(2 + 6*len(s))
+	b.Write(memorypool.AppendQuoteJSON(b.AvailableBuffer(), s, false))
+}
+
+// needQuote logfmt 中的值是否需要加引号: 空字符串, 含空白, 引号, 等号或控制字符
+func needQuote(s string) bool {
+	if s == "" {
+		return true
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c <= ' ' || c == '=' || c == '"' || c == '\\' || c == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonPlain s 是否可以不经转义直接作为 JSON 字符串的内容
+func jsonPlain(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < ' ' || c == '"' || c == '\\' || c >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// appendDuration 同 time.Duration.String, 结果直接追加到 b 而不分配字符串
+func appendDuration(b []byte, d time.Duration) []byte {
+	var buf [32]byte
+	w := len(buf)
+
+	u := uint64(d)
+	neg := d < 0
+	if neg {
+		u = -u
+	}
+	if u < uint64(time.Second) {
+		// 不足一秒时使用更小的单位, 如 1.2ms
+		var prec int
+		w--
+		buf[w] = 's'
+		w--
+		switch {
+		case u == 0:
+			buf[w] = '0'
+			return append(b, buf[w:]...)
+		case u < uint64(time.Microsecond):
+			prec = 0
+			buf[w] = 'n'
+		case u < uint64(time.Millisecond):
+			prec = 3
+			w--
+			copy(buf[w:], "µ")
+		default:
+			prec = 6
+			buf[w] = 'm'
+		}
+		w, u = fmtFrac(buf[:w], u, prec)
+		w = fmtInt(buf[:w], u)
+	} else {
+		w--
+		buf[w] = 's'
+		w, u = fmtFrac(buf[:w], u, 9)
+		w = fmtInt(buf[:w], u%60)
+		u /= 60
+		if u > 0 {
+			w--
+			buf[w] = 'm'
+			w = fmtInt(buf[:w], u%60)
+			u /= 60
+			if u > 0 {
+				w--
+				buf[w] = 'h'
+				w = fmtInt(buf[:w], u)
+			}
+		}
+	}
+	if neg {
+		w--
+		buf[w] = '-'
+	}
+	return append(b, buf[w:]...)
+}
+
+// fmtFrac 把 v/10^prec 的小数部分写到 buf 的末尾, 去掉末尾的 0, 返回写入的起始位置和整数部分
+func fmtFrac(buf []byte, v uint64, prec int) (nw int, nv uint64) {
+	w := len(buf)
+	print := false
+	for i := 0; i < prec; i++ {
+		digit := v % 10
+		print = print || digit != 0
+		if print {
+			w--
+			buf[w] = byte(digit) + '0'
+		}
+		v /= 10
+	}
+	if print {
+		w--
+		buf[w] = '.'
+	}
+	return w, v
+}
+
+// fmtInt 把 v 写到 buf 的末尾, 返回写入的起始位置
+func fmtInt(buf []byte, v uint64) int {
+	w := len(buf)
+	if v == 0 {
+		w--
+		buf[w] = '0'
+	} else {
+		for v > 0 {
+			w--
+			buf[w] = byte(v%10) + '0'
+			v /= 10
+		}
+	}
+	return w
+}
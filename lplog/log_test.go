@@ -0,0 +1,129 @@
+package lplog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	memorypool "github.com/userpro/linearpool"
+	"github.com/userpro/linearpool/internal/race"
+)
+
+var testTime = time.Date(2023, 5, 1, 12, 30, 0, 123000000, time.UTC)
+
+func newTestEncoder(w io.Writer, format Format) *Encoder {
+	e := NewEncoder(w, format)
+	e.Now = func() time.Time { return testTime }
+	return e
+}
+
+func TestJSON(t *testing.T) {
+	ac := memorypool.NewAlloctorFromPool(0)
+	var out bytes.Buffer
+	e := newTestEncoder(&out, JSON)
+
+	r := e.Info(ac, "request \"done\"").
+		Str("path", "/a b").
+		Int("n", -3).
+		Uint64("big", math.MaxUint64).
+		Float64("ratio", 0.25).
+		Float64("nan", math.NaN()).
+		Bool("ok", true).
+		Bytes("raw", []byte("x\ny")).
+		Dur("cost", 1500*time.Microsecond).
+		Err(errors.New("boom")).
+		Err(nil).
+		Group("resp").Int("status", 200).Group("hdr").Str("ct", "json").End().End().
+		Group("empty").End().
+		Group("unclosed").Time("at", testTime.Add(time.Hour))
+	runtime.GC()
+	assert.Nil(t, r.Flush())
+
+	want := `{"time":"2023-05-01T12:30:00.123Z","level":"info","msg":"request \"done\"","path":"/a b","n":-3,` +
+		`"big":18446744073709551615,"ratio":0.25,"nan":"NaN","ok":true,"raw":"x\ny","cost":"1.5ms","error":"boom",` +
+		`"resp":{"status":200,"hdr":{"ct":"json"}},"empty":{},"unclosed":{"at":"2023-05-01T13:30:00.123Z"}}` + "\n"
+	assert.EqualValues(t, want, out.String())
+	assert.True(t, json.Valid(out.Bytes()))
+
+	// 低于 Level 的记录为 nil, 方法都是空操作
+	out.Reset()
+	assert.Nil(t, e.Debug(ac, "hidden").Str("a", "b").Group("g").End().Flush())
+	assert.EqualValues(t, "", out.String())
+	e.Level = LevelDebug
+	e.Now = nil
+	assert.Nil(t, e.Debug(ac, "shown").Flush())
+	assert.EqualValues(t, `{"level":"debug","msg":"shown"}`+"\n", out.String())
+
+	runtime.KeepAlive(ac)
+}
+
+func TestLogfmt(t *testing.T) {
+	ac := memorypool.NewAlloctorFromPool(0)
+	var out bytes.Buffer
+	e := newTestEncoder(&out, Logfmt)
+
+	assert.Nil(t, e.Warn(ac, "slow request").
+		Str("path", "/a").
+		Str("empty", "").
+		Str("q", `a="b"`).
+		Int64("n", 42).
+		Float64("inf", math.Inf(1)).
+		Bool("ok", false).
+		Dur("cost", -90*time.Minute).
+		Group("req").Str("id", "x1").Group("user").Int("id", 7).End().Str("ip", "::1").End().
+		Str("after", "y").
+		Flush())
+	assert.Nil(t, e.Error(ac, "second").Flush())
+
+	want := `time=2023-05-01T12:30:00.123Z level=warn msg="slow request" path=/a empty="" q="a=\"b\"" n=42 inf=+Inf ok=false ` +
+		`cost=-1h30m0s req.id=x1 req.user.id=7 req.ip=::1 after=y` + "\n" +
+		`time=2023-05-01T12:30:00.123Z level=error msg=second` + "\n"
+	assert.EqualValues(t, want, out.String())
+
+	// 格式化后需要引号的时间
+	out.Reset()
+	e.TimeFormat = time.DateTime
+	assert.Nil(t, e.Info(ac, "m").Flush())
+	assert.EqualValues(t, `time="2023-05-01 12:30:00" level=info msg=m`+"\n", out.String())
+
+	runtime.KeepAlive(ac)
+}
+
+func TestAppendDuration(t *testing.T) {
+	for _, d := range []time.Duration{
+		0, 1, 999, time.Microsecond, 1100 * time.Nanosecond, time.Millisecond + 1, time.Second,
+		-time.Second - 5, 90 * time.Minute, 100 * time.Hour, math.MaxInt64, math.MinInt64,
+	} {
+		assert.EqualValues(t, d.String(), string(appendDuration(nil, d)))
+	}
+}
+
+func TestRecordNoHeapAlloc(t *testing.T) {
+	if race.Enabled {
+		t.Skip("sync.Pool drops objects randomly under the race detector")
+	}
+	ac := memorypool.NewAlloctorFromPool(0)
+	err := errors.New("boom")
+	for _, format := range []Format{JSON, Logfmt} {
+		e := newTestEncoder(io.Discard, format)
+		n := testing.AllocsPerRun(100, func() {
+			ac.Reset()
+			e.Info(ac, "request done").
+				Str("path", "/api/items").
+				Int("status", 200).
+				Float64("ratio", 0.5).
+				Group("req").Str("id", "abc").Time("start", testTime).End().
+				Dur("cost", 1234*time.Microsecond).
+				Err(err).
+				Flush()
+		})
+		assert.EqualValues(t, 0, n)
+	}
+	runtime.KeepAlive(ac)
+}
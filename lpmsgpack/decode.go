@@ -0,0 +1,588 @@
+package lpmsgpack
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	memorypool "github.com/userpro/linearpool"
+)
+
+var errTrailingData = errors.New("lpmsgpack: trailing data after top-level value")
+
+// Unmarshal 把 MessagePack 解码到 v (非 nil 指针).
+//
+// 字符串, 切片, 嵌套的结构体指针, 扩展类型和 RawMessage 的内容都从 ac 分配;
+// map 和解码到 interface{} 的值位于堆上并通过 ac.KeepAlive 保活. 解码结果的生命周期不能超过 ac.
+// 解码到 interface{} 时整数为 int64/uint64, map 的 key 都是字符串时为 map[string]any, 否则为 map[any]any.
+func Unmarshal(ac *memorypool.Allocator, data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("lpmsgpack: Unmarshal(non-nil pointer expected, got %T)", v)
+	}
+	d := decoder{ac: ac, data: data}
+	if err := d.value(rv.Elem()); err != nil {
+		return err
+	}
+	if d.off != len(data) {
+		return errTrailingData
+	}
+	return nil
+}
+
+type decoder struct {
+	ac    *memorypool.Allocator
+	data  []byte
+	off   int
+	depth int
+}
+
+// kind 值的类别
+type kind uint8
+
+const (
+	kindNil kind = iota
+	kindBool
+	kindInt
+	kindUint
+	kindFloat32
+	kindFloat64
+	kindStr
+	kindBin
+	kindArray
+	kindMap
+	kindExt
+)
+
+var kindNames = [...]string{"nil", "bool", "int", "uint", "float32", "float64", "str", "bin", "array", "map", "ext"}
+
+func (k kind) String() string {
+	return kindNames[k]
+}
+
+// header 值的头部. str/bin/ext 的内容紧随其后, 长度为 n; array/map 的 n 为元素个数
+type header struct {
+	kind kind
+	b    bool
+	i    int64
+	u    uint64
+	f    float64
+	n    int
+	ext  int8
+}
+
+func (d *decoder) readN(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data)-d.off {
+		return nil, errShortData
+	}
+	b := d.data[d.off : d.off+n]
+	d.off += n
+	return b, nil
+}
+
+// readUint 读取 n 字节大端序的无符号整数
+func (d *decoder) readUint(n int) (uint64, error) {
+	b, err := d.readN(n)
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+func (d *decoder) header() (h header, err error) {
+	if d.off >= len(d.data) {
+		return h, errShortData
+	}
+	c := d.data[d.off]
+	d.off++
+
+	var x uint64
+	switch {
+	case c <= 0x7f:
+		h.kind, h.u = kindUint, uint64(c)
+		return h, nil
+	case c >= codeNegFix:
+		h.kind, h.i = kindInt, int64(int8(c))
+		return h, nil
+	case c&0xf0 == codeFixMap:
+		h.kind, h.n = kindMap, int(c&0x0f)
+		return h, d.checkCount(h.n * 2)
+	case c&0xf0 == codeFixArray:
+		h.kind, h.n = kindArray, int(c&0x0f)
+		return h, d.checkCount(h.n)
+	case c&0xe0 == codeFixStr:
+		h.kind, h.n = kindStr, int(c&0x1f)
+		return h, nil
+	}
+
+	switch c {
+	case codeNil:
+		h.kind = kindNil
+	case codeFalse, codeTrue:
+		h.kind, h.b = kindBool, c == codeTrue
+	case codeUint8, codeUint16, codeUint32, codeUint64:
+		h.kind = kindUint
+		h.u, err = d.readUint(1 << (c - codeUint8))
+	case codeInt8, codeInt16, codeInt32, codeInt64:
+		h.kind = kindInt
+		x, err = d.readUint(1 << (c - codeInt8))
+		switch c {
+		case codeInt8:
+			h.i = int64(int8(x))
+		case codeInt16:
+			h.i = int64(int16(x))
+		case codeInt32:
+			h.i = int64(int32(x))
+		default:
+			h.i = int64(x)
+		}
+	case codeFloat32:
+		h.kind = kindFloat32
+		x, err = d.readUint(4)
+		h.f = float64(math.Float32frombits(uint32(x)))
+	case codeFloat64:
+		h.kind = kindFloat64
+		x, err = d.readUint(8)
+		h.f = math.Float64frombits(x)
+	case codeStr8, codeStr16, codeStr32:
+		h.kind = kindStr
+		x, err = d.readUint(1 << (c - codeStr8))
+		h.n = int(x)
+	case codeBin8, codeBin16, codeBin32:
+		h.kind = kindBin
+		x, err = d.readUint(1 << (c - codeBin8))
+		h.n = int(x)
+	case codeArray16, codeArray32:
+		h.kind = kindArray
+		if x, err = d.readUint(2 << (c - codeArray16)); err == nil {
+			h.n = int(x)
+			err = d.checkCount(h.n)
+		}
+	case codeMap16, codeMap32:
+		h.kind = kindMap
+		if x, err = d.readUint(2 << (c - codeMap16)); err == nil {
+			h.n = int(x)
+			err = d.checkCount(h.n * 2)
+		}
+	case codeFixExt1, codeFixExt2, codeFixExt4, codeFixExt8, codeFixExt16:
+		h.kind, h.n = kindExt, 1<<(c-codeFixExt1)
+		x, err = d.readUint(1)
+		h.ext = int8(x)
+	case codeExt8, codeExt16, codeExt32:
+		h.kind = kindExt
+		if x, err = d.readUint(1 << (c - codeExt8)); err == nil {
+			h.n = int(x)
+			x, err = d.readUint(1)
+			h.ext = int8(x)
+		}
+	default:
+		err = fmt.Errorf("lpmsgpack: invalid code 0x%x at offset %d", c, d.off-1)
+	}
+	return h, err
+}
+
+// checkCount 每个元素至少占 1 字节, 提前拒绝虚报的元素个数, 避免按它分配内存
+func (d *decoder) checkCount(n int) error {
+	if n > len(d.data)-d.off {
+		return errShortData
+	}
+	return nil
+}
+
+// skip 跳过 h 之后的内容
+func (d *decoder) skip(h header) error {
+	switch h.kind {
+	case kindStr, kindBin, kindExt:
+		_, err := d.readN(h.n)
+		return err
+	case kindArray, kindMap:
+		n := h.n
+		if h.kind == kindMap {
+			n *= 2
+		}
+		for i := 0; i < n; i++ {
+			if err := d.skipValue(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *decoder) skipValue() error {
+	if d.depth++; d.depth > maxDepth {
+		return errors.New("lpmsgpack: exceeded max depth")
+	}
+	h, err := d.header()
+	if err == nil {
+		err = d.skip(h)
+	}
+	d.depth--
+	return err
+}
+
+// bytes 把 p 拷贝进内存池
+func (d *decoder) bytes(p []byte) []byte {
+	if len(p) == 0 {
+		return memorypool.EmptySlice[byte]()
+	}
+	s := d.ac.NewString(memorypool.BytesToString(p))
+	return memorypool.StringToBytes(s)
+}
+
+func (d *decoder) typeError(h header, t reflect.Type) error {
+	return fmt.Errorf("lpmsgpack: cannot unmarshal %v into Go value of type %v", h.kind, t)
+}
+
+func (d *decoder) value(v reflect.Value) error {
+	if d.depth++; d.depth > maxDepth {
+		return errors.New("lpmsgpack: exceeded max depth")
+	}
+	defer func() { d.depth-- }()
+
+	if v.Type() == rawMessageType {
+		start := d.off
+		if err := d.skipValue(); err != nil {
+			return err
+		}
+		v.SetBytes(d.bytes(d.data[start:d.off]))
+		return nil
+	}
+
+	h, err := d.header()
+	if err != nil {
+		return err
+	}
+	if h.kind == kindNil {
+		v.SetZero()
+		return nil
+	}
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(d.ac.NewValue(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	t := v.Type()
+	switch {
+	case t == timeType:
+		if h.kind != kindExt || h.ext != extTimestamp {
+			return d.typeError(h, t)
+		}
+		tm, err := d.time(h)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(tm))
+		return nil
+	case v.CanAddr() && reflect.PointerTo(t).Implements(extUnmarshalerType):
+		if h.kind != kindExt {
+			return d.typeError(h, t)
+		}
+		p, err := d.readN(h.n)
+		if err != nil {
+			return err
+		}
+		return v.Addr().Interface().(ExtUnmarshaler).UnmarshalMsgpackExt(d.ac, h.ext, d.bytes(p))
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if t.NumMethod() != 0 {
+			return d.typeError(h, t)
+		}
+		x, err := d.any(h)
+		if err != nil {
+			return err
+		}
+		p := new(any)
+		*p = x
+		d.ac.KeepAlive(p)
+		v.Set(reflect.ValueOf(p).Elem())
+		return nil
+
+	case reflect.Bool:
+		if h.kind != kindBool {
+			return d.typeError(h, t)
+		}
+		v.SetBool(h.b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := h.i
+		switch {
+		case h.kind == kindUint && h.u <= math.MaxInt64:
+			i = int64(h.u)
+		case h.kind != kindInt:
+			return d.typeError(h, t)
+		}
+		if v.OverflowInt(i) {
+			return fmt.Errorf("lpmsgpack: value %d overflows %v", i, t)
+		}
+		v.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := h.u
+		switch {
+		case h.kind == kindInt && h.i >= 0:
+			u = uint64(h.i)
+		case h.kind != kindUint:
+			return d.typeError(h, t)
+		}
+		if v.OverflowUint(u) {
+			return fmt.Errorf("lpmsgpack: value %d overflows %v", u, t)
+		}
+		v.SetUint(u)
+
+	case reflect.Float32, reflect.Float64:
+		switch h.kind {
+		case kindFloat32, kindFloat64:
+			v.SetFloat(h.f)
+		case kindInt:
+			v.SetFloat(float64(h.i))
+		case kindUint:
+			v.SetFloat(float64(h.u))
+		default:
+			return d.typeError(h, t)
+		}
+
+	case reflect.String:
+		if h.kind != kindStr && h.kind != kindBin {
+			return d.typeError(h, t)
+		}
+		p, err := d.readN(h.n)
+		if err != nil {
+			return err
+		}
+		v.SetString(d.ac.NewString(memorypool.BytesToString(p)))
+
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 && (h.kind == kindBin || h.kind == kindStr) {
+			p, err := d.readN(h.n)
+			if err != nil {
+				return err
+			}
+			v.SetBytes(d.bytes(p))
+			return nil
+		}
+		if h.kind != kindArray {
+			return d.typeError(h, t)
+		}
+		v.SetZero()
+		d.ac.ReallocSlice(v, h.n)
+		v.SetLen(h.n)
+		for i := 0; i < h.n; i++ {
+			if err := d.value(v.Index(i)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Array:
+		if h.kind != kindArray {
+			return d.typeError(h, t)
+		}
+		for i := 0; i < h.n; i++ {
+			var err error
+			if i < v.Len() {
+				err = d.value(v.Index(i))
+			} else {
+				err = d.skipValue()
+			}
+			if err != nil {
+				return err
+			}
+		}
+		for i := h.n; i < v.Len(); i++ {
+			v.Index(i).SetZero()
+		}
+
+	case reflect.Map:
+		if h.kind != kindMap {
+			return d.typeError(h, t)
+		}
+		return d.mapValue(v, h)
+
+	case reflect.Struct:
+		if h.kind != kindMap {
+			return d.typeError(h, t)
+		}
+		return d.structValue(v, h)
+
+	default:
+		return d.typeError(h, t)
+	}
+	return nil
+}
+
+// mapValue map 位于堆上, key 和 value 先解码到内存池中的临时变量
+func (d *decoder) mapValue(v reflect.Value, h header) error {
+	t := v.Type()
+	if v.IsNil() {
+		m := reflect.MakeMapWithSize(t, h.n)
+		v.Set(m)
+		d.ac.KeepAlive(m.Interface())
+	}
+	key := d.ac.NewValue(t.Key()).Elem()
+	val := d.ac.NewValue(t.Elem()).Elem()
+	for i := 0; i < h.n; i++ {
+		key.SetZero()
+		val.SetZero()
+		if err := d.value(key); err != nil {
+			return err
+		}
+		if err := d.value(val); err != nil {
+			return err
+		}
+		v.SetMapIndex(key, val)
+	}
+	return nil
+}
+
+func (d *decoder) structValue(v reflect.Value, h header) error {
+	fs := cachedTypeFields(v.Type())
+	for i := 0; i < h.n; i++ {
+		kh, err := d.header()
+		if err != nil {
+			return err
+		}
+		if kh.kind != kindStr {
+			return fmt.Errorf("lpmsgpack: cannot unmarshal %v map key into struct field name", kh.kind)
+		}
+		name, err := d.readN(kh.n)
+		if err != nil {
+			return err
+		}
+		j, ok := fs.byName[string(name)]
+		if !ok {
+			if err := d.skipValue(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := d.value(v.FieldByIndex(fs.list[j].index)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// any 解码到 interface{}, 容器位于堆上, 字符串和 bytes 位于内存池中
+func (d *decoder) any(h header) (any, error) {
+	switch h.kind {
+	case kindNil:
+		return nil, nil
+	case kindBool:
+		return h.b, nil
+	case kindInt:
+		return h.i, nil
+	case kindUint:
+		return h.u, nil
+	case kindFloat32:
+		return float32(h.f), nil
+	case kindFloat64:
+		return h.f, nil
+	case kindStr:
+		p, err := d.readN(h.n)
+		if err != nil {
+			return nil, err
+		}
+		return d.ac.NewString(memorypool.BytesToString(p)), nil
+	case kindBin:
+		p, err := d.readN(h.n)
+		if err != nil {
+			return nil, err
+		}
+		return d.bytes(p), nil
+	case kindExt:
+		if h.ext == extTimestamp {
+			return d.time(h)
+		}
+		p, err := d.readN(h.n)
+		if err != nil {
+			return nil, err
+		}
+		return Ext{Type: h.ext, Data: d.bytes(p)}, nil
+	case kindArray:
+		arr := make([]any, h.n)
+		for i := range arr {
+			x, err := d.anyValue()
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = x
+		}
+		return arr, nil
+	}
+
+	m := make(map[string]any, h.n)
+	var mm map[any]any // 出现非字符串的 key 之后改用 map[any]any
+	for i := 0; i < h.n; i++ {
+		k, err := d.anyValue()
+		if err != nil {
+			return nil, err
+		}
+		x, err := d.anyValue()
+		if err != nil {
+			return nil, err
+		}
+		if s, ok := k.(string); ok && mm == nil {
+			m[s] = x
+			continue
+		}
+		if mm == nil {
+			mm = make(map[any]any, h.n)
+			for s, x := range m {
+				mm[s] = x
+			}
+		}
+		if !reflect.TypeOf(k).Comparable() {
+			return nil, fmt.Errorf("lpmsgpack: unhashable map key of type %T", k)
+		}
+		mm[k] = x
+	}
+	if mm != nil {
+		return mm, nil
+	}
+	return m, nil
+}
+
+func (d *decoder) anyValue() (any, error) {
+	if d.depth++; d.depth > maxDepth {
+		return nil, errors.New("lpmsgpack: exceeded max depth")
+	}
+	defer func() { d.depth-- }()
+	h, err := d.header()
+	if err != nil {
+		return nil, err
+	}
+	return d.any(h)
+}
+
+// time 解码 timestamp 扩展类型的内容
+func (d *decoder) time(h header) (time.Time, error) {
+	p, err := d.readN(h.n)
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch h.n {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(p)), 0), nil
+	case 8:
+		x := binary.BigEndian.Uint64(p)
+		return time.Unix(int64(x&(1<<34-1)), int64(x>>34)), nil
+	case 12:
+		return time.Unix(int64(binary.BigEndian.Uint64(p[4:])), int64(binary.BigEndian.Uint32(p))), nil
+	}
+	return time.Time{}, fmt.Errorf("lpmsgpack: invalid timestamp length %d", h.n)
+}
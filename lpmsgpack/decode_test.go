@@ -0,0 +1,118 @@
+package lpmsgpack
+
+import (
+	"math"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	memorypool "github.com/userpro/linearpool"
+)
+
+func TestUnmarshal(t *testing.T) {
+	ac := memorypool.NewAlloctorFromPool(0)
+	want := newRecord()
+	b, err := Marshal(ac, want)
+	assert.Nil(t, err)
+
+	got := &record{Name: "stale", Skip: "keep"}
+	assert.Nil(t, Unmarshal(ac, b, got))
+	runtime.GC()
+
+	// 时间解码为本地时区, 非负整数解码到 interface{} 时为 uint64, nil 的 RawMessage 保存为 nil 值的编码
+	assert.True(t, got.At.Equal(want.At))
+	assert.True(t, got.AtPtr.Equal(*want.AtPtr))
+	assert.EqualValues(t, 123, got.AtPtr.Nanosecond())
+	assert.True(t, got.Next.At.Equal(want.Next.At))
+	got.At, got.AtPtr, got.Next.At = want.At, want.AtPtr, want.Next.At
+	want.Skip = "keep"
+	want.Any.(map[string]any)["k"].([]any)[0] = uint64(1)
+	want.Next.Ext.Data = []byte{}
+	want.Next.Raw = RawMessage{0xc0}
+	assert.EqualValues(t, want, got)
+
+	// RawMessage 可以延迟解码
+	var raw []any
+	assert.Nil(t, Unmarshal(ac, got.Raw, &raw))
+	assert.EqualValues(t, []any{uint64(1), "x"}, raw)
+
+	// 解码到 interface{}
+	var v any
+	assert.Nil(t, Unmarshal(ac, b, &v))
+	runtime.GC()
+	m := v.(map[string]any)
+	assert.EqualValues(t, int64(-1<<40), m["id"])
+	assert.EqualValues(t, uint64(math.MaxUint64), m["big"])
+	assert.EqualValues(t, float32(0.5), m["ratio"])
+	assert.EqualValues(t, []byte{1, 2, 3}, m["data"])
+	assert.EqualValues(t, []any{"a", "", "c"}, m["tags"])
+	assert.EqualValues(t, Ext{Type: 42, Data: []byte("xyz")}, m["ext"])
+	assert.EqualValues(t, Ext{Type: 1, Data: []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 2}}, m["pt"])
+	assert.True(t, m["at"].(time.Time).Equal(want.At))
+	assert.EqualValues(t, map[any]any{uint64(1): map[string]any{"id": uint64(1)}, uint64(2): nil}, m["by_id"])
+
+	runtime.KeepAlive(ac)
+}
+
+func TestUnmarshalConvert(t *testing.T) {
+	ac := memorypool.NewAlloctorFromPool(0)
+
+	var f float64
+	assert.Nil(t, Unmarshal(ac, []byte{0xd0, 0xdf}, &f))
+	assert.EqualValues(t, -33, f)
+	var u uint8
+	assert.Nil(t, Unmarshal(ac, []byte{0xcc, 0xff}, &u))
+	assert.EqualValues(t, 255, u)
+	var s string
+	assert.Nil(t, Unmarshal(ac, []byte{0xc4, 0x01, 'b'}, &s))
+	assert.EqualValues(t, "b", s)
+	var bs []byte
+	assert.Nil(t, Unmarshal(ac, []byte{0xa0}, &bs))
+	assert.NotNil(t, bs)
+	var arr [2]int
+	assert.Nil(t, Unmarshal(ac, []byte{0x93, 0x01, 0x02, 0x03}, &arr))
+	assert.EqualValues(t, [2]int{1, 2}, arr)
+	p := &f
+	assert.Nil(t, Unmarshal(ac, []byte{0xc0}, &p))
+	assert.Nil(t, p)
+
+	// 未知字段跳过
+	var base Base
+	assert.Nil(t, Unmarshal(ac, []byte{0x82, 0xa1, 'x', 0x92, 0x80, 0xc0, 0xa2, 'i', 'd', 0x05}, &base))
+	assert.EqualValues(t, Base{ID: 5}, base)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	ac := memorypool.NewAlloctorFromPool(0)
+	var i8 int8
+	var u uint
+	var s string
+	var base Base
+	var st fmtStringer
+	for _, c := range []struct {
+		b []byte
+		v any
+	}{
+		{[]byte{0xcc, 0xff}, &i8},
+		{[]byte{0xff}, &u},
+		{[]byte{0xc3}, &s},
+		{[]byte{0xa1}, &s},
+		{[]byte{0xdd, 0xff, 0xff, 0xff, 0xff}, &s},
+		{[]byte{0x92, 0x01}, &base},
+		{[]byte{0x81, 0x01, 0x02}, &base},
+		{[]byte{0xc1}, &s},
+		{[]byte{0x01, 0x02}, &u},
+		{[]byte{0xd6, 0x01, 0, 0, 0, 0}, &base},
+		{[]byte{0x01}, &st},
+		{nil, &u},
+	} {
+		assert.NotNil(t, Unmarshal(ac, c.b, c.v), "%x", c.b)
+	}
+	assert.NotNil(t, Unmarshal(ac, []byte{0x01}, u))
+	runtime.KeepAlive(ac)
+}
+
+type fmtStringer interface{ String() string }
@@ -0,0 +1,307 @@
+package lpmsgpack
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	memorypool "github.com/userpro/linearpool"
+)
+
+// maxDepth 嵌套超过这个深度时认为存在环
+const maxDepth = 10000
+
+// Marshal 把 v 编码为 MessagePack, 返回的 []byte 分配在 ac 中, 生命周期不能超过 ac.
+// 整数使用能容纳其值的最短格式, map 的输出顺序不固定
+func Marshal(ac *memorypool.Allocator, v any) ([]byte, error) {
+	e := encoder{ac: ac, buf: ac.NewBuffer()}
+	if err := e.value(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return e.buf.Bytes(), nil
+}
+
+type encoder struct {
+	ac    *memorypool.Allocator
+	buf   *memorypool.Buffer
+	depth int
+}
+
+func (e *encoder) value(v reflect.Value) error {
+	if !v.IsValid() {
+		return e.buf.WriteByte(codeNil)
+	}
+
+	t := v.Type()
+	switch {
+	case t == rawMessageType:
+		if v.IsNil() {
+			return e.buf.WriteByte(codeNil)
+		}
+		_, err := e.buf.Write(v.Bytes())
+		return err
+	case t == timeType:
+		return e.time(v.Interface().(time.Time))
+	case t.Kind() != reflect.Pointer && v.CanAddr() && reflect.PointerTo(t).Implements(extMarshalerType):
+		return e.ext(v.Addr().Interface().(ExtMarshaler))
+	case t.Implements(extMarshalerType):
+		if t.Kind() == reflect.Pointer && v.IsNil() {
+			return e.buf.WriteByte(codeNil)
+		}
+		return e.ext(v.Interface().(ExtMarshaler))
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return e.buf.WriteByte(codeTrue)
+		}
+		return e.buf.WriteByte(codeFalse)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.int(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.uint(v.Uint())
+	case reflect.Float32:
+		e.write(codeFloat32, uint64(math.Float32bits(float32(v.Float()))), 4)
+	case reflect.Float64:
+		e.write(codeFloat64, math.Float64bits(v.Float()), 8)
+	case reflect.String:
+		e.strHeader(v.Len())
+		e.buf.WriteString(v.String())
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			return e.buf.WriteByte(codeNil)
+		}
+		return e.nested(v.Elem())
+	case reflect.Slice:
+		if v.IsNil() {
+			return e.buf.WriteByte(codeNil)
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			e.binHeader(v.Len())
+			e.buf.Write(v.Bytes())
+			return nil
+		}
+		return e.array(v)
+	case reflect.Array:
+		return e.array(v)
+	case reflect.Map:
+		if v.IsNil() {
+			return e.buf.WriteByte(codeNil)
+		}
+		return e.mapValue(v)
+	case reflect.Struct:
+		return e.structValue(v)
+	default:
+		return fmt.Errorf("lpmsgpack: unsupported type %v", t)
+	}
+	return nil
+}
+
+// nested 进入下一层, 嵌套过深时认为存在环
+func (e *encoder) nested(v reflect.Value) error {
+	if e.depth++; e.depth > maxDepth {
+		return fmt.Errorf("lpmsgpack: encountered a cycle via %v", v.Type())
+	}
+	err := e.value(v)
+	e.depth--
+	return err
+}
+
+func (e *encoder) array(v reflect.Value) error {
+	n := v.Len()
+	e.collHeader(codeFixArray, codeArray16, codeArray32, n)
+	for i := 0; i < n; i++ {
+		if err := e.nested(v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *encoder) mapValue(v reflect.Value) error {
+	e.collHeader(codeFixMap, codeMap16, codeMap32, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		if err := e.nested(iter.Key()); err != nil {
+			return err
+		}
+		if err := e.nested(iter.Value()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *encoder) structValue(v reflect.Value) error {
+	fs := cachedTypeFields(v.Type())
+	n := 0
+	for i := range fs.list {
+		f := &fs.list[i]
+		if !f.omitEmpty || !isEmptyValue(v.FieldByIndex(f.index)) {
+			n++
+		}
+	}
+
+	e.collHeader(codeFixMap, codeMap16, codeMap32, n)
+	for i := range fs.list {
+		f := &fs.list[i]
+		fv := v.FieldByIndex(f.index)
+		if f.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		e.strHeader(len(f.name))
+		e.buf.WriteString(f.name)
+		if err := e.nested(fv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *encoder) ext(m ExtMarshaler) error {
+	typ, data, err := m.MarshalMsgpackExt(e.ac)
+	if err != nil {
+		return err
+	}
+	e.extHeader(typ, len(data))
+	e.buf.Write(data)
+	return nil
+}
+
+// time timestamp 扩展类型, 按规范选择 32/64/96 位格式
+func (e *encoder) time(t time.Time) error {
+	sec, nsec := uint64(t.Unix()), uint64(t.Nanosecond())
+	switch {
+	case sec>>34 != 0:
+		e.extHeader(extTimestamp, 12)
+		e.buf.Grow(12)
+		b := binary.BigEndian.AppendUint32(e.buf.AvailableBuffer(), uint32(nsec))
+		e.buf.Write(binary.BigEndian.AppendUint64(b, sec))
+	case nsec != 0 || sec>>32 != 0:
+		e.extHeader(extTimestamp, 8)
+		e.buf.Grow(8)
+		e.buf.Write(binary.BigEndian.AppendUint64(e.buf.AvailableBuffer(), nsec<<34|sec))
+	default:
+		e.extHeader(extTimestamp, 4)
+		e.buf.Grow(4)
+		e.buf.Write(binary.BigEndian.AppendUint32(e.buf.AvailableBuffer(), uint32(sec)))
+	}
+	return nil
+}
+
+//============================================================================
+// 格式
+//============================================================================
+
+// write 写入类型码和 n 字节大端序的 x
+func (e *encoder) write(code byte, x uint64, n int) {
+	e.buf.Grow(1 + n)
+	b := append(e.buf.AvailableBuffer(), code)
+	switch n {
+	case 1:
+		b = append(b, byte(x))
+	case 2:
+		b = binary.BigEndian.AppendUint16(b, uint16(x))
+	case 4:
+		b = binary.BigEndian.AppendUint32(b, uint32(x))
+	case 8:
+		b = binary.BigEndian.AppendUint64(b, x)
+	}
+	e.buf.Write(b)
+}
+
+func (e *encoder) int(i int64) {
+	switch {
+	case i >= 0:
+		e.uint(uint64(i))
+	case i >= -32:
+		e.buf.WriteByte(byte(i))
+	case i >= math.MinInt8:
+		e.write(codeInt8, uint64(i), 1)
+	case i >= math.MinInt16:
+		e.write(codeInt16, uint64(i), 2)
+	case i >= math.MinInt32:
+		e.write(codeInt32, uint64(i), 4)
+	default:
+		e.write(codeInt64, uint64(i), 8)
+	}
+}
+
+func (e *encoder) uint(u uint64) {
+	switch {
+	case u <= 0x7f:
+		e.buf.WriteByte(byte(u))
+	case u <= math.MaxUint8:
+		e.write(codeUint8, u, 1)
+	case u <= math.MaxUint16:
+		e.write(codeUint16, u, 2)
+	case u <= math.MaxUint32:
+		e.write(codeUint32, u, 4)
+	default:
+		e.write(codeUint64, u, 8)
+	}
+}
+
+func (e *encoder) strHeader(n int) {
+	switch {
+	case n < 32:
+		e.buf.WriteByte(codeFixStr | byte(n))
+	case n <= math.MaxUint8:
+		e.write(codeStr8, uint64(n), 1)
+	case n <= math.MaxUint16:
+		e.write(codeStr16, uint64(n), 2)
+	default:
+		e.write(codeStr32, uint64(n), 4)
+	}
+}
+
+func (e *encoder) binHeader(n int) {
+	switch {
+	case n <= math.MaxUint8:
+		e.write(codeBin8, uint64(n), 1)
+	case n <= math.MaxUint16:
+		e.write(codeBin16, uint64(n), 2)
+	default:
+		e.write(codeBin32, uint64(n), 4)
+	}
+}
+
+// collHeader array 和 map 的头部
+func (e *encoder) collHeader(fix, code16, code32 byte, n int) {
+	switch {
+	case n < 16:
+		e.buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		e.write(code16, uint64(n), 2)
+	default:
+		e.write(code32, uint64(n), 4)
+	}
+}
+
+func (e *encoder) extHeader(typ int8, n int) {
+	switch n {
+	case 1:
+		e.buf.WriteByte(codeFixExt1)
+	case 2:
+		e.buf.WriteByte(codeFixExt2)
+	case 4:
+		e.buf.WriteByte(codeFixExt4)
+	case 8:
+		e.buf.WriteByte(codeFixExt8)
+	case 16:
+		e.buf.WriteByte(codeFixExt16)
+	default:
+		switch {
+		case n <= math.MaxUint8:
+			e.write(codeExt8, uint64(n), 1)
+		case n <= math.MaxUint16:
+			e.write(codeExt16, uint64(n), 2)
+		default:
+			e.write(codeExt32, uint64(n), 4)
+		}
+	}
+	e.buf.WriteByte(byte(typ))
+}
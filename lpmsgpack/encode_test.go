@@ -0,0 +1,203 @@
+package lpmsgpack
+
+import (
+	"encoding/json"
+	"math"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	memorypool "github.com/userpro/linearpool"
+)
+
+type point struct {
+	X, Y int32
+}
+
+// MarshalMsgpackExt 自定义扩展类型 1, 编码为 8 字节
+func (p point) MarshalMsgpackExt(ac *memorypool.Allocator) (int8, []byte, error) {
+	b := memorypool.NewSlice[byte](ac, 8, 8)
+	for i := 0; i < 4; i++ {
+		b[i] = byte(uint32(p.X) >> (24 - 8*i))
+		b[4+i] = byte(uint32(p.Y) >> (24 - 8*i))
+	}
+	return 1, b, nil
+}
+
+func (p *point) UnmarshalMsgpackExt(ac *memorypool.Allocator, typ int8, data []byte) error {
+	var x, y uint32
+	for i := 0; i < 4; i++ {
+		x = x<<8 | uint32(data[i])
+		y = y<<8 | uint32(data[4+i])
+	}
+	p.X, p.Y = int32(x), int32(y)
+	return nil
+}
+
+type Base struct {
+	ID   int64  `msgpack:"id"`
+	Kind string `msgpack:"kind,omitempty"`
+}
+
+type record struct {
+	Base
+	Name    string            `msgpack:"name"`
+	Skip    string            `msgpack:"-"`
+	Empty   string            `msgpack:"empty,omitempty"`
+	Score   float64           `msgpack:"score"`
+	Ratio   float32           `msgpack:"ratio"`
+	Small   int8              `msgpack:"small"`
+	Big     uint64            `msgpack:"big"`
+	Flag    bool              `msgpack:"flag"`
+	Data    []byte            `msgpack:"data"`
+	Tags    []string          `msgpack:"tags"`
+	Matrix  [2][2]int         `msgpack:"matrix"`
+	Next    *record           `msgpack:"next"`
+	Attrs   map[string]int    `msgpack:"attrs"`
+	ByID    map[int]*Base     `msgpack:"by_id"`
+	Any     any               `msgpack:"any"`
+	At      time.Time         `msgpack:"at"`
+	AtPtr   *time.Time        `msgpack:"at_ptr"`
+	Pt      point             `msgpack:"pt"`
+	PtPtr   *point            `msgpack:"pt_ptr"`
+	Ext     Ext               `msgpack:"ext"`
+	Raw     RawMessage        `msgpack:"raw"`
+	Nested  map[string][]Base `msgpack:"nested"`
+	private int
+}
+
+func newRecord() *record {
+	at := time.Unix(1<<35, 123).UTC()
+	return &record{
+		Base:   Base{ID: -1 << 40, Kind: "k"},
+		Name:   strings.Repeat("n", 40),
+		Skip:   "skip",
+		Score:  -1.25,
+		Ratio:  0.5,
+		Small:  -100,
+		Big:    math.MaxUint64,
+		Flag:   true,
+		Data:   []byte{1, 2, 3},
+		Tags:   []string{"a", "", "c"},
+		Matrix: [2][2]int{{1, 2}, {3, 4}},
+		Next:   &record{Name: "next", Tags: []string{}},
+		Attrs:  map[string]int{"a": 1, "b": -200},
+		ByID:   map[int]*Base{1: {ID: 1}, 2: nil},
+		Any:    map[string]any{"k": []any{int64(1), "v", nil, true, 2.5}},
+		At:     time.Unix(1700000000, 0).UTC(),
+		AtPtr:  &at,
+		Pt:     point{-1, 2},
+		PtPtr:  &point{3, -4},
+		Ext:    Ext{Type: 42, Data: []byte("xyz")},
+		Raw:    RawMessage{0x92, 0x01, 0xa1, 'x'},
+		Nested: map[string][]Base{"n": {{ID: 5}}},
+	}
+}
+
+func TestMarshalFormat(t *testing.T) {
+	ac := memorypool.NewAlloctorFromPool(0)
+	for _, c := range []struct {
+		v    any
+		want []byte
+	}{
+		{nil, []byte{0xc0}},
+		{true, []byte{0xc3}},
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0xcc, 0x80}},
+		{-1, []byte{0xff}},
+		{-32, []byte{0xe0}},
+		{-33, []byte{0xd0, 0xdf}},
+		{-129, []byte{0xd1, 0xff, 0x7f}},
+		{70000, []byte{0xce, 0x00, 0x01, 0x11, 0x70}},
+		{int64(-1 << 40), []byte{0xd3, 0xff, 0xff, 0xff, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{uint64(1 << 32), []byte{0xcf, 0, 0, 0, 1, 0, 0, 0, 0}},
+		{float32(1.5), []byte{0xca, 0x3f, 0xc0, 0x00, 0x00}},
+		{1.5, []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		{"abc", []byte{0xa3, 'a', 'b', 'c'}},
+		{[]byte{1}, []byte{0xc4, 0x01, 0x01}},
+		{[]byte(nil), []byte{0xc0}},
+		{[]int{1, 2}, []byte{0x92, 0x01, 0x02}},
+		{map[string]int{"a": 1}, []byte{0x81, 0xa1, 'a', 0x01}},
+		{struct {
+			A int `msgpack:"a"`
+			B int `msgpack:"b,omitempty"`
+		}{A: 1}, []byte{0x81, 0xa1, 'a', 0x01}},
+		{Ext{Type: 5, Data: []byte{1, 2}}, []byte{0xd5, 0x05, 0x01, 0x02}},
+		{Ext{Type: -2, Data: []byte{1, 2, 3}}, []byte{0xc7, 0x03, 0xfe, 0x01, 0x02, 0x03}},
+		{time.Unix(1, 0), []byte{0xd6, 0xff, 0, 0, 0, 1}},
+		{time.Unix(1, 1), []byte{0xd7, 0xff, 0, 0, 0, 0x04, 0, 0, 0, 1}},
+		{time.Unix(-1, 0), []byte{0xc7, 12, 0xff, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{RawMessage{0xc3}, []byte{0xc3}},
+	} {
+		got, err := Marshal(ac, c.v)
+		assert.Nil(t, err)
+		assert.EqualValues(t, c.want, got, "%#v", c.v)
+	}
+
+	// 长度跨越格式边界
+	b, _ := Marshal(ac, strings.Repeat("x", 32))
+	assert.EqualValues(t, []byte{0xd9, 32}, b[:2])
+	b, _ = Marshal(ac, make([]int, 16))
+	assert.EqualValues(t, []byte{0xdc, 0, 16}, b[:3])
+	b, _ = Marshal(ac, make([]byte, 1<<16))
+	assert.EqualValues(t, []byte{0xc6, 0, 1, 0, 0}, b[:5])
+
+	runtime.KeepAlive(ac)
+}
+
+func TestMarshalErrors(t *testing.T) {
+	ac := memorypool.NewAlloctorFromPool(0)
+	type cycle struct {
+		Next *cycle
+	}
+	c := &cycle{}
+	c.Next = c
+	for _, v := range []any{make(chan int), func() {}, c, []any{complex(1, 2)}} {
+		_, err := Marshal(ac, v)
+		assert.NotNil(t, err)
+	}
+	runtime.KeepAlive(ac)
+}
+
+type EmbedA struct {
+	X int
+	Y int
+	Z int `msgpack:"Z"`
+	W int
+}
+
+type EmbedB struct {
+	X int
+	Y int `msgpack:"Y" json:"Y"`
+	Z int `msgpack:"Z"`
+	V int
+}
+
+type myInt int
+
+func TestStructFieldConflicts(t *testing.T) {
+	ac := memorypool.NewAlloctorFromPool(0)
+	// 同 encoding/json: X 和 Z 在同一层级冲突被忽略, 带 tag 的 EmbedB.Y 优先, 层级浅的 W 优先, 未导出的 myInt 被忽略
+	type conflicts struct {
+		EmbedA
+		EmbedB
+		W int
+		myInt
+	}
+	v := conflicts{EmbedA{1, 2, 3, 4}, EmbedB{5, 6, 7, 8}, 9, 10}
+	j, err := json.Marshal(v)
+	assert.Nil(t, err)
+	assert.EqualValues(t, `{"Y":6,"V":8,"W":9}`, string(j))
+
+	b, err := Marshal(ac, v)
+	assert.Nil(t, err)
+	assert.EqualValues(t, []byte{0x83, 0xa1, 'Y', 6, 0xa1, 'V', 8, 0xa1, 'W', 9}, b)
+	var got conflicts
+	assert.Nil(t, Unmarshal(ac, b, &got))
+	assert.EqualValues(t, conflicts{EmbedB: EmbedB{Y: 6, V: 8}, W: 9}, got)
+
+	runtime.KeepAlive(ac)
+}
@@ -0,0 +1,112 @@
+package lpmsgpack
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// field 结构体中参与编解码的字段
+type field struct {
+	name      string
+	index     []int // 嵌入结构体时为多级下标
+	omitEmpty bool
+	tagged    bool // 名字来自 tag, 同名冲突时优先
+}
+
+type structFields struct {
+	list   []field
+	byName map[string]int
+}
+
+var fieldCache sync.Map // reflect.Type -> *structFields
+
+// cachedTypeFields 返回 t 的字段列表, 结果按类型缓存
+func cachedTypeFields(t reflect.Type) *structFields {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.(*structFields)
+	}
+	fs := dominantFields(typeFields(nil, t, nil))
+	f, _ := fieldCache.LoadOrStore(t, fs)
+	return f.(*structFields)
+}
+
+// typeFields 按下标顺序收集所有字段, 展开没有 tag 的非指针嵌入结构体.
+// 同 encoding/json, 忽略未导出的非结构体嵌入字段
+func typeFields(list []field, t reflect.Type, index []int) []field {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() && (!sf.Anonymous || sf.Type.Kind() != reflect.Struct) {
+			continue
+		}
+		tag := sf.Tag.Get("msgpack")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		idx := append(index[:len(index):len(index)], i)
+
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct && sf.Type != timeType {
+			list = typeFields(list, sf.Type, idx)
+			continue
+		}
+		if !sf.IsExported() {
+			continue // 带 tag 的未导出嵌入结构体无法赋值
+		}
+		tagged := name != ""
+		if !tagged {
+			name = sf.Name
+		}
+		list = append(list, field{name: name, index: idx, omitEmpty: hasOption(opts, "omitempty"), tagged: tagged})
+	}
+	return list
+}
+
+// dominantFields 同 encoding/json 处理同名字段: 层级最浅的字段优先, 同一层级中只有一个带 tag 的字段时取该字段,
+// 否则同名的字段都被忽略
+func dominantFields(all []field) *structFields {
+	fs := &structFields{byName: map[string]int{}}
+	for i, f := range all {
+		dominant := true
+		for j, g := range all {
+			if j == i || g.name != f.name {
+				continue
+			}
+			if len(g.index) < len(f.index) || len(g.index) == len(f.index) && (g.tagged || !f.tagged) {
+				dominant = false
+				break
+			}
+		}
+		if dominant {
+			fs.byName[f.name] = len(fs.list)
+			fs.list = append(fs.list, f)
+		}
+	}
+	return fs
+}
+
+func hasOption(opts, name string) bool {
+	for opts != "" {
+		var opt string
+		opt, opts, _ = strings.Cut(opts, ",")
+		if opt == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmptyValue omitempty 的判断规则同 encoding/json
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.Interface, reflect.Pointer:
+		return v.IsZero()
+	}
+	return false
+}
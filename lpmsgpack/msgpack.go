@@ -0,0 +1,103 @@
+// Package lpmsgpack 分配在内存池中的 MessagePack 编解码.
+//
+// 结构体编码为以字段名为 key 的 map, 字段名默认为 Go 字段名, 可以通过
+// `msgpack:"name,omitempty"` 修改, `msgpack:"-"` 忽略该字段; 没有 tag 的嵌入结构体会被展开.
+// time.Time 编码为 timestamp 扩展类型 (-1).
+package lpmsgpack
+
+import (
+	"errors"
+	"reflect"
+	"time"
+
+	memorypool "github.com/userpro/linearpool"
+)
+
+// MessagePack 格式的类型码
+const (
+	codeNil   byte = 0xc0
+	codeFalse byte = 0xc2
+	codeTrue  byte = 0xc3
+
+	codeBin8  byte = 0xc4
+	codeBin16 byte = 0xc5
+	codeBin32 byte = 0xc6
+
+	codeExt8  byte = 0xc7
+	codeExt16 byte = 0xc8
+	codeExt32 byte = 0xc9
+
+	codeFloat32 byte = 0xca
+	codeFloat64 byte = 0xcb
+
+	codeUint8  byte = 0xcc
+	codeUint16 byte = 0xcd
+	codeUint32 byte = 0xce
+	codeUint64 byte = 0xcf
+	codeInt8   byte = 0xd0
+	codeInt16  byte = 0xd1
+	codeInt32  byte = 0xd2
+	codeInt64  byte = 0xd3
+
+	codeFixExt1  byte = 0xd4
+	codeFixExt2  byte = 0xd5
+	codeFixExt4  byte = 0xd6
+	codeFixExt8  byte = 0xd7
+	codeFixExt16 byte = 0xd8
+
+	codeStr8  byte = 0xd9
+	codeStr16 byte = 0xda
+	codeStr32 byte = 0xdb
+
+	codeArray16 byte = 0xdc
+	codeArray32 byte = 0xdd
+	codeMap16   byte = 0xde
+	codeMap32   byte = 0xdf
+
+	codeFixMap   byte = 0x80
+	codeFixArray byte = 0x90
+	codeFixStr   byte = 0xa0
+	codeNegFix   byte = 0xe0
+)
+
+// extTimestamp timestamp 扩展类型
+const extTimestamp int8 = -1
+
+var errShortData = errors.New("lpmsgpack: unexpected end of data")
+
+// Ext 扩展类型的原始内容, 解码到 interface{} 时未知的扩展类型也会得到 Ext
+type Ext struct {
+	Type int8
+	Data []byte
+}
+
+// MarshalMsgpackExt 实现 ExtMarshaler
+func (e Ext) MarshalMsgpackExt(ac *memorypool.Allocator) (int8, []byte, error) {
+	return e.Type, e.Data, nil
+}
+
+// UnmarshalMsgpackExt 实现 ExtUnmarshaler, data 已经在内存池中
+func (e *Ext) UnmarshalMsgpackExt(ac *memorypool.Allocator, typ int8, data []byte) error {
+	e.Type, e.Data = typ, data
+	return nil
+}
+
+// ExtMarshaler 编码为扩展类型, 返回的 data 可以分配在 ac 中
+type ExtMarshaler interface {
+	MarshalMsgpackExt(ac *memorypool.Allocator) (typ int8, data []byte, err error)
+}
+
+// ExtUnmarshaler 从扩展类型解码, data 是内存池中的拷贝, 可以直接保留
+type ExtUnmarshaler interface {
+	UnmarshalMsgpackExt(ac *memorypool.Allocator, typ int8, data []byte) error
+}
+
+// RawMessage 已经编码好的 MessagePack 值, 编码时原样输出, 解码时保存原始内容的拷贝, 可以用来延迟解码
+type RawMessage []byte
+
+var (
+	extMarshalerType   = reflect.TypeOf((*ExtMarshaler)(nil)).Elem()
+	extUnmarshalerType = reflect.TypeOf((*ExtUnmarshaler)(nil)).Elem()
+	rawMessageType     = reflect.TypeOf(RawMessage(nil))
+	timeType           = reflect.TypeOf(time.Time{})
+)
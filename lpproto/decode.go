@@ -0,0 +1,401 @@
+// Package lpproto 不依赖 protobuf 运行时的 wire format 编解码.
+// 字段由生成代码中的 `protobuf:"..."` tag 描述, 解码结果和编码输出都分配在内存池中.
+// 不支持 group 和 oneof.
+package lpproto
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+
+	memorypool "github.com/userpro/linearpool"
+)
+
+var (
+	errTruncated = errors.New("lpproto: truncated message")
+	errOverflow  = errors.New("lpproto: varint overflow")
+	errWireType  = errors.New("lpproto: unexpected wire type")
+	errFieldNum  = errors.New("lpproto: invalid field number")
+	errDepth     = errors.New("lpproto: exceeded max depth")
+)
+
+// maxDepth 嵌套消息和 group 的最大深度, 同 protobuf-go 默认的 RecursionLimit
+const maxDepth = 10000
+
+// wire type 中已废弃的 group
+const (
+	wireStartGroup = 3
+	wireEndGroup   = 4
+)
+
+// Unmarshal 把 wire format 的 b 解码到 m (指向结构体的指针), 解码前先清空 m.
+//
+// 嵌套消息, repeated 字段, string 和 bytes 都从 ac 分配, proto2 的 optional 标量通过
+// ac.Int32/ac.String 等分配; map 字段使用堆上的 map 并通过 ac.KeepAlive 保活.
+// 未知字段直接丢弃. 解码结果的生命周期不能超过 ac.
+func Unmarshal(ac *memorypool.Allocator, b []byte, m any) error {
+	rv := reflect.ValueOf(m)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("lpproto: Unmarshal(non-nil pointer to struct expected, got %T)", m)
+	}
+	rv = rv.Elem()
+	rv.SetZero()
+	return decoder{ac: ac}.message(b, rv)
+}
+
+type decoder struct {
+	ac    *memorypool.Allocator
+	depth int // 当前消息的嵌套深度, decoder 按值传递, 返回时不需要恢复
+}
+
+func (d decoder) message(b []byte, v reflect.Value) error {
+	if d.depth++; d.depth > maxDepth {
+		return errDepth
+	}
+	mi, err := cachedMessageInfo(v.Type())
+	if err != nil {
+		return err
+	}
+	for len(b) > 0 {
+		num, wtyp, n, err := consumeTag(b)
+		if err != nil {
+			return err
+		}
+		b = b[n:]
+
+		f := mi.field(num)
+		if f == nil {
+			if n, err = skipValue(b, num, wtyp, d.depth); err != nil {
+				return err
+			}
+			b = b[n:]
+			continue
+		}
+
+		x, p, n, err := consumeValue(b, wtyp)
+		if err != nil {
+			return err
+		}
+		b = b[n:]
+		if err := d.field(f, v.Field(f.index), wtyp, x, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d decoder) field(f *fieldInfo, v reflect.Value, wtyp int, x uint64, p []byte) error {
+	t := f.typ
+	switch {
+	case t.Kind() == reflect.Map:
+		if wtyp != wireBytes {
+			return errWireType
+		}
+		return d.mapEntry(f, v, p)
+
+	case t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8: // []byte 是 bytes 标量
+		// 标量不论声明是否 packed 都要同时接受两种格式
+		if wtyp == wireBytes && f.enc != encBytes {
+			return d.packed(f, v, p)
+		}
+		if wtyp != f.enc.wireType() {
+			return errWireType
+		}
+		i := v.Len()
+		d.grow(v, 1)
+		return d.singular(f, v.Index(i), x, p)
+
+	default:
+		if wtyp != f.enc.wireType() {
+			return errWireType
+		}
+		return d.singular(f, v, x, p)
+	}
+}
+
+// singular 解码单个值到 v, 嵌套消息出现多次时合并
+func (d decoder) singular(f *fieldInfo, v reflect.Value, x uint64, p []byte) error {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if et := v.Type().Elem(); et.Kind() == reflect.Struct {
+			if v.IsNil() {
+				v.Set(d.ac.NewValue(et))
+			}
+			return d.message(p, v.Elem())
+		}
+		return d.optional(f, v, x, p)
+	case reflect.String:
+		v.SetString(d.ac.NewString(memorypool.BytesToString(p)))
+	case reflect.Slice:
+		v.SetBytes(d.bytes(p))
+	default:
+		return setScalar(v, f.enc, x)
+	}
+	return nil
+}
+
+// optional proto2 的 optional 标量, 常见类型直接使用 Allocator 的 Protobuf2 APIs
+func (d decoder) optional(f *fieldInfo, v reflect.Value, x uint64, p []byte) error {
+	switch ptr := v.Addr().Interface().(type) {
+	case **bool:
+		*ptr = d.ac.Bool(x != 0)
+	case **int32:
+		*ptr = d.ac.Int32(int32(decodeInt(f.enc, x)))
+	case **int64:
+		*ptr = d.ac.Int64(decodeInt(f.enc, x))
+	case **uint32:
+		*ptr = d.ac.Uint32(uint32(x))
+	case **uint64:
+		*ptr = d.ac.Uint64(x)
+	case **float32:
+		*ptr = d.ac.Float32(math.Float32frombits(uint32(x)))
+	case **float64:
+		*ptr = d.ac.Float64(math.Float64frombits(x))
+	case **string:
+		*ptr = d.ac.String(memorypool.BytesToString(p))
+	default: // 枚举等命名类型
+		e := d.ac.NewValue(v.Type().Elem())
+		if err := setScalar(e.Elem(), f.enc, x); err != nil {
+			return err
+		}
+		v.Set(e)
+	}
+	return nil
+}
+
+func (d decoder) bytes(p []byte) []byte {
+	if len(p) == 0 {
+		return memorypool.EmptySlice[byte]()
+	}
+	s := d.ac.NewString(memorypool.BytesToString(p))
+	return memorypool.StringToBytes(s)
+}
+
+// grow 把 repeated 字段 v 的长度增加 n, 容量不足时从内存池重新分配
+func (d decoder) grow(v reflect.Value, n int) {
+	l := v.Len()
+	if l+n > v.Cap() {
+		c := 2 * v.Cap()
+		if c < l+n {
+			c = l + n
+		}
+		d.ac.ReallocSlice(v, c)
+	}
+	v.SetLen(l + n)
+}
+
+// packed 解码 packed repeated 标量, 先算出元素个数一次性扩容
+func (d decoder) packed(f *fieldInfo, v reflect.Value, p []byte) error {
+	var n int
+	switch f.enc {
+	case encFixed32:
+		if len(p)%4 != 0 {
+			return errTruncated
+		}
+		n = len(p) / 4
+	case encFixed64:
+		if len(p)%8 != 0 {
+			return errTruncated
+		}
+		n = len(p) / 8
+	default:
+		for _, c := range p {
+			if c < 0x80 {
+				n++
+			}
+		}
+	}
+
+	i := v.Len()
+	d.grow(v, n)
+	for ; len(p) > 0; i++ {
+		x, _, m, err := consumeValue(p, f.enc.wireType())
+		if err != nil {
+			return err
+		}
+		p = p[m:]
+		if err := setScalar(v.Index(i), f.enc, x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mapEntry map 的每个元素编码为 key=1, value=2 的嵌套消息
+func (d decoder) mapEntry(f *fieldInfo, v reflect.Value, p []byte) error {
+	t := f.typ
+	if v.IsNil() {
+		m := reflect.MakeMap(t)
+		v.Set(m)
+		d.ac.KeepAlive(m.Interface())
+	}
+	key := d.ac.NewValue(t.Key()).Elem()
+	val := d.ac.NewValue(t.Elem()).Elem()
+	for len(p) > 0 {
+		num, wtyp, n, err := consumeTag(p)
+		if err != nil {
+			return err
+		}
+		p = p[n:]
+
+		var kf *fieldInfo
+		var kv reflect.Value
+		switch num {
+		case 1:
+			kf, kv = f.key, key
+		case 2:
+			kf, kv = f.val, val
+		default:
+			if n, err = skipValue(p, num, wtyp, d.depth); err != nil {
+				return err
+			}
+			p = p[n:]
+			continue
+		}
+
+		x, q, n, err := consumeValue(p, wtyp)
+		if err != nil {
+			return err
+		}
+		p = p[n:]
+		if wtyp != kf.enc.wireType() {
+			return errWireType
+		}
+		if err := d.singular(kf, kv, x, q); err != nil {
+			return err
+		}
+	}
+	// value 为消息且没有出现时同官方实现, 存入空消息而不是 nil
+	if val.Kind() == reflect.Pointer && val.IsNil() && val.Type().Elem().Kind() == reflect.Struct {
+		val.Set(d.ac.NewValue(val.Type().Elem()))
+	}
+	v.SetMapIndex(key, val)
+	return nil
+}
+
+func setScalar(v reflect.Value, enc encoding, x uint64) error {
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(x != 0)
+	case reflect.Int32, reflect.Int64:
+		v.SetInt(decodeInt(enc, x))
+	case reflect.Uint32, reflect.Uint64:
+		v.SetUint(x)
+	case reflect.Float32:
+		v.SetFloat(float64(math.Float32frombits(uint32(x))))
+	case reflect.Float64:
+		v.SetFloat(math.Float64frombits(x))
+	default:
+		return fmt.Errorf("lpproto: unsupported field type %v", v.Type())
+	}
+	return nil
+}
+
+// decodeInt 按编码方式还原有符号整数
+func decodeInt(enc encoding, x uint64) int64 {
+	switch enc {
+	case encZigzag32:
+		return int64(int32(uint32(x)>>1) ^ -int32(uint32(x)&1))
+	case encZigzag64:
+		return int64(x>>1) ^ -int64(x&1)
+	case encFixed32: // sfixed32
+		return int64(int32(uint32(x)))
+	}
+	return int64(x)
+}
+
+//============================================================================
+// wire format
+//============================================================================
+
+func consumeVarint(b []byte) (uint64, int, error) {
+	var x uint64
+	for i := 0; i < len(b); i++ {
+		if i == 10 {
+			return 0, 0, errOverflow
+		}
+		c := b[i]
+		x |= uint64(c&0x7f) << (7 * i)
+		if c < 0x80 {
+			if i == 9 && c > 1 {
+				return 0, 0, errOverflow
+			}
+			return x, i + 1, nil
+		}
+	}
+	return 0, 0, errTruncated
+}
+
+func consumeTag(b []byte) (num, wtyp, n int, err error) {
+	x, n, err := consumeVarint(b)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if x>>3 == 0 || x>>3 > math.MaxInt32 {
+		return 0, 0, 0, errFieldNum
+	}
+	return int(x >> 3), int(x & 7), n, nil
+}
+
+// consumeValue 读取一个值: varint/fixed 的值在 x 中, bytes 的内容在 p 中, n 为消耗的字节数
+func consumeValue(b []byte, wtyp int) (x uint64, p []byte, n int, err error) {
+	switch wtyp {
+	case wireVarint:
+		x, n, err = consumeVarint(b)
+	case wireFixed32:
+		if len(b) < 4 {
+			return 0, nil, 0, errTruncated
+		}
+		x, n = uint64(binary.LittleEndian.Uint32(b)), 4
+	case wireFixed64:
+		if len(b) < 8 {
+			return 0, nil, 0, errTruncated
+		}
+		x, n = binary.LittleEndian.Uint64(b), 8
+	case wireBytes:
+		var l uint64
+		if l, n, err = consumeVarint(b); err != nil {
+			return 0, nil, 0, err
+		}
+		if l > uint64(len(b)-n) {
+			return 0, nil, 0, errTruncated
+		}
+		p = b[n : n+int(l)]
+		n += int(l)
+	default:
+		err = errWireType
+	}
+	return
+}
+
+// skipValue 跳过未知字段, 包括已废弃的 group, depth 为所在消息的嵌套深度
+func skipValue(b []byte, num, wtyp, depth int) (int, error) {
+	if wtyp != wireStartGroup {
+		_, _, n, err := consumeValue(b, wtyp)
+		return n, err
+	}
+	if depth++; depth > maxDepth {
+		return 0, errDepth
+	}
+
+	n := 0
+	for {
+		fnum, ftyp, m, err := consumeTag(b[n:])
+		if err != nil {
+			return 0, err
+		}
+		n += m
+		if ftyp == wireEndGroup {
+			if fnum != num {
+				return 0, errWireType
+			}
+			return n, nil
+		}
+		if m, err = skipValue(b[n:], fnum, ftyp, depth); err != nil {
+			return 0, err
+		}
+		n += m
+	}
+}
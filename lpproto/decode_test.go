@@ -0,0 +1,243 @@
+package lpproto
+
+import (
+	"encoding/binary"
+	"math"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	memorypool "github.com/userpro/linearpool"
+)
+
+type Kind int32
+
+const (
+	KindUnknown Kind = 0
+	KindA       Kind = 1
+	KindB       Kind = 2
+)
+
+type Inner struct {
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3"`
+	Value int64  `protobuf:"zigzag64,2,opt,name=value,proto3"`
+}
+
+// Message 与 protoc-gen-go 生成的结构体布局相同
+type Message struct {
+	state         struct{}
+	sizeCache     int32
+	unknownFields []byte
+
+	Id      int32              `protobuf:"varint,1,opt,name=id,proto3"`
+	Neg     int64              `protobuf:"varint,2,opt,name=neg,proto3"`
+	Flag    bool               `protobuf:"varint,3,opt,name=flag,proto3"`
+	F32     float32            `protobuf:"fixed32,4,opt,name=f32,proto3"`
+	F64     float64            `protobuf:"fixed64,5,opt,name=f64,proto3"`
+	S32     int32              `protobuf:"zigzag32,6,opt,name=s32,proto3"`
+	Sfix    int32              `protobuf:"fixed32,7,opt,name=sfix,proto3"`
+	Name    string             `protobuf:"bytes,8,opt,name=name,proto3"`
+	Data    []byte             `protobuf:"bytes,9,opt,name=data,proto3"`
+	Inner   *Inner             `protobuf:"bytes,10,opt,name=inner,proto3"`
+	Nums    []int32            `protobuf:"varint,11,rep,packed,name=nums,proto3"`
+	Fixeds  []uint64           `protobuf:"fixed64,12,rep,packed,name=fixeds,proto3"`
+	Names   []string           `protobuf:"bytes,13,rep,name=names,proto3"`
+	Items   []*Inner           `protobuf:"bytes,14,rep,name=items,proto3"`
+	Kind    Kind               `protobuf:"varint,15,opt,name=kind,proto3,enum=test.Kind"`
+	Attrs   map[string]int32   `protobuf:"bytes,16,rep,name=attrs,proto3" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"varint,2,opt,name=value,proto3"`
+	Opt     *int32             `protobuf:"varint,17,opt,name=opt"`
+	OptS    *string            `protobuf:"bytes,18,opt,name=opt_s"`
+	OptKind *Kind              `protobuf:"varint,19,opt,name=opt_kind,enum=test.Kind"`
+	Chunks  [][]byte           `protobuf:"bytes,20,rep,name=chunks,proto3"`
+	Big     uint64             `protobuf:"varint,21,opt,name=big,proto3"`
+	ByID    map[int64]*Inner   `protobuf:"bytes,22,rep,name=by_id,proto3" protobuf_key:"varint,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Flags   []bool             `protobuf:"varint,23,rep,packed,name=flags,proto3"`
+	Zigs    []int64            `protobuf:"zigzag64,24,rep,packed,name=zigs,proto3"`
+	Floats  []float32          `protobuf:"fixed32,25,rep,packed,name=floats,proto3"`
+	OptF    *float64           `protobuf:"fixed64,26,opt,name=opt_f"`
+	OneOf   isMessage_OneOf    `protobuf_oneof:"one_of"`
+	Extra   map[uint32]float64 `protobuf:"bytes,27,rep,name=extra,proto3" protobuf_key:"varint,1,opt,name=key,proto3" protobuf_val:"fixed64,2,opt,name=value,proto3"`
+}
+
+type isMessage_OneOf interface{ isMessage_OneOf() }
+
+// wire 测试中手工拼装 wire format
+type wire []byte
+
+func (w wire) tag(num, wtyp int) wire {
+	return binary.AppendUvarint(w, uint64(num)<<3|uint64(wtyp))
+}
+
+func (w wire) varint(num int, x uint64) wire {
+	return binary.AppendUvarint(w.tag(num, wireVarint), x)
+}
+
+func (w wire) fixed32(num int, x uint32) wire {
+	return binary.LittleEndian.AppendUint32(w.tag(num, wireFixed32), x)
+}
+
+func (w wire) fixed64(num int, x uint64) wire {
+	return binary.LittleEndian.AppendUint64(w.tag(num, wireFixed64), x)
+}
+
+func (w wire) bytes(num int, b []byte) wire {
+	return append(binary.AppendUvarint(w.tag(num, wireBytes), uint64(len(b))), b...)
+}
+
+func zigzag(x int64) uint64 {
+	return uint64(x<<1) ^ uint64(x>>63)
+}
+
+func TestUnmarshal(t *testing.T) {
+	inner := wire{}.bytes(1, []byte("in")).varint(2, zigzag(-3))
+	var packed wire
+	for _, x := range []int32{1, -1, 300} {
+		packed = binary.AppendUvarint(packed, uint64(int64(x)))
+	}
+	var fixeds wire
+	fixeds = binary.LittleEndian.AppendUint64(fixeds, 7)
+	fixeds = binary.LittleEndian.AppendUint64(fixeds, math.MaxUint64)
+
+	b := wire{}.
+		varint(1, 150).
+		varint(2, uint64(math.MaxUint64-1)).
+		varint(3, 1).
+		fixed32(4, math.Float32bits(1.5)).
+		fixed64(5, math.Float64bits(-2.25)).
+		varint(6, zigzag(-64)).
+		fixed32(7, uint32(0xfffffffe)).
+		bytes(8, []byte("hello")).
+		bytes(9, []byte{0, 1, 2}).
+		bytes(10, inner).
+		bytes(11, packed).
+		varint(11, 7). // 未 packed 的元素也要接受
+		bytes(12, fixeds).
+		bytes(13, []byte("a")).
+		bytes(13, []byte("")).
+		bytes(14, inner).
+		bytes(14, nil).
+		varint(15, 2).
+		bytes(16, wire{}.bytes(1, []byte("k")).varint(2, 5)).
+		bytes(16, wire{}.bytes(1, []byte("z"))).
+		varint(17, uint64(math.MaxUint64-6)).
+		bytes(18, []byte("opt")).
+		varint(19, 1).
+		bytes(20, []byte("c1")).
+		bytes(20, nil).
+		varint(21, math.MaxUint64).
+		bytes(22, wire{}.varint(1, 9).bytes(2, inner)).
+		bytes(22, wire{}.varint(1, 10)).
+		bytes(23, []byte{1, 0, 1}).
+		bytes(24, binary.AppendUvarint(nil, zigzag(math.MinInt64))).
+		bytes(25, binary.LittleEndian.AppendUint32(nil, math.Float32bits(0.5))).
+		fixed64(26, math.Float64bits(3)).
+		bytes(27, wire{}.varint(1, 4).fixed64(2, math.Float64bits(4.5))).
+		varint(100, 1).                        // 未知字段
+		bytes(101, []byte("unknown")).         // 未知字段
+		tag(102, wireStartGroup).varint(1, 1). // 未知的 group
+		tag(102, wireEndGroup).
+		bytes(10, wire{}.varint(2, zigzag(8))) // 嵌套消息合并
+
+	ac := memorypool.NewAlloctorFromPool(0)
+	m := &Message{Name: "stale", Nums: []int32{9}}
+	assert.Nil(t, Unmarshal(ac, b, m))
+	runtime.GC()
+
+	assert.EqualValues(t, 150, m.Id)
+	assert.EqualValues(t, -2, m.Neg)
+	assert.True(t, m.Flag)
+	assert.EqualValues(t, 1.5, m.F32)
+	assert.EqualValues(t, -2.25, m.F64)
+	assert.EqualValues(t, -64, m.S32)
+	assert.EqualValues(t, -2, m.Sfix)
+	assert.EqualValues(t, "hello", m.Name)
+	assert.EqualValues(t, []byte{0, 1, 2}, m.Data)
+	assert.EqualValues(t, &Inner{Name: "in", Value: 8}, m.Inner)
+	assert.EqualValues(t, []int32{1, -1, 300, 7}, m.Nums)
+	assert.EqualValues(t, []uint64{7, math.MaxUint64}, m.Fixeds)
+	assert.EqualValues(t, []string{"a", ""}, m.Names)
+	assert.EqualValues(t, []*Inner{{Name: "in", Value: -3}, {}}, m.Items)
+	assert.EqualValues(t, KindB, m.Kind)
+	assert.EqualValues(t, map[string]int32{"k": 5, "z": 0}, m.Attrs)
+	assert.EqualValues(t, -7, *m.Opt)
+	assert.EqualValues(t, "opt", *m.OptS)
+	assert.EqualValues(t, KindA, *m.OptKind)
+	assert.EqualValues(t, [][]byte{[]byte("c1"), {}}, m.Chunks)
+	assert.NotNil(t, m.Chunks[1])
+	assert.EqualValues(t, uint64(math.MaxUint64), m.Big)
+	assert.EqualValues(t, map[int64]*Inner{9: {Name: "in", Value: -3}, 10: {}}, m.ByID)
+	assert.EqualValues(t, []bool{true, false, true}, m.Flags)
+	assert.EqualValues(t, []int64{math.MinInt64}, m.Zigs)
+	assert.EqualValues(t, []float32{0.5}, m.Floats)
+	assert.EqualValues(t, 3, *m.OptF)
+	assert.EqualValues(t, map[uint32]float64{4: 4.5}, m.Extra)
+
+	// 解码前清空, 空输入得到零值
+	assert.Nil(t, Unmarshal(ac, nil, m))
+	assert.EqualValues(t, Message{}, *m)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	ac := memorypool.NewAlloctorFromPool(0)
+	for _, c := range []struct {
+		b   []byte
+		err error
+	}{
+		{[]byte{0x08}, errTruncated},
+		{[]byte{0x08, 0x96}, errTruncated},
+		{wire{}.bytes(8, []byte("abc"))[:4], errTruncated},
+		{wire{}.tag(4, wireFixed32).varint(1, 1)[:3], errTruncated},
+		{wire{}.bytes(12, []byte{1, 2, 3}), errTruncated},
+		{append(wire{}.tag(1, wireVarint), 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x02), errOverflow},
+		{append(wire{}.tag(1, wireVarint), 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x01), errOverflow},
+		{[]byte{0x00}, errFieldNum},
+		{wire{}.fixed64(1, 1), errWireType},
+		{wire{}.varint(8, 1), errWireType},
+		{wire{}.tag(1, 7), errWireType},
+		{wire{}.tag(100, wireStartGroup).tag(101, wireEndGroup), errWireType},
+		{wire{}.bytes(10, []byte{0x08}), errTruncated},
+	} {
+		var m Message
+		assert.Equal(t, c.err, Unmarshal(ac, c.b, &m), "%x", c.b)
+	}
+
+	assert.NotNil(t, Unmarshal(ac, nil, Message{}))
+	assert.NotNil(t, Unmarshal(ac, nil, (*Message)(nil)))
+	var bad struct {
+		X int `protobuf:"group,1,opt,name=x"`
+	}
+	assert.NotNil(t, Unmarshal(ac, nil, &bad))
+
+	runtime.KeepAlive(ac)
+}
+
+type Node struct {
+	Child *Node `protobuf:"bytes,1,opt,name=child,proto3"`
+}
+
+func TestUnmarshalMaxDepth(t *testing.T) {
+	ac := memorypool.NewAlloctorFromPool(0)
+	var b wire
+	for i := 0; i < maxDepth-1; i++ {
+		b = wire{}.bytes(1, b)
+	}
+	var n Node
+	assert.Nil(t, Unmarshal(ac, b, &n))
+	depth := 1
+	for p := &n; p.Child != nil; p = p.Child {
+		depth++
+	}
+	assert.EqualValues(t, maxDepth, depth)
+	assert.Equal(t, errDepth, Unmarshal(ac, wire{}.bytes(1, b), &n))
+
+	// 未知字段中嵌套过深的 group
+	var g wire
+	for i := 0; i <= maxDepth; i++ {
+		g = g.tag(2, wireStartGroup)
+	}
+	assert.Equal(t, errDepth, Unmarshal(ac, g, &n))
+
+	runtime.KeepAlive(ac)
+}
@@ -0,0 +1,326 @@
+package lpproto
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"reflect"
+	"sync"
+
+	memorypool "github.com/userpro/linearpool"
+)
+
+var errSizeChanged = errors.New("lpproto: message changed during marshal")
+
+// Marshal 把 m (结构体或指向结构体的指针) 编码为 wire format.
+//
+// 先计算出总长度, 输出是 ac 中的一次分配. proto3 字段为零值, proto2 的 optional 指针为 nil 时
+// 不输出; repeated 标量按 tag 中的 packed 输出. 同官方实现的默认行为, map 的输出顺序不固定.
+// m 为 nil 指针或编码后长度为 0 时返回 nil.
+func Marshal(ac *memorypool.Allocator, m any) ([]byte, error) {
+	rv := reflect.ValueOf(m)
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("lpproto: Marshal(struct or pointer to struct expected, got %T)", m)
+	}
+
+	e := encoderPool.Get().(*encoder)
+	defer encoderPool.Put(e)
+	e.sizes, e.next, e.nocache = e.sizes[:0], 0, 0
+
+	n, err := e.sizeMessage(rv)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	b := e.appendMessage(memorypool.NewSlice[byte](ac, 0, n), rv)
+	if len(b) != n {
+		return nil, errSizeChanged
+	}
+	return b, nil
+}
+
+var encoderPool = sync.Pool{New: func() any { return &encoder{} }}
+
+// encoder 计算长度时按先序记录嵌套消息的长度, 编码时按相同顺序取出, 避免重复计算.
+// map 的迭代顺序不固定, 其中的嵌套消息不使用记录
+type encoder struct {
+	sizes   []int
+	next    int
+	nocache int
+}
+
+//============================================================================
+// 计算长度
+//============================================================================
+
+func (e *encoder) sizeMessage(v reflect.Value) (int, error) {
+	mi, err := cachedMessageInfo(v.Type())
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for i := range mi.fields {
+		f := &mi.fields[i]
+		m, err := e.sizeField(f, v.Field(f.index))
+		if err != nil {
+			return 0, err
+		}
+		n += m
+	}
+	return n, nil
+}
+
+func (e *encoder) sizeField(f *fieldInfo, v reflect.Value) (int, error) {
+	tagSize := sizeVarint(uint64(f.num) << 3)
+	t := f.typ
+	switch {
+	case t.Kind() == reflect.Map:
+		n := 0
+		e.nocache++
+		iter := v.MapRange()
+		for iter.Next() {
+			k, err := e.sizeValue(f.key, iter.Key())
+			if err != nil {
+				return 0, err
+			}
+			x, err := e.sizeValue(f.val, iter.Value())
+			if err != nil {
+				return 0, err
+			}
+			m := sizeVarint(uint64(f.key.num)<<3) + k + sizeVarint(uint64(f.val.num)<<3) + x
+			n += tagSize + sizeVarint(uint64(m)) + m
+		}
+		e.nocache--
+		return n, nil
+
+	case t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8:
+		l := v.Len()
+		if l == 0 {
+			return 0, nil
+		}
+		if f.packed && f.enc != encBytes {
+			m := 0
+			for i := 0; i < l; i++ {
+				x, err := scalarBits(v.Index(i), f.enc)
+				if err != nil {
+					return 0, err
+				}
+				m += scalarSize(f.enc, x)
+			}
+			return tagSize + sizeVarint(uint64(m)) + m, nil
+		}
+		n := 0
+		for i := 0; i < l; i++ {
+			m, err := e.sizeValue(f, v.Index(i))
+			if err != nil {
+				return 0, err
+			}
+			n += tagSize + m
+		}
+		return n, nil
+
+	default:
+		if isEmpty(f, v) {
+			return 0, nil
+		}
+		m, err := e.sizeValue(f, v)
+		return tagSize + m, err
+	}
+}
+
+// sizeValue 单个值不含 tag 的长度
+func (e *encoder) sizeValue(f *fieldInfo, v reflect.Value) (int, error) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.Type().Elem().Kind() == reflect.Struct {
+			if v.IsNil() { // map 中的空消息
+				return 1, nil
+			}
+			if e.nocache > 0 {
+				m, err := e.sizeMessage(v.Elem())
+				return sizeVarint(uint64(m)) + m, err
+			}
+			i := len(e.sizes)
+			e.sizes = append(e.sizes, 0)
+			m, err := e.sizeMessage(v.Elem())
+			e.sizes[i] = m
+			return sizeVarint(uint64(m)) + m, err
+		}
+		return e.sizeValue(f, v.Elem())
+	case reflect.String, reflect.Slice:
+		return sizeVarint(uint64(v.Len())) + v.Len(), nil
+	default:
+		x, err := scalarBits(v, f.enc)
+		return scalarSize(f.enc, x), err
+	}
+}
+
+// isEmpty 不需要输出的字段
+func isEmpty(f *fieldInfo, v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Pointer:
+		return v.IsNil()
+	case reflect.Slice: // proto2 中非 nil 的空 bytes 也要输出
+		return v.IsNil() || (f.proto3 && v.Len() == 0)
+	}
+	return v.IsZero()
+}
+
+//============================================================================
+// 编码
+//============================================================================
+
+// appendMessage 按 sizeMessage 计算好的长度写入, b 的容量足够, append 不会扩容
+func (e *encoder) appendMessage(b []byte, v reflect.Value) []byte {
+	mi, _ := cachedMessageInfo(v.Type())
+	for i := range mi.fields {
+		f := &mi.fields[i]
+		b = e.appendField(b, f, v.Field(f.index))
+	}
+	return b
+}
+
+func (e *encoder) appendField(b []byte, f *fieldInfo, v reflect.Value) []byte {
+	t := f.typ
+	switch {
+	case t.Kind() == reflect.Map:
+		e.nocache++
+		iter := v.MapRange()
+		for iter.Next() {
+			k, val := iter.Key(), iter.Value()
+			ks, _ := e.sizeValue(f.key, k)
+			vs, _ := e.sizeValue(f.val, val)
+			m := sizeVarint(uint64(f.key.num)<<3) + ks + sizeVarint(uint64(f.val.num)<<3) + vs
+			b = appendTag(b, f.num, wireBytes)
+			b = binary.AppendUvarint(b, uint64(m))
+			b = e.appendValue(appendTag(b, f.key.num, f.key.enc.wireType()), f.key, k)
+			b = e.appendValue(appendTag(b, f.val.num, f.val.enc.wireType()), f.val, val)
+		}
+		e.nocache--
+		return b
+
+	case t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8:
+		l := v.Len()
+		if l == 0 {
+			return b
+		}
+		if f.packed && f.enc != encBytes {
+			m := 0
+			for i := 0; i < l; i++ {
+				x, _ := scalarBits(v.Index(i), f.enc)
+				m += scalarSize(f.enc, x)
+			}
+			b = binary.AppendUvarint(appendTag(b, f.num, wireBytes), uint64(m))
+			for i := 0; i < l; i++ {
+				x, _ := scalarBits(v.Index(i), f.enc)
+				b = appendScalar(b, f.enc, x)
+			}
+			return b
+		}
+		for i := 0; i < l; i++ {
+			b = e.appendValue(appendTag(b, f.num, f.enc.wireType()), f, v.Index(i))
+		}
+		return b
+
+	default:
+		if isEmpty(f, v) {
+			return b
+		}
+		return e.appendValue(appendTag(b, f.num, f.enc.wireType()), f, v)
+	}
+}
+
+func (e *encoder) appendValue(b []byte, f *fieldInfo, v reflect.Value) []byte {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.Type().Elem().Kind() == reflect.Struct {
+			if v.IsNil() {
+				return append(b, 0)
+			}
+			var m int
+			if e.nocache > 0 {
+				m, _ = e.sizeMessage(v.Elem())
+			} else {
+				m = e.sizes[e.next]
+				e.next++
+			}
+			return e.appendMessage(binary.AppendUvarint(b, uint64(m)), v.Elem())
+		}
+		return e.appendValue(b, f, v.Elem())
+	case reflect.String:
+		return append(binary.AppendUvarint(b, uint64(v.Len())), v.String()...)
+	case reflect.Slice:
+		return append(binary.AppendUvarint(b, uint64(v.Len())), v.Bytes()...)
+	default:
+		x, _ := scalarBits(v, f.enc)
+		return appendScalar(b, f.enc, x)
+	}
+}
+
+//============================================================================
+// 标量
+//============================================================================
+
+// scalarBits 标量在 wire 上的值
+func scalarBits(v reflect.Value, enc encoding) (uint64, error) {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return 1, nil
+		}
+		return 0, nil
+	case reflect.Int32, reflect.Int64:
+		i := v.Int()
+		switch enc {
+		case encZigzag32:
+			return uint64(uint32(int32(i)<<1) ^ uint32(int32(i)>>31)), nil
+		case encZigzag64:
+			return uint64(i<<1) ^ uint64(i>>63), nil
+		case encFixed32:
+			return uint64(uint32(i)), nil
+		}
+		return uint64(i), nil // 负数同官方实现按 10 字节输出
+	case reflect.Uint32, reflect.Uint64:
+		return v.Uint(), nil
+	case reflect.Float32:
+		return uint64(math.Float32bits(float32(v.Float()))), nil
+	case reflect.Float64:
+		return math.Float64bits(v.Float()), nil
+	}
+	return 0, fmt.Errorf("lpproto: unsupported field type %v", v.Type())
+}
+
+func scalarSize(enc encoding, x uint64) int {
+	switch enc {
+	case encFixed32:
+		return 4
+	case encFixed64:
+		return 8
+	}
+	return sizeVarint(x)
+}
+
+func appendScalar(b []byte, enc encoding, x uint64) []byte {
+	switch enc {
+	case encFixed32:
+		return binary.LittleEndian.AppendUint32(b, uint32(x))
+	case encFixed64:
+		return binary.LittleEndian.AppendUint64(b, x)
+	}
+	return binary.AppendUvarint(b, x)
+}
+
+func appendTag(b []byte, num, wtyp int) []byte {
+	return binary.AppendUvarint(b, uint64(num)<<3|uint64(wtyp))
+}
+
+func sizeVarint(x uint64) int {
+	return (bits.Len64(x|1) + 6) / 7
+}
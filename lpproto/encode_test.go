@@ -0,0 +1,99 @@
+package lpproto
+
+import (
+	"math"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	memorypool "github.com/userpro/linearpool"
+	"github.com/userpro/linearpool/internal/race"
+)
+
+func newMessage(ac *memorypool.Allocator) *Message {
+	kind := KindB
+	return &Message{
+		Id:      150,
+		Neg:     -2,
+		Flag:    true,
+		F32:     1.5,
+		F64:     -2.25,
+		S32:     -64,
+		Sfix:    -2,
+		Name:    "hello",
+		Data:    []byte{0, 1, 2},
+		Inner:   &Inner{Name: "in", Value: math.MinInt64},
+		Nums:    []int32{1, -1, 300, 0},
+		Fixeds:  []uint64{7, math.MaxUint64},
+		Names:   []string{"a", ""},
+		Items:   []*Inner{{Name: "x", Value: -3}, {}, nil},
+		Kind:    KindA,
+		Attrs:   map[string]int32{"k": 5, "z": 0, "": -1},
+		Opt:     ac.Int32(0),
+		OptS:    ac.String(""),
+		OptKind: &kind,
+		Chunks:  [][]byte{[]byte("c1"), {}},
+		Big:     math.MaxUint64,
+		ByID:    map[int64]*Inner{9: {Name: "in", Value: -3}, -10: {}},
+		Flags:   []bool{true, false, true},
+		Zigs:    []int64{math.MinInt64, math.MaxInt64},
+		Floats:  []float32{0.5, float32(math.Inf(-1))},
+		OptF:    ac.Float64(3),
+		Extra:   map[uint32]float64{4: 4.5},
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	ac := memorypool.NewAlloctorFromPool(0)
+
+	b, err := Marshal(ac, &Inner{Name: "in", Value: -3})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []byte(wire{}.bytes(1, []byte("in")).varint(2, zigzag(-3))), b)
+	b, err = Marshal(ac, Message{Id: 150})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []byte{0x08, 0x96, 0x01}, b)
+	b, err = Marshal(ac, Message{Nums: []int32{3, 270}})
+	assert.Nil(t, err)
+	assert.EqualValues(t, []byte{0x5a, 0x03, 0x03, 0x8e, 0x02}, b)
+
+	// 零值不输出
+	b, err = Marshal(ac, &Message{Inner: nil, Data: []byte{}, Nums: []int32{}})
+	assert.Nil(t, err)
+	assert.Nil(t, b)
+	b, err = Marshal(ac, (*Message)(nil))
+	assert.Nil(t, err)
+	assert.Nil(t, b)
+	_, err = Marshal(ac, 1)
+	assert.NotNil(t, err)
+
+	// 与 Unmarshal 往返
+	m := newMessage(ac)
+	b, err = Marshal(ac, m)
+	assert.Nil(t, err)
+	assert.EqualValues(t, len(b), cap(b))
+	runtime.GC()
+	var got Message
+	assert.Nil(t, Unmarshal(ac, b, &got))
+	m.Items[2] = &Inner{} // nil 元素编码为空消息
+	assert.EqualValues(t, *m, got)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestMarshalNoHeapAlloc(t *testing.T) {
+	if race.Enabled {
+		t.Skip("sync.Pool drops objects randomly under the race detector")
+	}
+	ac := memorypool.NewAlloctorFromPool(0)
+	m := newMessage(ac)
+	m.Attrs, m.ByID, m.Extra = nil, nil, nil // map 的迭代器会分配
+	_, err := Marshal(ac, m)
+	assert.Nil(t, err)
+
+	n := testing.AllocsPerRun(100, func() {
+		_, _ = Marshal(ac, m)
+	})
+	assert.EqualValues(t, 0, n)
+
+	runtime.KeepAlive(ac)
+}
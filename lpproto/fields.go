@@ -0,0 +1,152 @@
+package lpproto
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// encoding 字段在 tag 中声明的编码方式
+type encoding uint8
+
+const (
+	encVarint encoding = iota
+	encZigzag32
+	encZigzag64
+	encFixed32
+	encFixed64
+	encBytes
+)
+
+// wire type
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+func (e encoding) wireType() int {
+	switch e {
+	case encFixed32:
+		return wireFixed32
+	case encFixed64:
+		return wireFixed64
+	case encBytes:
+		return wireBytes
+	}
+	return wireVarint
+}
+
+// fieldInfo 由 `protobuf:"..."` tag 描述的字段
+type fieldInfo struct {
+	num    int
+	index  int // 结构体字段下标
+	name   string
+	enc    encoding
+	rep    bool
+	packed bool
+	proto3 bool
+	typ    reflect.Type
+
+	key, val *fieldInfo // map 的 key/value
+}
+
+type messageInfo struct {
+	fields []fieldInfo // 按字段号排序
+}
+
+// field 按字段号查找
+func (m *messageInfo) field(num int) *fieldInfo {
+	i := sort.Search(len(m.fields), func(i int) bool { return m.fields[i].num >= num })
+	if i < len(m.fields) && m.fields[i].num == num {
+		return &m.fields[i]
+	}
+	return nil
+}
+
+var messageCache sync.Map // reflect.Type -> *messageInfo
+
+// cachedMessageInfo 解析结构体 t 的 protobuf tag, 结果按类型缓存. 没有 protobuf tag 的字段
+// (包括 oneof 和生成代码中的内部字段)会被忽略
+func cachedMessageInfo(t reflect.Type) (*messageInfo, error) {
+	if m, ok := messageCache.Load(t); ok {
+		return m.(*messageInfo), nil
+	}
+	m := &messageInfo{}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("protobuf")
+		if tag == "" {
+			continue
+		}
+		f, err := parseTag(tag)
+		if err != nil {
+			return nil, fmt.Errorf("lpproto: %v.%s: %w", t, sf.Name, err)
+		}
+		f.index = i
+		f.name = sf.Name
+		f.typ = sf.Type
+		if sf.Type.Kind() == reflect.Map {
+			if f.key, err = parseTag(sf.Tag.Get("protobuf_key")); err != nil {
+				return nil, fmt.Errorf("lpproto: %v.%s key: %w", t, sf.Name, err)
+			}
+			if f.val, err = parseTag(sf.Tag.Get("protobuf_val")); err != nil {
+				return nil, fmt.Errorf("lpproto: %v.%s value: %w", t, sf.Name, err)
+			}
+			f.key.typ, f.val.typ = sf.Type.Key(), sf.Type.Elem()
+		}
+		m.fields = append(m.fields, *f)
+	}
+	sort.Slice(m.fields, func(i, j int) bool { return m.fields[i].num < m.fields[j].num })
+
+	v, _ := messageCache.LoadOrStore(t, m)
+	return v.(*messageInfo), nil
+}
+
+// parseTag 解析形如 "varint,1,opt,name=id,proto3" 的 tag
+func parseTag(tag string) (*fieldInfo, error) {
+	parts := strings.Split(tag, ",")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid protobuf tag %q", tag)
+	}
+
+	f := &fieldInfo{}
+	switch parts[0] {
+	case "varint":
+		f.enc = encVarint
+	case "zigzag32":
+		f.enc = encZigzag32
+	case "zigzag64":
+		f.enc = encZigzag64
+	case "fixed32":
+		f.enc = encFixed32
+	case "fixed64":
+		f.enc = encFixed64
+	case "bytes":
+		f.enc = encBytes
+	default: // group 已废弃, 不支持
+		return nil, fmt.Errorf("unsupported encoding %q", parts[0])
+	}
+
+	num, err := strconv.Atoi(parts[1])
+	if err != nil || num <= 0 {
+		return nil, fmt.Errorf("invalid field number in %q", tag)
+	}
+	f.num = num
+
+	for _, p := range parts[2:] {
+		switch p {
+		case "rep":
+			f.rep = true
+		case "packed":
+			f.packed = true
+		case "proto3":
+			f.proto3 = true
+		}
+	}
+	return f, nil
+}
@@ -0,0 +1,331 @@
+// Package lpsql 把 database/sql 的查询结果扫描到分配在内存池中的结构体切片.
+//
+// 每一列通过实现 sql.Scanner 的 column 直接拿到驱动返回的值, 文本和二进制列拷贝进 Allocator,
+// 不经过 database/sql 为 *string/*[]byte 做的逐格堆分配.
+package lpsql
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	memorypool "github.com/userpro/linearpool"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// ScanRows 读取 rows 剩下的所有行, 追加到 dest 指向的切片中, dest 的类型为 *[]T 或 *[]*T, T 为结构体.
+//
+// 列按名字映射到字段, 名字来自字段的 `db:"name"` tag, 默认为 Go 字段名, 比较时不区分大小写,
+// `db:"-"` 忽略该字段, 没有对应字段的列被忽略.
+// 支持 string, []byte, bool, 整数, 浮点数, time.Time 以及它们的指针, 指针字段在 NULL 时为 nil,
+// 其他字段在 NULL 时为零值. 切片扩容, 行结构体, 字符串和 []byte 都从 ac 分配, 生命周期同 ac.
+// ScanRows 不关闭 rows
+func ScanRows(ac *memorypool.Allocator, rows *sql.Rows, dest any) error {
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Pointer || dv.IsNil() || dv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("lpsql: ScanRows(non-nil pointer to slice expected, got %T)", dest)
+	}
+	slice := dv.Elem()
+	et := slice.Type().Elem()
+	byPtr := et.Kind() == reflect.Pointer
+	if byPtr {
+		et = et.Elem()
+	}
+	if et.Kind() != reflect.Struct {
+		return fmt.Errorf("lpsql: ScanRows(slice of struct expected, got %T)", dest)
+	}
+
+	names, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	cols, err := newColumns(ac, et, names)
+	if err != nil {
+		return err
+	}
+	args := make([]any, len(cols))
+	for i := range cols {
+		args[i] = &cols[i]
+	}
+
+	for rows.Next() {
+		// 容量不足时按两倍从内存池扩容
+		n := slice.Len()
+		if n == slice.Cap() {
+			c := 2 * n
+			if c < 8 {
+				c = 8
+			}
+			ac.ReallocSlice(slice, c)
+		}
+		slice.SetLen(n + 1)
+		row := slice.Index(n)
+		if byPtr {
+			row.Set(ac.NewValue(et))
+			row = row.Elem()
+		} else {
+			row.SetZero()
+		}
+
+		for i := range cols {
+			if cols[i].index >= 0 {
+				cols[i].field = row.Field(cols[i].index)
+			}
+		}
+		if err := rows.Scan(args...); err != nil {
+			slice.SetLen(n)
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// column 一列对应的字段, 作为 rows.Scan 的参数直接接收驱动返回的值
+type column struct {
+	ac    *memorypool.Allocator
+	name  string
+	index int           // 字段下标, -1 表示忽略这一列
+	field reflect.Value // 当前行的字段
+}
+
+func newColumns(ac *memorypool.Allocator, t reflect.Type, names []string) ([]column, error) {
+	cols := make([]column, len(names))
+	for i, name := range names {
+		cols[i] = column{ac: ac, name: name, index: -1}
+	}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(sf.Tag.Get("db"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		for j := range cols {
+			if cols[j].index < 0 && strings.EqualFold(cols[j].name, name) {
+				if !supported(sf.Type) {
+					return nil, fmt.Errorf("lpsql: unsupported type %v of field %s", sf.Type, sf.Name)
+				}
+				cols[j].index = i
+				break
+			}
+		}
+	}
+	return cols, nil
+}
+
+func supported(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Uint8
+	}
+	return false
+}
+
+// Scan 实现 sql.Scanner. src 为驱动返回的 int64, float64, bool, []byte, string, time.Time 或 nil,
+// 其中 []byte 只在本次调用内有效, 需要拷贝进内存池
+func (c *column) Scan(src any) error {
+	if c.index < 0 {
+		return nil
+	}
+	if err := c.set(c.field, src); err != nil {
+		return fmt.Errorf("lpsql: column %q: %w", c.name, err)
+	}
+	return nil
+}
+
+func (c *column) set(v reflect.Value, src any) error {
+	if src == nil {
+		v.SetZero()
+		return nil
+	}
+	if v.Kind() == reflect.Pointer {
+		v.Set(c.ac.NewValue(v.Type().Elem()))
+		v = v.Elem()
+	}
+
+	if v.Type() == timeType {
+		var t time.Time
+		switch s := src.(type) {
+		case time.Time:
+			t = s
+		case []byte:
+			return c.parseTime(v, memorypool.BytesToString(s))
+		case string:
+			return c.parseTime(v, s)
+		default:
+			return fmt.Errorf("cannot convert %T to time.Time", src)
+		}
+		c.setTime(v, t)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		switch s := src.(type) {
+		case []byte:
+			v.SetString(c.ac.NewString(memorypool.BytesToString(s)))
+		case string:
+			v.SetString(c.ac.NewString(s))
+		default:
+			var buf [64]byte
+			v.SetString(c.ac.NewString(memorypool.BytesToString(appendValue(buf[:0], src))))
+		}
+	case reflect.Slice:
+		var b []byte
+		switch s := src.(type) {
+		case []byte:
+			b = c.ac.Bytes(s)
+		case string:
+			b = c.ac.Bytes(memorypool.StringToBytes(s))
+		default:
+			var buf [64]byte
+			b = c.ac.Bytes(appendValue(buf[:0], src))
+		}
+		if b == nil {
+			// 空字符串不是 NULL, 同样返回非 nil 的空切片
+			c.ac.ReallocSlice(v, 0)
+		} else {
+			v.SetBytes(b)
+		}
+	case reflect.Bool:
+		switch s := src.(type) {
+		case bool:
+			v.SetBool(s)
+		case int64:
+			if s != 0 && s != 1 {
+				return fmt.Errorf("cannot convert %d to bool", s)
+			}
+			v.SetBool(s == 1)
+		default:
+			str, err := text(src)
+			if err != nil {
+				return err
+			}
+			b, err := strconv.ParseBool(str)
+			if err != nil {
+				return err
+			}
+			v.SetBool(b)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		switch s := src.(type) {
+		case int64:
+			i = s
+			if v.OverflowInt(i) {
+				return fmt.Errorf("value %d overflows %v", s, v.Type())
+			}
+		default:
+			str, err := text(src)
+			if err != nil {
+				return err
+			}
+			if i, err = strconv.ParseInt(str, 10, v.Type().Bits()); err != nil {
+				return err
+			}
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var u uint64
+		switch s := src.(type) {
+		case int64:
+			if s < 0 || v.OverflowUint(uint64(s)) {
+				return fmt.Errorf("value %d overflows %v", s, v.Type())
+			}
+			u = uint64(s)
+		default:
+			str, err := text(src)
+			if err != nil {
+				return err
+			}
+			if u, err = strconv.ParseUint(str, 10, v.Type().Bits()); err != nil {
+				return err
+			}
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		switch s := src.(type) {
+		case float64:
+			f = s
+			if v.OverflowFloat(s) {
+				return fmt.Errorf("value %v overflows %v", s, v.Type())
+			}
+		case int64:
+			f = float64(s)
+		default:
+			str, err := text(src)
+			if err != nil {
+				return err
+			}
+			if f, err = strconv.ParseFloat(str, v.Type().Bits()); err != nil {
+				return err
+			}
+		}
+		v.SetFloat(f)
+	}
+	return nil
+}
+
+func (c *column) parseTime(v reflect.Value, s string) error {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return err
+	}
+	c.setTime(v, t)
+	return nil
+}
+
+// setTime 写入 time.Time. 内存池不被 GC 扫描, 时区可能是堆上的 *time.Location, 需要保活
+func (c *column) setTime(v reflect.Value, t time.Time) {
+	if t.Location() != time.UTC && t.Location() != time.Local {
+		c.ac.KeepAlive(t.Location())
+	}
+	*(*time.Time)(v.Addr().UnsafePointer()) = t
+}
+
+// text 文本或二进制列的内容
+func text(src any) (string, error) {
+	switch s := src.(type) {
+	case []byte:
+		return memorypool.BytesToString(s), nil
+	case string:
+		return s, nil
+	}
+	return "", fmt.Errorf("unsupported source type %T", src)
+}
+
+// appendValue 数值, 布尔和时间列的文本形式, 同 database/sql 扫描到 *string 的结果
+func appendValue(b []byte, src any) []byte {
+	switch s := src.(type) {
+	case int64:
+		return strconv.AppendInt(b, s, 10)
+	case float64:
+		return strconv.AppendFloat(b, s, 'g', -1, 64)
+	case bool:
+		return strconv.AppendBool(b, s)
+	case time.Time:
+		return s.AppendFormat(b, time.RFC3339Nano)
+	}
+	return fmt.Appendf(b, "%v", src)
+}
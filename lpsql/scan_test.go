@@ -0,0 +1,184 @@
+package lpsql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	memorypool "github.com/userpro/linearpool"
+)
+
+// fakeDriver 进程内的 database/sql 驱动, 查询语句直接作为结果集的名字
+type fakeDriver struct{}
+
+type fakeResult struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+var fakeResults = map[string]fakeResult{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) {
+	r, ok := fakeResults[query]
+	if !ok {
+		return nil, errors.New("unknown query " + query)
+	}
+	return fakeStmt{r}, nil
+}
+func (fakeConn) Close() error              { return nil }
+func (fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+type fakeStmt struct{ r fakeResult }
+
+func (fakeStmt) Close() error  { return nil }
+func (fakeStmt) NumInput() int { return -1 }
+func (fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &fakeRows{r: s.r}, nil
+}
+
+type fakeRows struct {
+	r   fakeResult
+	i   int
+	buf [][]byte
+}
+
+func (r *fakeRows) Columns() []string { return r.r.columns }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.i >= len(r.r.rows) {
+		return io.EOF
+	}
+	if r.buf == nil {
+		r.buf = make([][]byte, len(r.r.columns))
+	}
+	for i, v := range r.r.rows[r.i] {
+		// 同真实驱动一样, []byte 复用每一列的缓冲区, 只在下一次 Next 之前有效
+		if b, ok := v.([]byte); ok && b != nil {
+			r.buf[i] = append(r.buf[i][:0], b...)
+			v = r.buf[i]
+		}
+		dest[i] = v
+	}
+	r.i++
+	return nil
+}
+
+func init() {
+	sql.Register("lpsqltest", fakeDriver{})
+}
+
+type user struct {
+	ID       int64      `db:"id"`
+	Name     string     `db:"name"`
+	Email    *string    `db:"email"`
+	Avatar   []byte     `db:"avatar"`
+	Age      uint8      `db:"age"`
+	Score    float32    `db:"score"`
+	Active   bool       `db:"active"`
+	Created  time.Time  `db:"created_at"`
+	Deleted  *time.Time `db:"deleted_at"`
+	Nickname string
+	Ignored  string `db:"-"`
+	note     string
+}
+
+func openDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("lpsqltest", "")
+	assert.Nil(t, err)
+	return db
+}
+
+func TestScanRows(t *testing.T) {
+	created := time.Date(2023, 5, 1, 12, 0, 0, 500, time.FixedZone("X", 3600))
+	fakeResults["users"] = fakeResult{
+		columns: []string{"id", "name", "email", "avatar", "age", "score", "active", "created_at", "deleted_at", "NICKNAME", "unknown", "Ignored"},
+		rows: [][]driver.Value{
+			{int64(1), []byte("alice"), []byte("a@x.com"), []byte{1, 2}, int64(30), 1.5, true, created, nil, "ally", int64(7), "x"},
+			{int64(2), "bob", nil, []byte{}, []byte("40"), int64(2), int64(0), []byte("2023-05-02T00:00:00Z"), created, nil, nil, nil},
+			{int64(3), int64(42), "", nil, "1", "0.25", []byte("true"), "2023-05-03T00:00:00+08:00", nil, []byte(""), "y", "z"},
+		},
+	}
+	db := openDB(t)
+	defer db.Close()
+
+	ac := memorypool.NewAlloctorFromPool(0)
+	rows, err := db.Query("users")
+	assert.Nil(t, err)
+	var users []user
+	assert.Nil(t, ScanRows(ac, rows, &users))
+	assert.Nil(t, rows.Close())
+	runtime.GC()
+
+	email := "a@x.com"
+	empty := ""
+	assert.Len(t, users, 3)
+	assert.EqualValues(t, user{ID: 1, Name: "alice", Email: &email, Avatar: []byte{1, 2}, Age: 30, Score: 1.5, Active: true, Created: created, Nickname: "ally"}, users[0])
+	assert.EqualValues(t, user{ID: 2, Name: "bob", Avatar: []byte{}, Age: 40, Score: 2, Created: time.Date(2023, 5, 2, 0, 0, 0, 0, time.UTC), Deleted: &created}, users[1])
+	assert.True(t, users[2].Created.Equal(time.Date(2023, 5, 2, 16, 0, 0, 0, time.UTC)))
+	users[2].Created = time.Time{}
+	assert.EqualValues(t, user{ID: 3, Name: "42", Email: &empty, Age: 1, Score: 0.25, Active: true}, users[2])
+	assert.Nil(t, users[2].Avatar)
+
+	// 追加到已有的切片, 元素为指针
+	rows, err = db.Query("users")
+	assert.Nil(t, err)
+	ptrs := []*user{{ID: 100}}
+	assert.Nil(t, ScanRows(ac, rows, &ptrs))
+	assert.Nil(t, rows.Close())
+	runtime.GC()
+	assert.Len(t, ptrs, 4)
+	assert.EqualValues(t, 100, ptrs[0].ID)
+	assert.EqualValues(t, users[0], *ptrs[1])
+	assert.EqualValues(t, "bob", ptrs[2].Name)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestScanRowsErrors(t *testing.T) {
+	fakeResults["bad"] = fakeResult{
+		columns: []string{"id", "age"},
+		rows: [][]driver.Value{
+			{int64(1), int64(10)},
+			{int64(2), int64(300)},
+		},
+	}
+	fakeResults["funcs"] = fakeResult{columns: []string{"f"}}
+	db := openDB(t)
+	defer db.Close()
+	ac := memorypool.NewAlloctorFromPool(0)
+
+	rows, err := db.Query("bad")
+	assert.Nil(t, err)
+	var users []user
+	err = ScanRows(ac, rows, &users)
+	assert.ErrorContains(t, err, `lpsql: column "age"`)
+	assert.Len(t, users, 1)
+	rows.Close()
+
+	for _, dest := range []any{users, &[]int{}, new(int), nil} {
+		rows, err := db.Query("bad")
+		assert.Nil(t, err)
+		assert.NotNil(t, ScanRows(ac, rows, dest))
+		rows.Close()
+	}
+
+	rows, err = db.Query("funcs")
+	assert.Nil(t, err)
+	var fs []struct{ F func() }
+	assert.ErrorContains(t, ScanRows(ac, rows, &fs), "unsupported type")
+	rows.Close()
+
+	runtime.KeepAlive(ac)
+}
@@ -0,0 +1,342 @@
+package memorypool
+
+import (
+	"hash/maphash"
+	"math"
+	"reflect"
+	"sync"
+	"unsafe"
+)
+
+const (
+	mapMinSize  = 8
+	mapUsedFlag = uint64(1) << 63 // entry.hash 最高位标记该槽位已占用
+)
+
+// Map 开放寻址(线性探测)哈希表, 槽位数组从 Allocator 分配.
+// string 类型的 key 会通过 NewString 拷贝进内存池; 其他含指针的 key(结构体, 数组, interface 等)
+// 插入时在堆上保留一份副本并 KeepAlive, 保证其引用的对象存活. value 不做拷贝,
+// 其中引用的堆对象需要调用方自行保证存活(例如 KeepAlive).
+// Map 的生命周期不能超过创建它的 Allocator.
+type Map[K comparable, V any] struct {
+	ac      *Allocator
+	entries []mapEntry[K, V]
+	count   int
+	hash    hasher
+	strKey  bool
+	ptrKey  bool // key 含指针且不是 string, 插入时需要保活
+}
+
+type mapEntry[K comparable, V any] struct {
+	hash uint64
+	key  K
+	val  V
+}
+
+// NewMap 新建 Map, hint 为预计元素个数
+func NewMap[K comparable, V any](ac *Allocator, hint int) *Map[K, V] {
+	var k K
+	t := reflect.TypeOf(&k).Elem()
+	m := New[Map[K, V]](ac)
+	m.ac = ac
+	m.hash = typeHasher(t)
+	m.strKey = t.Kind() == reflect.String
+	m.ptrKey = !m.strKey && !pointerFree(t)
+	m.entries = m.newEntries(mapSizeFor(hint))
+	return m
+}
+
+func mapSizeFor(hint int) int {
+	n := mapMinSize
+	for n*3/4 < hint {
+		n <<= 1
+	}
+	return n
+}
+
+func (m *Map[K, V]) newEntries(n int) []mapEntry[K, V] {
+	s := NewSlice[mapEntry[K, V]](m.ac, n, n)
+	memclrNoHeapPointers(unsafe.Pointer(&s[0]), uintptr(n)*unsafe.Sizeof(s[0]))
+	return s
+}
+
+func (m *Map[K, V]) hashKey(k *K) uint64 {
+	return m.hash(noescape(unsafe.Pointer(k))) | mapUsedFlag
+}
+
+// noescape 隐藏指针, 避免 key 因为传给 hasher 闭包而逃逸到堆上. hasher 不会保存 p
+//
+//go:nosplit
+func noescape(p unsafe.Pointer) unsafe.Pointer {
+	x := uintptr(p)
+	return *(*unsafe.Pointer)(unsafe.Pointer(&x))
+}
+
+func (m *Map[K, V]) find(k K, h uint64) int {
+	mask := len(m.entries) - 1
+	for i := int(h) & mask; ; i = (i + 1) & mask {
+		e := &m.entries[i]
+		if e.hash == 0 {
+			return -1
+		}
+		if e.hash == h && e.key == k {
+			return i
+		}
+	}
+}
+
+// Len 元素个数
+func (m *Map[K, V]) Len() int {
+	return m.count
+}
+
+// Get 查找 key
+func (m *Map[K, V]) Get(k K) (v V, ok bool) {
+	if i := m.find(k, m.hashKey(&k)); i >= 0 {
+		return m.entries[i].val, true
+	}
+	return v, false
+}
+
+// Set 插入或更新 key
+func (m *Map[K, V]) Set(k K, v V) {
+	e, _ := m.findOrInsert(k)
+	e.val = v
+}
+
+// findOrInsert 查找 key, 不存在时插入零值. 返回的指针在下一次插入之前有效
+func (m *Map[K, V]) findOrInsert(k K) (*mapEntry[K, V], bool) {
+	h := m.hashKey(&k)
+	if i := m.find(k, h); i >= 0 {
+		return &m.entries[i], false
+	}
+
+	if (m.count+1)*4 > len(m.entries)*3 {
+		m.grow()
+	}
+	if m.strKey {
+		s := (*string)(unsafe.Pointer(&k))
+		*s = m.ac.NewString(*s)
+	} else if m.ptrKey {
+		// 内存池不被 GC 扫描, 用堆上的副本保活 key 引用的对象
+		p := new(K)
+		*p = k
+		m.ac.KeepAlive(p)
+	}
+	var zero V
+	i := m.insert(h, k, zero)
+	m.count++
+	return &m.entries[i], true
+}
+
+func (m *Map[K, V]) insert(h uint64, k K, v V) int {
+	mask := len(m.entries) - 1
+	i := int(h) & mask
+	for m.entries[i].hash != 0 {
+		i = (i + 1) & mask
+	}
+	m.entries[i] = mapEntry[K, V]{hash: h, key: k, val: v}
+	return i
+}
+
+// grow 扩容为原来的两倍, 旧的槽位数组留在内存池中直到 Reset
+func (m *Map[K, V]) grow() {
+	old := m.entries
+	m.entries = m.newEntries(len(old) * 2)
+	for i := range old {
+		if e := &old[i]; e.hash != 0 {
+			m.insert(e.hash, e.key, e.val)
+		}
+	}
+}
+
+// Delete 删除 key, 返回 key 是否存在
+func (m *Map[K, V]) Delete(k K) bool {
+	i := m.find(k, m.hashKey(&k))
+	if i < 0 {
+		return false
+	}
+
+	// backward shift: 把后续同一探测链上的元素前移, 避免使用墓碑
+	mask := len(m.entries) - 1
+	for j := (i + 1) & mask; ; j = (j + 1) & mask {
+		e := &m.entries[j]
+		if e.hash == 0 {
+			break
+		}
+		home := int(e.hash) & mask
+		if (j-home)&mask >= (j-i)&mask {
+			m.entries[i] = *e
+			i = j
+		}
+	}
+	m.entries[i] = mapEntry[K, V]{}
+	m.count--
+	return true
+}
+
+// Range 遍历所有元素, f 返回 false 时停止. 遍历过程中不能修改 Map
+func (m *Map[K, V]) Range(f func(k K, v V) bool) {
+	for i := range m.entries {
+		if e := &m.entries[i]; e.hash != 0 {
+			if !f(e.key, e.val) {
+				return
+			}
+		}
+	}
+}
+
+//============================================================================
+// hasher
+//============================================================================
+
+type hasher func(p unsafe.Pointer) uint64
+
+var (
+	hashSeed    = maphash.MakeSeed()
+	hashSalt    = maphash.String(hashSeed, "linearpool")
+	hasherCache sync.Map // reflect.Type -> hasher, 同时保证 hasher 闭包不会被回收
+)
+
+func typeHasher(t reflect.Type) hasher {
+	if h, ok := hasherCache.Load(t); ok {
+		return h.(hasher)
+	}
+	h, _ := hasherCache.LoadOrStore(t, newHasher(t))
+	return h.(hasher)
+}
+
+func newHasher(t reflect.Type) hasher {
+	switch t.Kind() {
+	case reflect.String:
+		return hashString
+	case reflect.Float32:
+		return hashFloat32
+	case reflect.Float64:
+		return hashFloat64
+	case reflect.Complex64:
+		return func(p unsafe.Pointer) uint64 {
+			return hashMix(hashFloat32(p), hashFloat32(unsafe.Add(p, 4)))
+		}
+	case reflect.Complex128:
+		return func(p unsafe.Pointer) uint64 {
+			return hashMix(hashFloat64(p), hashFloat64(unsafe.Add(p, 8)))
+		}
+	case reflect.Interface:
+		return func(p unsafe.Pointer) uint64 {
+			return hashInterface(reflect.NewAt(t, p).Elem(), p)
+		}
+	case reflect.Array:
+		n, sz, eh := t.Len(), t.Elem().Size(), typeHasher(t.Elem())
+		return func(p unsafe.Pointer) uint64 {
+			h := hashSalt
+			for i := 0; i < n; i++ {
+				h = hashMix(h, eh(unsafe.Add(p, uintptr(i)*sz)))
+			}
+			return h
+		}
+	case reflect.Struct:
+		type field struct {
+			off uintptr
+			h   hasher
+		}
+		var fields []field
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.Name == "_" { // 比较时忽略空白字段
+				continue
+			}
+			fields = append(fields, field{off: f.Offset, h: typeHasher(f.Type)})
+		}
+		return func(p unsafe.Pointer) uint64 {
+			h := hashSalt
+			for _, f := range fields {
+				h = hashMix(h, f.h(unsafe.Add(p, f.off)))
+			}
+			return h
+		}
+	case reflect.Func, reflect.Map, reflect.Slice:
+		panic("memorypool: hash of unhashable type " + t.String())
+	default: // bool, 整数, 指针, chan
+		switch t.Size() {
+		case 1:
+			return func(p unsafe.Pointer) uint64 { return hashUint64(uint64(*(*uint8)(p))) }
+		case 2:
+			return func(p unsafe.Pointer) uint64 { return hashUint64(uint64(*(*uint16)(p))) }
+		case 4:
+			return func(p unsafe.Pointer) uint64 { return hashUint64(uint64(*(*uint32)(p))) }
+		default:
+			return func(p unsafe.Pointer) uint64 { return hashUint64(*(*uint64)(p)) }
+		}
+	}
+}
+
+func hashString(p unsafe.Pointer) uint64 {
+	return maphash.String(hashSeed, *(*string)(p))
+}
+
+func hashFloat32(p unsafe.Pointer) uint64 {
+	f := *(*float32)(p)
+	if f == 0 { // +0 == -0
+		return hashUint64(0)
+	}
+	return hashUint64(uint64(math.Float32bits(f)))
+}
+
+func hashFloat64(p unsafe.Pointer) uint64 {
+	f := *(*float64)(p)
+	if f == 0 {
+		return hashUint64(0)
+	}
+	return hashUint64(math.Float64bits(f))
+}
+
+// hashInterface 直接对 interface 中的动态值做哈希, p 指向 interface 本身.
+// interface 的第二个字是数据指针, 指针形状的类型直接存放在这个字中
+func hashInterface(v reflect.Value, p unsafe.Pointer) uint64 {
+	if v.IsNil() {
+		return hashSalt
+	}
+	t := v.Elem().Type()
+	if !t.Comparable() {
+		panic("memorypool: hash of unhashable type " + t.String())
+	}
+	data := unsafe.Add(p, unsafe.Sizeof(uintptr(0)))
+	if !directIface(t) {
+		data = *(*unsafe.Pointer)(data)
+	}
+	return typeHasher(t)(data)
+}
+
+// directIfaceTypes 缓存结构体是否直接存放在 interface 中, reflect.Type.Field 会分配内存
+var directIfaceTypes sync.Map // map[reflect.Type]bool
+
+// directIface 同编译器的 IsDirectIface: 指针形状的类型直接存放在 interface 的数据字中
+func directIface(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Chan, reflect.Map, reflect.Func, reflect.UnsafePointer:
+		return true
+	case reflect.Array:
+		return t.Len() == 1 && directIface(t.Elem())
+	case reflect.Struct:
+		if v, ok := directIfaceTypes.Load(t); ok {
+			return v.(bool)
+		}
+		direct := t.NumField() == 1 && directIface(t.Field(0).Type)
+		directIfaceTypes.Store(t, direct)
+		return direct
+	}
+	return false
+}
+
+// hashUint64 splitmix64
+func hashUint64(x uint64) uint64 {
+	x ^= hashSalt
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+func hashMix(h, x uint64) uint64 {
+	return hashUint64(h*31 + x)
+}
@@ -0,0 +1,153 @@
+package memorypool
+
+import (
+	"math"
+	"math/rand"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMap(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	m := NewMap[int, int](ac, 0)
+	ref := map[int]int{}
+	for i := 0; i < 50_000; i++ {
+		k := rand.Intn(5_000)
+		switch rand.Intn(3) {
+		case 0, 1:
+			m.Set(k, i)
+			ref[k] = i
+		case 2:
+			_, ok := ref[k]
+			assert.EqualValues(t, ok, m.Delete(k))
+			delete(ref, k)
+		}
+	}
+	runtime.GC()
+
+	assert.EqualValues(t, len(ref), m.Len())
+	for k, v := range ref {
+		got, ok := m.Get(k)
+		assert.True(t, ok)
+		assert.EqualValues(t, v, got)
+	}
+	n := 0
+	m.Range(func(k, v int) bool {
+		assert.EqualValues(t, ref[k], v)
+		n++
+		return true
+	})
+	assert.EqualValues(t, len(ref), n)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestMapStringKey(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	m := NewMap[string, int](ac, 16)
+	for i := 0; i < 1000; i++ {
+		m.Set("key"+strconv.Itoa(i), i) // 堆上的 key 会被拷贝进内存池
+	}
+	runtime.GC()
+
+	for i := 0; i < 1000; i++ {
+		v, ok := m.Get("key" + strconv.Itoa(i))
+		assert.True(t, ok)
+		assert.EqualValues(t, i, v)
+	}
+	_, ok := m.Get("key1000")
+	assert.False(t, ok)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestMapCompositeKey(t *testing.T) {
+	type key struct {
+		a string
+		f float64
+		i any
+	}
+	ac := NewAlloctorFromPool(0)
+	m := NewMap[key, string](ac, 0)
+	m.Set(key{a: "x", f: 0, i: 1}, "zero")
+	m.Set(key{a: "x", f: 1.5, i: "s"}, "one")
+
+	v, ok := m.Get(key{a: "x", f: math.Copysign(0, -1), i: 1})
+	assert.True(t, ok)
+	assert.EqualValues(t, "zero", v)
+	v, ok = m.Get(key{a: "x", f: 1.5, i: "s"})
+	assert.True(t, ok)
+	assert.EqualValues(t, "one", v)
+	_, ok = m.Get(key{a: "x", f: 1.5, i: 2})
+	assert.False(t, ok)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestMapPointerKey(t *testing.T) {
+	type key struct {
+		s string
+		p *int
+		a [2]string
+	}
+	ac := NewAlloctorFromPool(0)
+	m := NewMap[key, int](ac, 0)
+	for i := 0; i < 1000; i++ {
+		n := i
+		s := strconv.Itoa(i)
+		m.Set(key{s: "key" + s, p: &n, a: [2]string{s, "a" + s}}, i)
+	}
+	runtime.GC() // key 中的堆对象只被内存池引用
+	runtime.GC()
+
+	n := 0
+	m.Range(func(k key, v int) bool {
+		s := strconv.Itoa(v)
+		assert.EqualValues(t, key{s: "key" + s, p: k.p, a: [2]string{s, "a" + s}}, k)
+		assert.EqualValues(t, v, *k.p)
+		n++
+		return true
+	})
+	assert.EqualValues(t, 1000, n)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestMapInterfaceKey(t *testing.T) {
+	type direct struct{ p *int }
+	type indirect struct {
+		a int
+		s string
+	}
+	x := 7
+	ac := NewAlloctorFromPool(0)
+	m := NewMap[any, int](ac, 0)
+	keys := []any{nil, 1, int8(1), "1", 1.5, &x, direct{&x}, [1]*int{&x}, indirect{1, "s"}, [2]int{1, 2}, struct{}{}}
+	for i, k := range keys {
+		m.Set(k, i)
+	}
+	runtime.GC()
+
+	assert.EqualValues(t, len(keys), m.Len())
+	for i, k := range keys {
+		v, ok := m.Get(k)
+		assert.True(t, ok)
+		assert.EqualValues(t, i, v)
+	}
+	// 相等的值使用相同的哈希
+	y := 1
+	v, _ := m.Get(indirect{y, strconv.Itoa(y)[:0] + "s"})
+	assert.EqualValues(t, 8, v)
+	_, ok := m.Get(direct{&y})
+	assert.False(t, ok)
+	assert.Panics(t, func() { m.Get([]int{}) })
+
+	// 对动态值直接哈希, 不分配内存
+	var k any = indirect{1, "s"}
+	assert.EqualValues(t, 0, testing.AllocsPerRun(100, func() { m.Get(k) }))
+
+	runtime.KeepAlive(ac)
+}
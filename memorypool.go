@@ -3,6 +3,7 @@ package memorypool
 import (
 	"fmt"
 	"reflect"
+	"strings"
 	"sync"
 	"unsafe"
 )
@@ -12,6 +13,7 @@ const (
 	DiMB             int64 = DiKB << 10
 	DiGB             int64 = DiMB << 10
 	defaultBlockSize int64 = DiKB * 4 // 4KB/block
+	minBytesCap            = 16       // growBytes 最小容量
 )
 
 var (
@@ -34,6 +36,12 @@ type Allocator struct {
 	hugeBlocks []*sliceHeader
 	bidx       int // 当前在第几个 block 进行分配
 
+	// string/[]byte 等字节数据单独存放在 packed block 中, 分配时不做对齐,
+	// 避免短字符串的对齐填充浪费内存, 也不会打散存放结构体的 block
+	packBlock    *sliceHeader
+	packBlocks   []*sliceHeader
+	paddingSaved int64 // packed 分配相对于对齐分配节省的字节数
+
 	externalPtr    []unsafe.Pointer
 	externalSlice  []unsafe.Pointer
 	externalString []unsafe.Pointer
@@ -41,6 +49,8 @@ type Allocator struct {
 	externalFunc   []any
 
 	subAlloctor []*Allocator // 子分配器
+
+	internTables []any // Intern/InternValue 使用的去重表, 每种类型一个 *Map[T, struct{}]
 }
 
 // NewAlloctorFromPool 新建分配池, blocksize >= bsize
@@ -53,10 +63,12 @@ func NewAlloctorFromPool(bsize int64) *Allocator {
 	if ac.bidx < 0 { // 新建 alloctor
 		ac.blockSize = bsize
 		ac.newBlock()
+		ac.newPackBlock()
 	} else if ac.blockSize < bsize { // 如果准备复用的 blocksize 小于所需要的, 则需要重新分配
 		ac.clearBlock()
 		ac.blockSize = bsize
 		ac.newBlock()
+		ac.newPackBlock()
 	}
 	return ac
 }
@@ -87,6 +99,16 @@ func (ac *Allocator) newBlock() *sliceHeader {
 func (ac *Allocator) clearBlock() {
 	ac.curBlock = nil
 	ac.blocks = nil
+	ac.packBlock = nil
+	ac.packBlocks = nil
+}
+
+func (ac *Allocator) newPackBlock() *sliceHeader {
+	t := make([]byte, 0, ac.blockSize)
+	b := (*sliceHeader)(unsafe.Pointer(&t))
+	ac.packBlock = b
+	ac.packBlocks = append(ac.packBlocks, b)
+	return b
 }
 
 func (ac *Allocator) alloc(need int64) unsafe.Pointer {
@@ -94,11 +116,7 @@ func (ac *Allocator) alloc(need int64) unsafe.Pointer {
 		return nil
 	}
 
-	// round up
-	needAligned := need
-	if need%ptrSize != 0 {
-		needAligned = (need + ptrSize + 1) & ^(ptrSize - 1)
-	}
+	needAligned := allocSize(need)
 
 	// 分配小型对象
 	if ac.blockSize >= needAligned {
@@ -123,6 +141,104 @@ func (ac *Allocator) alloc(need int64) unsafe.Pointer {
 	return ptr
 }
 
+// allocSize 分配 need 字节时实际占用的大小(按指针大小对齐)
+func allocSize(need int64) int64 {
+	// round up
+	if need%ptrSize != 0 {
+		return (need + ptrSize - 1) & ^(ptrSize - 1)
+	}
+	return need
+}
+
+// allocBytes 从 packed block 分配 need 字节, 不做对齐, 分配到的内存不保证清零
+func (ac *Allocator) allocBytes(need int64) unsafe.Pointer {
+	if need == 0 {
+		return nil
+	}
+	ac.paddingSaved += allocSize(need) - need
+
+	// 分配巨型对象
+	if need > ac.blockSize {
+		b := ac.newBlockWithSz(need)
+		b.Len = b.Cap
+		return b.Data
+	}
+
+	b := ac.packBlock
+	if b == nil || b.Len+need > b.Cap {
+		b = ac.newPackBlock()
+	}
+	ptr := unsafe.Add(b.Data, b.Len)
+	b.Len += need
+	return ptr
+}
+
+// growInplace 如果 [ptr, ptr+oldSize) 是当前 packed block 最后一次分配的内存, 则原地扩展(或收缩)为 newSize
+func (ac *Allocator) growInplace(ptr unsafe.Pointer, oldSize, newSize int64) bool {
+	b := ac.packBlock
+	// 用 uintptr 比较, ptr+oldSize 可能越过 ptr 所在的对象, 不能构造成 unsafe.Pointer (checkptr)
+	if ptr == nil || b == nil || uintptr(ptr) < uintptr(b.Data) ||
+		uintptr(ptr)+uintptr(oldSize) != uintptr(b.Data)+uintptr(b.Len) {
+		return false
+	}
+
+	newLen := int64(uintptr(ptr)-uintptr(b.Data)) + newSize
+	if newLen > b.Cap {
+		return false
+	}
+	b.Len = newLen
+	return true
+}
+
+// growBytes 保证 buf 至少还能写入 n 个字节. buf 位于当前 packed block 尾部时原地扩容, 否则重新分配并拷贝
+func (ac *Allocator) growBytes(buf []byte, n int) []byte {
+	l, c := len(buf), cap(buf)
+	if l+n <= c {
+		return buf
+	}
+
+	h := (*sliceHeader)(unsafe.Pointer(&buf))
+	newCap := max(max(2*c, l+n), minBytesCap)
+	if ac.growInplace(h.Data, int64(c), int64(newCap)) {
+		h.Cap = int64(newCap)
+		return buf
+	}
+	if ac.growInplace(h.Data, int64(c), int64(l+n)) {
+		h.Cap = int64(l + n)
+		return buf
+	}
+
+	pre := *h
+	h.Data = ac.allocBytes(int64(newCap))
+	h.Cap = int64(newCap)
+	memmoveNoHeapPointers(h.Data, pre.Data, uintptr(pre.Len))
+	return buf
+}
+
+// trimBytes buf 位于当前 packed block 尾部时, 把未使用的容量归还给内存池
+func (ac *Allocator) trimBytes(buf []byte) []byte {
+	h := (*sliceHeader)(unsafe.Pointer(&buf))
+	if h.Len < h.Cap && ac.growInplace(h.Data, h.Cap, h.Len) {
+		h.Cap = h.Len
+	}
+	return buf
+}
+
+// allocChunk 把当前 block 剩余的空间整体分配出去, 剩余空间不足 min 时使用新的 block
+func (ac *Allocator) allocChunk(min int64) []byte {
+	b := ac.curBlock
+	if b.Cap-b.Len < min {
+		b = ac.newBlock()
+	}
+
+	var r []byte
+	h := (*sliceHeader)(unsafe.Pointer(&r))
+	h.Data = unsafe.Add(b.Data, b.Len)
+	h.Cap = b.Cap - b.Len
+	b.Len = b.Cap
+	return r
+}
+
 // Reset 重置内存信息
 func (ac *Allocator) Reset() {
 	ac.bidx = 0
@@ -136,12 +252,24 @@ func (ac *Allocator) Reset() {
 	ac.blocks = ac.blocks[:1]
 	ac.hugeBlocks = nil // 大对象直接释放 避免过多占用内存
 
+	// packed block 中只有字节数据, 不需要清零
+	if len(ac.packBlocks) > 0 {
+		for _, b := range ac.packBlocks {
+			b.Len = 0
+		}
+		ac.packBlocks = ac.packBlocks[:1]
+		ac.packBlock = ac.packBlocks[0]
+	}
+	ac.paddingSaved = 0
+
 	ac.externalPtr = ac.externalPtr[:0]
 	ac.externalSlice = ac.externalSlice[:0]
 	ac.externalString = ac.externalString[:0]
 	ac.externalMap = ac.externalMap[:0]
 	ac.externalFunc = ac.externalFunc[:0]
 
+	ac.internTables = resetSlice(ac.internTables)
+
 	for i, subAc := range ac.subAlloctor {
 		subAc.Reset()
 		ac.subAlloctor[i] = nil
@@ -165,6 +293,20 @@ func (ac *Allocator) AddSubAlloctor(sub *Allocator) {
 	ac.subAlloctor = append(ac.subAlloctor, sub)
 }
 
+// RemoveSubAlloctor 移除子分配器, 之后 ac 的 Reset 不再重置 sub, sub 可以单独归还分配池.
+// sub 不是 ac 的子分配器时返回 false
+func (ac *Allocator) RemoveSubAlloctor(sub *Allocator) bool {
+	for i, s := range ac.subAlloctor {
+		if s == sub {
+			n := copy(ac.subAlloctor[i:], ac.subAlloctor[i+1:])
+			ac.subAlloctor[i+n] = nil
+			ac.subAlloctor = ac.subAlloctor[:i+n]
+			return true
+		}
+	}
+	return false
+}
+
 // SubAlloctor 获取子分配器
 func (ac *Allocator) SubAlloctor() []*Allocator {
 	return ac.subAlloctor
@@ -175,6 +317,8 @@ func (ac *Allocator) Merge(src *Allocator) *Allocator {
 	ac.blocks = append(ac.blocks, src.blocks[:src.bidx+1]...)
 	ac.hugeBlocks = append(ac.hugeBlocks, src.hugeBlocks...)
 	ac.bidx = ac.bidx + src.bidx + 1
+	ac.packBlocks = append(ac.packBlocks, src.packBlocks...)
+	ac.paddingSaved += src.paddingSaved
 
 	ac.externalPtr = append(ac.externalPtr, src.externalPtr...)
 	ac.externalSlice = append(ac.externalSlice, src.externalSlice...)
@@ -208,6 +352,14 @@ func (ac *Allocator) KeepAlive(ptr interface{}) {
 	}
 }
 
+// keepAliveValue 在堆上保留 v 的副本并 KeepAlive, 保证存进内存池的 v 引用的对象存活.
+// 只对含指针的类型调用, 容器在创建时用 pointerFree 判断
+func keepAliveValue[T any](ac *Allocator, v T) {
+	p := new(T)
+	*p = v
+	ac.KeepAlive(p)
+}
+
 // New 分配新对象
 func New[T any](ac *Allocator) (r *T) {
 	r = (*T)(ac.alloc(int64(unsafe.Sizeof(*r))))
@@ -354,7 +506,7 @@ func (ac *Allocator) NewString(v string) string {
 		return ""
 	}
 	h := (*stringHeader)(unsafe.Pointer(&v))
-	ptr := ac.alloc(int64(h.Len))
+	ptr := ac.allocBytes(int64(h.Len))
 	if ptr != nil {
 		memmoveNoHeapPointers(ptr, h.Data, uintptr(h.Len))
 	}
@@ -362,6 +514,45 @@ func (ac *Allocator) NewString(v string) string {
 	return v
 }
 
+// newBytes 从 packed block 分配长度为 n 的 []byte, 用于构造字符串等字节数据, 内容不保证清零
+func (ac *Allocator) newBytes(n int) []byte {
+	var r []byte
+	h := (*sliceHeader)(unsafe.Pointer(&r))
+	h.Data = ac.allocBytes(int64(n))
+	h.Len = int64(n)
+	h.Cap = int64(n)
+	return r
+}
+
+// Stats 内存池使用情况
+type Stats struct {
+	Blocks       int   // 存放对齐数据的 block 数
+	PackedBlocks int   // 存放字节数据的 packed block 数
+	HugeBlocks   int   // 巨型 block 数
+	AlignedBytes int64 // 对齐 block 已使用的字节数
+	PackedBytes  int64 // packed block 已使用的字节数
+	HugeBytes    int64 // 巨型 block 已使用的字节数
+	PaddingSaved int64 // 字节数据不做对齐所节省的字节数
+}
+
+// Stats 获取内存池使用情况
+func (ac *Allocator) Stats() (s Stats) {
+	s.Blocks = len(ac.blocks)
+	for _, b := range ac.blocks {
+		s.AlignedBytes += b.Len
+	}
+	s.PackedBlocks = len(ac.packBlocks)
+	for _, b := range ac.packBlocks {
+		s.PackedBytes += b.Len
+	}
+	s.HugeBlocks = len(ac.hugeBlocks)
+	for _, b := range ac.hugeBlocks {
+		s.HugeBytes += b.Len
+	}
+	s.PaddingSaved = ac.paddingSaved
+	return s
+}
+
 // Debug 输出 debug 信息
 func (ac *Allocator) Debug() {
 	fmt.Printf("\n* bidx: %d\n", ac.bidx)
@@ -372,6 +563,14 @@ func (ac *Allocator) Debug() {
 		fmt.Printf(" - b[%d]: len(%d) cap(%d) addr[%p - %p] data: %v\n", i, b.Len, b.Cap, b.Data, unsafe.Add(b.Data, b.Cap-1), b1)
 	}
 
+	if len(ac.packBlocks) > 0 {
+		fmt.Printf("* packed blocks: \n")
+		for i, b := range ac.packBlocks {
+			b1 := *(*[]byte)(unsafe.Pointer(b))
+			fmt.Printf(" - pb[%d]: len(%d) cap(%d) addr[%p - %p] data: %q\n", i, b.Len, b.Cap, b.Data, unsafe.Add(b.Data, b.Cap-1), b1)
+		}
+	}
+
 	if len(ac.hugeBlocks) > 0 {
 		fmt.Printf("* huge blocks: \n")
 		for i, b := range ac.hugeBlocks {
@@ -448,3 +647,167 @@ func (ac *Allocator) String(v string) (r *string) {
 	*r = ac.NewString(v)
 	return
 }
+
+// Ptr 泛型版本的 optional 字段, 返回指向内存池中 v 的拷贝的指针.
+// T 中的指针不会被 GC 扫描, 指向的内存需要在内存池中或通过 KeepAlive 保活; 字符串请使用 ac.String
+func Ptr[T any](ac *Allocator, v T) *T {
+	r := New[T](ac)
+	*r = v
+	return r
+}
+
+// Enum 枚举类型的 optional 字段, 例如 Enum(ac, pb.Kind_A)
+func Enum[E ~int32](ac *Allocator, v E) *E {
+	return Ptr(ac, v)
+}
+
+// Bytes bytes 字段, 内容拷贝进内存池. proto2 中 nil 表示字段不存在, 因此 nil 返回 nil,
+// 长度为 0 的非 nil 切片返回非 nil 的空切片
+func (ac *Allocator) Bytes(v []byte) []byte {
+	if v == nil {
+		return nil
+	}
+	if len(v) == 0 {
+		return EmptySlice[byte]()
+	}
+	r := ac.newBytes(len(v))
+	copy(r, v)
+	return r
+}
+
+// Strings repeated string 字段, 切片和每个字符串都拷贝进内存池
+func (ac *Allocator) Strings(v []string) []string {
+	if v == nil {
+		return nil
+	}
+	if len(v) == 0 {
+		return EmptySlice[string]()
+	}
+	r := NewSlice[string](ac, len(v), len(v))
+	for i, s := range v {
+		r[i] = ac.NewString(s)
+	}
+	return r
+}
+
+// Bools repeated bool 字段
+func (ac *Allocator) Bools(v []bool) []bool {
+	return cloneSlice(ac, v)
+}
+
+// Int32s repeated int32 字段
+func (ac *Allocator) Int32s(v []int32) []int32 {
+	return cloneSlice(ac, v)
+}
+
+// Uint32s repeated uint32 字段
+func (ac *Allocator) Uint32s(v []uint32) []uint32 {
+	return cloneSlice(ac, v)
+}
+
+// Int64s repeated int64 字段
+func (ac *Allocator) Int64s(v []int64) []int64 {
+	return cloneSlice(ac, v)
+}
+
+// Uint64s repeated uint64 字段
+func (ac *Allocator) Uint64s(v []uint64) []uint64 {
+	return cloneSlice(ac, v)
+}
+
+// Float32s repeated float 字段
+func (ac *Allocator) Float32s(v []float32) []float32 {
+	return cloneSlice(ac, v)
+}
+
+// Float64s repeated double 字段
+func (ac *Allocator) Float64s(v []float64) []float64 {
+	return cloneSlice(ac, v)
+}
+
+// cloneSlice 拷贝不含指针的切片, 保持 nil 与空切片的区别
+func cloneSlice[T any](ac *Allocator, v []T) []T {
+	if v == nil {
+		return nil
+	}
+	if len(v) == 0 {
+		return EmptySlice[T]()
+	}
+	r := NewSlice[T](ac, len(v), len(v))
+	copy(r, v)
+	return r
+}
+
+// EmptySlice 长度为 0 的非 nil 切片, 与 nil 区分. 不占用内存, 所有类型共用同一个地址
+func EmptySlice[T any]() []T {
+	return unsafe.Slice((*T)(unsafe.Pointer(&zeroBase)), 0)
+}
+
+// SetOptional 把 v 设置到 msg (指向生成代码中结构体的指针) 名为 name 的 optional 字段.
+// name 可以是 Go 字段名, 也可以是 protobuf tag 中的 name. 字段类型为 *T 时 v 转换为 T 后
+// 分配在内存池中, 字段类型为 []byte 时拷贝内容; v 为 nil 时清空字段
+func (ac *Allocator) SetOptional(msg any, name string, v any) error {
+	rv := reflect.ValueOf(msg)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("SetOptional: non-nil pointer to struct expected, got %T", msg)
+	}
+	fv := optionalField(rv.Elem(), name)
+	if !fv.IsValid() {
+		return fmt.Errorf("SetOptional: %T has no field %q", msg, name)
+	}
+	if v == nil {
+		fv.SetZero()
+		return nil
+	}
+
+	x := reflect.ValueOf(v)
+	ft := fv.Type()
+	if ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Uint8 {
+		if x.Kind() != reflect.Slice || x.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("SetOptional: cannot use %T as %v", v, ft)
+		}
+		fv.SetBytes(ac.Bytes(x.Bytes()))
+		return nil
+	}
+	if ft.Kind() != reflect.Pointer {
+		return fmt.Errorf("SetOptional: field %q of type %v is not optional", name, ft)
+	}
+
+	et := ft.Elem()
+	switch et.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if x.Kind() == reflect.String || !x.Type().ConvertibleTo(et) {
+			return fmt.Errorf("SetOptional: cannot use %T as %v", v, et)
+		}
+		p := ac.NewValue(et)
+		p.Elem().Set(x.Convert(et))
+		fv.Set(p)
+	case reflect.String:
+		if x.Kind() != reflect.String {
+			return fmt.Errorf("SetOptional: cannot use %T as %v", v, et)
+		}
+		p := ac.NewValue(et)
+		p.Elem().SetString(ac.NewString(x.String()))
+		fv.Set(p)
+	default:
+		return fmt.Errorf("SetOptional: field %q of type %v is not a scalar", name, ft)
+	}
+	return nil
+}
+
+// optionalField 按 Go 字段名或 protobuf tag 中的 name 查找字段
+func optionalField(v reflect.Value, name string) reflect.Value {
+	t := v.Type()
+	if sf, ok := t.FieldByName(name); ok && len(sf.Index) == 1 && sf.IsExported() {
+		return v.Field(sf.Index[0])
+	}
+	for i := 0; i < t.NumField(); i++ {
+		for _, opt := range strings.Split(t.Field(i).Tag.Get("protobuf"), ",") {
+			if opt == "name="+name {
+				return v.Field(i)
+			}
+		}
+	}
+	return reflect.Value{}
+}
@@ -345,3 +345,136 @@ func TestSubAlloctor(t *testing.T) {
 	ac.KeepAlive(ac)
 	ac.KeepAlive(ac1)
 }
+
+func TestRemoveSubAlloctor(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	subs := []*Allocator{NewAlloctorFromPool(0), NewAlloctorFromPool(0), NewAlloctorFromPool(0)}
+	for _, sub := range subs {
+		ac.AddSubAlloctor(sub)
+	}
+	s := subs[1].NewString("keep")
+
+	assert.True(t, ac.RemoveSubAlloctor(subs[1]))
+	assert.False(t, ac.RemoveSubAlloctor(subs[1]))
+	assert.EqualValues(t, []*Allocator{subs[0], subs[2]}, ac.SubAlloctor())
+
+	// 移除后父分配器 Reset 不再影响 sub
+	ac.Reset()
+	assert.EqualValues(t, 0, len(ac.SubAlloctor()))
+	assert.EqualValues(t, "keep", s)
+	assert.NotZero(t, subs[1].Stats().PackedBytes)
+
+	subs[1].ReturnAlloctorToPool()
+	ac.ReturnAlloctorToPool()
+}
+
+func TestPackedString(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	a := New[testNew](ac)
+	strs := make([]string, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		strs = append(strs, ac.NewString(strconv.Itoa(i%10)+"ab")) // 3 字节, 对齐后为 8 字节
+	}
+	b := New[testNew](ac)
+	a.a, b.a = ac.NewString("a"), ac.NewString("b")
+	runtime.GC()
+
+	for i, s := range strs {
+		assert.EqualValues(t, strconv.Itoa(i%10)+"ab", s)
+	}
+	assert.EqualValues(t, "a", a.a)
+	assert.EqualValues(t, "b", b.a)
+
+	// 字符串不占用对齐 block, 结构体仍然连续分配
+	st := ac.Stats()
+	assert.EqualValues(t, 2*unsafe.Sizeof(testNew{}), st.AlignedBytes)
+	assert.EqualValues(t, 1000*3+2, st.PackedBytes)
+	assert.EqualValues(t, 1000*5+2*7, st.PaddingSaved)
+	assert.True(t, uintptr(unsafe.Pointer(b))-uintptr(unsafe.Pointer(a)) == unsafe.Sizeof(testNew{}))
+
+	ac.Reset()
+	st = ac.Stats()
+	assert.EqualValues(t, 0, st.PackedBytes)
+	assert.EqualValues(t, 0, st.PaddingSaved)
+	assert.EqualValues(t, 1, st.PackedBlocks)
+	assert.EqualValues(t, "xyz", ac.NewString("xyz"))
+
+	// 奇数长度只补齐到下一个指针大小
+	ac.Reset()
+	assert.EqualValues(t, "1234567", ac.NewString("1234567"))
+	assert.EqualValues(t, "123456789", ac.NewString("123456789"))
+	st = ac.Stats()
+	assert.EqualValues(t, 16, st.PackedBytes)
+	assert.EqualValues(t, 1+7, st.PaddingSaved)
+	assert.EqualValues(t, 8, allocSize(7))
+	assert.EqualValues(t, 16, allocSize(9))
+	assert.EqualValues(t, 16, allocSize(16))
+
+	runtime.KeepAlive(ac)
+}
+
+type testEnum int32
+
+type testPB2 struct {
+	Id    *int32      `protobuf:"varint,1,opt,name=id"`
+	Name  *string     `protobuf:"bytes,2,opt,name=user_name"`
+	Kind  *testEnum   `protobuf:"varint,3,opt,name=kind,enum=test.Enum"`
+	Data  []byte      `protobuf:"bytes,4,opt,name=data"`
+	Score *float64    `protobuf:"fixed64,5,opt,name=score"`
+	Tags  []string    `protobuf:"bytes,6,rep,name=tags"`
+	Next  *testPB2    `protobuf:"bytes,7,opt,name=next"`
+	state interface{} // 生成代码中的内部字段
+}
+
+func TestProtobuf2Helpers(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	name := []byte("dyn")
+	m := &testPB2{
+		Id:   Ptr(ac, int32(7)),
+		Name: ac.String(string(name)),
+		Kind: Enum(ac, testEnum(2)),
+		Data: ac.Bytes([]byte{1, 2}),
+		Tags: ac.Strings([]string{"a", string(name)}),
+	}
+	name[0] = 'x'
+	runtime.GC()
+	assert.EqualValues(t, 7, *m.Id)
+	assert.EqualValues(t, "dyn", *m.Name)
+	assert.EqualValues(t, 2, *m.Kind)
+	assert.EqualValues(t, []byte{1, 2}, m.Data)
+	assert.EqualValues(t, []string{"a", "dyn"}, m.Tags)
+
+	assert.Nil(t, ac.Bytes(nil))
+	assert.NotNil(t, ac.Bytes([]byte{}))
+	assert.Nil(t, ac.Strings(nil))
+	assert.Nil(t, ac.Int64s(nil))
+	assert.EqualValues(t, []int32{1, -1}, ac.Int32s([]int32{1, -1}))
+	assert.EqualValues(t, []uint64{1 << 63}, ac.Uint64s([]uint64{1 << 63}))
+	assert.EqualValues(t, []float32{0.5}, ac.Float32s([]float32{0.5}))
+	assert.EqualValues(t, []bool{true}, ac.Bools([]bool{true}))
+	assert.EqualValues(t, []float64{}, ac.Float64s([]float64{}))
+
+	assert.Nil(t, ac.SetOptional(m, "Id", 42))
+	assert.Nil(t, ac.SetOptional(m, "user_name", "n"))
+	assert.Nil(t, ac.SetOptional(m, "kind", 3))
+	assert.Nil(t, ac.SetOptional(m, "Data", []byte("d")))
+	assert.Nil(t, ac.SetOptional(m, "score", float32(1.5)))
+	runtime.GC()
+	assert.EqualValues(t, 42, *m.Id)
+	assert.EqualValues(t, "n", *m.Name)
+	assert.EqualValues(t, 3, *m.Kind)
+	assert.EqualValues(t, "d", string(m.Data))
+	assert.EqualValues(t, 1.5, *m.Score)
+
+	assert.Nil(t, ac.SetOptional(m, "Id", nil))
+	assert.Nil(t, m.Id)
+	assert.NotNil(t, ac.SetOptional(m, "Id", "42"))
+	assert.NotNil(t, ac.SetOptional(m, "user_name", 1))
+	assert.NotNil(t, ac.SetOptional(m, "Tags", "a"))
+	assert.NotNil(t, ac.SetOptional(m, "Next", testPB2{}))
+	assert.NotNil(t, ac.SetOptional(m, "missing", 1))
+	assert.NotNil(t, ac.SetOptional(m, "state", 1))
+	assert.NotNil(t, ac.SetOptional(*m, "Id", 1))
+
+	runtime.KeepAlive(ac)
+}
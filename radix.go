@@ -0,0 +1,185 @@
+package memorypool
+
+import (
+	"reflect"
+	"strings"
+)
+
+type radixNode[V any] struct {
+	label    string // 父节点到当前节点的边
+	key      string // 完整 key, 仅 hasVal 时有效
+	children []*radixNode[V]
+	val      V
+	hasVal   bool
+}
+
+// Radix 基数树(压缩前缀树), 节点从 Allocator 分配, 边上的 label 与 key 通过 NewString 拷贝进内存池,
+// 含指针的值会在堆上保留副本保活其引用的对象.
+// 重建时直接 Reset 内存池后重新插入即可.
+type Radix[V any] struct {
+	ac     *Allocator
+	root   radixNode[V]
+	len    int
+	ptrVal bool // V 含指针, 插入时需要保活
+}
+
+// NewRadix 新建基数树
+func NewRadix[V any](ac *Allocator) *Radix[V] {
+	t := New[Radix[V]](ac)
+	t.ac = ac
+	t.ptrVal = !pointerFree(reflect.TypeOf((*V)(nil)).Elem())
+	return t
+}
+
+// Len 元素个数
+func (t *Radix[V]) Len() int {
+	return t.len
+}
+
+// child 返回第一个 label[0] >= c 的子节点下标, 以及 label[0] == c 的子节点
+func (n *radixNode[V]) child(c byte) (int, *radixNode[V]) {
+	lo, hi := 0, len(n.children)
+	for lo < hi {
+		m := int(uint(lo+hi) >> 1)
+		if n.children[m].label[0] < c {
+			lo = m + 1
+		} else {
+			hi = m
+		}
+	}
+	if lo < len(n.children) && n.children[lo].label[0] == c {
+		return lo, n.children[lo]
+	}
+	return lo, nil
+}
+
+func (t *Radix[V]) addChild(n *radixNode[V], idx int, c *radixNode[V]) {
+	n.children = Append[*radixNode[V]](t.ac, n.children, nil)
+	copy(n.children[idx+1:], n.children[idx:])
+	n.children[idx] = c
+}
+
+func (t *Radix[V]) setVal(n *radixNode[V], key string, v V) {
+	if !n.hasVal {
+		n.key = t.ac.NewString(key)
+		n.hasVal = true
+		t.len++
+	}
+	n.val = v
+	if t.ptrVal {
+		keepAliveValue(t.ac, v)
+	}
+}
+
+func commonPrefixLen(a, b string) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
+
+// Insert 插入或更新 key
+func (t *Radix[V]) Insert(key string, v V) {
+	n, s := &t.root, key
+	for {
+		if len(s) == 0 {
+			t.setVal(n, key, v)
+			return
+		}
+
+		idx, c := n.child(s[0])
+		if c == nil {
+			leaf := New[radixNode[V]](t.ac)
+			leaf.label = t.ac.NewString(s)
+			t.setVal(leaf, key, v)
+			t.addChild(n, idx, leaf)
+			return
+		}
+
+		common := commonPrefixLen(c.label, s)
+		if common == len(c.label) {
+			n, s = c, s[common:]
+			continue
+		}
+
+		// 拆分边, label 都是内存池中已有字符串的子串, 不需要重新拷贝
+		mid := New[radixNode[V]](t.ac)
+		mid.label = c.label[:common]
+		c.label = c.label[common:]
+		mid.children = NewSlice[*radixNode[V]](t.ac, 1, 2)
+		mid.children[0] = c
+		n.children[idx] = mid
+		n, s = mid, s[common:]
+	}
+}
+
+// Get 精确查找
+func (t *Radix[V]) Get(key string) (v V, ok bool) {
+	n, s := &t.root, key
+	for len(s) > 0 {
+		_, c := n.child(s[0])
+		if c == nil || !strings.HasPrefix(s, c.label) {
+			return v, false
+		}
+		n, s = c, s[len(c.label):]
+	}
+	return n.val, n.hasVal
+}
+
+// LongestPrefix 查找是 s 前缀的最长 key
+func (t *Radix[V]) LongestPrefix(s string) (key string, v V, ok bool) {
+	n := &t.root
+	for {
+		if n.hasVal {
+			key, v, ok = n.key, n.val, true
+		}
+		if len(s) == 0 {
+			return
+		}
+		_, c := n.child(s[0])
+		if c == nil || !strings.HasPrefix(s, c.label) {
+			return
+		}
+		n, s = c, s[len(c.label):]
+	}
+}
+
+// WalkPrefix 按字典序遍历所有以 prefix 开头的 key, f 返回 false 时停止
+func (t *Radix[V]) WalkPrefix(prefix string, f func(key string, v V) bool) {
+	n, s := &t.root, prefix
+	for len(s) > 0 {
+		_, c := n.child(s[0])
+		if c == nil {
+			return
+		}
+		if strings.HasPrefix(s, c.label) {
+			n, s = c, s[len(c.label):]
+			continue
+		}
+		if !strings.HasPrefix(c.label, s) {
+			return
+		}
+		n, s = c, ""
+	}
+	walkRadix(n, f)
+}
+
+// Walk 按字典序遍历所有 key
+func (t *Radix[V]) Walk(f func(key string, v V) bool) {
+	walkRadix(&t.root, f)
+}
+
+func walkRadix[V any](n *radixNode[V], f func(key string, v V) bool) bool {
+	if n.hasVal && !f(n.key, n.val) {
+		return false
+	}
+	for _, c := range n.children {
+		if !walkRadix(c, f) {
+			return false
+		}
+	}
+	return true
+}
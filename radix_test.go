@@ -0,0 +1,83 @@
+package memorypool
+
+import (
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRadix(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	r := NewRadix[int](ac)
+	keys := []string{"/api/v1/users", "/api/v1/user", "/api/v2", "/api", "/static/css", "/"}
+	for i, k := range keys {
+		r.Insert(string([]byte(k)), i) // 堆上的 key 会被拷贝进内存池
+	}
+	r.Insert("/api", 100)
+	runtime.GC()
+
+	assert.EqualValues(t, len(keys), r.Len())
+	for i, k := range keys {
+		v, ok := r.Get(k)
+		assert.True(t, ok, k)
+		if k == "/api" {
+			i = 100
+		}
+		assert.EqualValues(t, i, v)
+	}
+	_, ok := r.Get("/api/v1")
+	assert.False(t, ok)
+	_, ok = r.Get("/api/v3")
+	assert.False(t, ok)
+
+	key, v, ok := r.LongestPrefix("/api/v1/users/123")
+	assert.True(t, ok)
+	assert.EqualValues(t, "/api/v1/users", key)
+	assert.EqualValues(t, 0, v)
+	key, _, _ = r.LongestPrefix("/api/v1/use")
+	assert.EqualValues(t, "/api", key)
+	key, _, _ = r.LongestPrefix("/favicon.ico")
+	assert.EqualValues(t, "/", key)
+
+	var got []string
+	r.WalkPrefix("/api/v", func(key string, v int) bool {
+		got = append(got, key)
+		return true
+	})
+	assert.EqualValues(t, []string{"/api/v1/user", "/api/v1/users", "/api/v2"}, got)
+
+	got = got[:0]
+	r.Walk(func(key string, v int) bool {
+		got = append(got, key)
+		return true
+	})
+	assert.EqualValues(t, []string{"/", "/api", "/api/v1/user", "/api/v1/users", "/api/v2", "/static/css"}, got)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestRadixPointerValue(t *testing.T) {
+	type route struct {
+		name string
+		id   int
+	}
+	ac := NewAlloctorFromPool(0)
+	r := NewRadix[*route](ac)
+	for i := 0; i < 1000; i++ {
+		s := strconv.Itoa(i)
+		r.Insert("/api/"+s, &route{name: "r" + s, id: i})
+	}
+	runtime.GC() // 值引用的堆对象只被内存池引用
+	runtime.GC()
+
+	for i := 0; i < 1000; i++ {
+		s := strconv.Itoa(i)
+		v, ok := r.Get("/api/" + s)
+		assert.True(t, ok)
+		assert.EqualValues(t, route{name: "r" + s, id: i}, *v)
+	}
+
+	runtime.KeepAlive(ac)
+}
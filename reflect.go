@@ -0,0 +1,73 @@
+package memorypool
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// zeroBase 长度为 0 的切片指向这里, 与 nil 切片区分
+var zeroBase [0]uint64
+
+// NewValue 同 reflect.New, 返回指向内存池中 t 类型零值的指针.
+// 供编解码等只有 reflect.Type 的场景使用, 泛型场景直接使用 New.
+func (ac *Allocator) NewValue(t reflect.Type) reflect.Value {
+	if t.Size() == 0 {
+		return reflect.New(t)
+	}
+	return reflect.NewAt(t, ac.alloc(int64(t.Size())))
+}
+
+// MakeSlice 同 reflect.MakeSlice, 底层数组从内存池分配.
+// cap 为 0 时返回非 nil 的空切片.
+// 返回的 Value 需要引用一个切片头, 栈上的切片头会逃逸到堆上, 因此切片头同样从内存池分配;
+// 结果只用于 Set 到已有的切片时使用 ReallocSlice, 不需要额外的切片头
+func (ac *Allocator) MakeSlice(t reflect.Type, len, cap int) reflect.Value {
+	if t.Kind() != reflect.Slice {
+		panic("MakeSlice: non-slice type " + t.String())
+	}
+	if len < 0 || len > cap {
+		panic("MakeSlice: len out of range")
+	}
+
+	h := New[sliceHeader](ac)
+	h.Data = ac.allocSliceData(t, cap)
+	h.Len = int64(len)
+	h.Cap = int64(cap)
+	return reflect.NewAt(t, unsafe.Pointer(h)).Elem()
+}
+
+// ReallocSlice 把可赋值的切片 v 的底层数组重新从内存池分配, 容量为 cap, 长度和内容不变.
+// 新的切片头直接写入 v; v 为 nil 且 cap 为 0 时变为非 nil 的空切片.
+// 等价于 v.Set(ac.MakeSlice(v.Type(), v.Len(), cap)) 再拷贝原有元素
+func (ac *Allocator) ReallocSlice(v reflect.Value, cap int) {
+	if v.Kind() != reflect.Slice || !v.CanSet() {
+		panic("ReallocSlice: unassignable or non-slice value")
+	}
+	if cap < v.Len() {
+		panic("ReallocSlice: cap out of range")
+	}
+
+	h := (*sliceHeader)(v.Addr().UnsafePointer())
+	old := *h
+	h.Data = ac.allocSliceData(v.Type(), cap)
+	h.Cap = int64(cap)
+	if old.Len > 0 {
+		reflect.Copy(v, reflect.NewAt(v.Type(), unsafe.Pointer(&old)).Elem())
+	}
+}
+
+// allocSliceData 分配 cap 个 t 的元素, cap 为 0 时返回 zeroBase
+func (ac *Allocator) allocSliceData(t reflect.Type, cap int) unsafe.Pointer {
+	p := ac.alloc(int64(cap) * int64(t.Elem().Size()))
+	if p == nil {
+		p = unsafe.Pointer(&zeroBase)
+	}
+	return p
+}
+
+// Unaddressable 返回 v 的不可寻址副本, 仍引用同一块内存, 不拷贝数据.
+// 编码内存池中暂存的 map 元素等值时使用, 使指针方法的 Marshaler 不被调用, 行为同 encoding/json
+func Unaddressable(v reflect.Value) reflect.Value {
+	(*reflectedValue)(unsafe.Pointer(&v)).flag &^= flagAddr
+	return v
+}
@@ -0,0 +1,92 @@
+package memorypool
+
+import (
+	"reflect"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReflectAlloc(t *testing.T) {
+	type item struct {
+		A string
+		B int
+	}
+	ac := NewAlloctorFromPool(0)
+	p := ac.NewValue(reflect.TypeOf(item{}))
+	p.Elem().Field(0).SetString(ac.NewString("hello"))
+	p.Elem().Field(1).SetInt(12)
+	v := p.Interface().(*item)
+
+	s := ac.MakeSlice(reflect.TypeOf([]int{}), 2, 4)
+	s.Index(1).SetInt(3)
+	s = reflect.Append(s, reflect.ValueOf(5))
+	ints := s.Interface().([]int)
+	empty := ac.MakeSlice(reflect.TypeOf([]string{}), 0, 0).Interface().([]string)
+	runtime.GC()
+
+	assert.EqualValues(t, "hello", v.A)
+	assert.EqualValues(t, 12, v.B)
+	assert.EqualValues(t, []int{0, 3, 5}, ints)
+	assert.EqualValues(t, 4, cap(ints))
+	assert.NotNil(t, empty)
+	assert.EqualValues(t, 0, len(empty))
+
+	runtime.KeepAlive(ac)
+}
+
+func TestReallocSlice(t *testing.T) {
+	type item struct {
+		S string
+		P *int
+	}
+	ac := NewAlloctorFromPool(0)
+	var s struct{ Items []item }
+	v := reflect.ValueOf(&s).Elem().Field(0)
+
+	// nil 且 cap 为 0 时变为非 nil 的空切片
+	ac.ReallocSlice(v, 0)
+	assert.NotNil(t, s.Items)
+	assert.EqualValues(t, 0, len(s.Items))
+
+	x := 1
+	for i := 0; i < 100; i++ {
+		if v.Len() == v.Cap() {
+			ac.ReallocSlice(v, 2*v.Cap()+1)
+		}
+		v.SetLen(i + 1)
+		s.Items[i] = item{S: ac.NewString(strconv.Itoa(i)), P: &x}
+	}
+	runtime.GC()
+	for i, it := range s.Items {
+		assert.EqualValues(t, strconv.Itoa(i), it.S)
+		assert.Equal(t, &x, it.P)
+	}
+	assert.Panics(t, func() { ac.ReallocSlice(v, 1) })
+	assert.Panics(t, func() { ac.ReallocSlice(reflect.ValueOf(s.Items), 200) })
+
+	// 切片头直接写入 v, 不产生堆分配
+	n := testing.AllocsPerRun(100, func() {
+		v.SetLen(0)
+		ac.ReallocSlice(v, 8)
+	})
+	assert.EqualValues(t, 0, n)
+
+	runtime.KeepAlive(ac)
+}
+
+func TestUnaddressable(t *testing.T) {
+	var s struct{ A, B int }
+	v := reflect.ValueOf(&s).Elem()
+	u := Unaddressable(v)
+	assert.False(t, u.CanAddr())
+	assert.False(t, u.CanSet())
+	assert.False(t, u.Field(0).CanAddr())
+
+	// 仍引用同一块内存
+	s.A = 3
+	assert.EqualValues(t, 3, u.Field(0).Int())
+	assert.True(t, v.CanAddr())
+}
@@ -0,0 +1,242 @@
+package memorypool
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// 与 strings 包对应的字符串操作, 结果(包括返回的切片)都分配在内存池中.
+
+// BytesToString 不拷贝, 把 b 解释为 string, 之后不能再修改 b
+func BytesToString(b []byte) string {
+	return unsafe.String(unsafe.SliceData(b), len(b))
+}
+
+// StringToBytes 不拷贝, 把 s 解释为 []byte, 返回值不能修改
+func StringToBytes(s string) []byte {
+	return unsafe.Slice(unsafe.StringData(s), len(s))
+}
+
+// Join 同 strings.Join
+func (ac *Allocator) Join(elems []string, sep string) string {
+	switch len(elems) {
+	case 0:
+		return ""
+	case 1:
+		return ac.NewString(elems[0])
+	}
+
+	n := len(sep) * (len(elems) - 1)
+	for _, e := range elems {
+		n += len(e)
+	}
+	b := ac.newBytes(n)[:0]
+	b = append(b, elems[0]...)
+	for _, e := range elems[1:] {
+		b = append(b, sep...)
+		b = append(b, e...)
+	}
+	return BytesToString(b)
+}
+
+// Repeat 同 strings.Repeat
+func (ac *Allocator) Repeat(s string, count int) string {
+	if count < 0 {
+		panic("memorypool: negative Repeat count")
+	}
+	if len(s) > 0 && len(s)*count/count != len(s) {
+		panic("memorypool: Repeat output length overflow")
+	}
+	n := len(s) * count
+	if n == 0 {
+		return ""
+	}
+	b := ac.newBytes(n)
+	bp := copy(b, s)
+	for bp < n {
+		bp += copy(b[bp:], b[:bp])
+	}
+	return BytesToString(b)
+}
+
+// TrimSpace 同 strings.TrimSpace
+func (ac *Allocator) TrimSpace(s string) string {
+	return ac.NewString(strings.TrimSpace(s))
+}
+
+// Map 同 strings.Map
+func (ac *Allocator) Map(mapping func(rune) rune, s string) string {
+	b := ac.Builder()
+	b.Grow(len(s))
+	for _, c := range s {
+		if r := mapping(c); r >= 0 {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// ToUpper 同 strings.ToUpper
+func (ac *Allocator) ToUpper(s string) string {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return ac.Map(unicode.ToUpper, s)
+		}
+	}
+	b := ac.newBytes(len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		b[i] = c
+	}
+	return BytesToString(b)
+}
+
+// ToLower 同 strings.ToLower
+func (ac *Allocator) ToLower(s string) string {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return ac.Map(unicode.ToLower, s)
+		}
+	}
+	b := ac.newBytes(len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		b[i] = c
+	}
+	return BytesToString(b)
+}
+
+// Replace 同 strings.Replace, 结果一次性按最终长度分配
+func (ac *Allocator) Replace(s, old, new string, n int) string {
+	if old == new || n == 0 {
+		return ac.NewString(s)
+	}
+
+	if m := strings.Count(s, old); m == 0 {
+		return ac.NewString(s)
+	} else if n < 0 || m < n {
+		n = m
+	}
+
+	b := ac.newBytes(len(s) + n*(len(new)-len(old)))[:0]
+	start := 0
+	for i := 0; i < n; i++ {
+		j := start
+		if len(old) == 0 {
+			if i > 0 {
+				_, wid := utf8.DecodeRuneInString(s[start:])
+				j += wid
+			}
+		} else {
+			j += strings.Index(s[start:], old)
+		}
+		b = append(b, s[start:j]...)
+		b = append(b, new...)
+		start = j + len(old)
+	}
+	b = append(b, s[start:]...)
+	return BytesToString(b)
+}
+
+// ReplaceAll 同 strings.ReplaceAll
+func (ac *Allocator) ReplaceAll(s, old, new string) string {
+	return ac.Replace(s, old, new, -1)
+}
+
+// SplitInto 同 strings.Split, s 会先拷贝进内存池, 返回的切片及其中的字符串都在内存池中
+func SplitInto(ac *Allocator, s, sep string) []string {
+	return SplitNInto(ac, s, sep, -1)
+}
+
+// SplitNInto 同 strings.SplitN
+func SplitNInto(ac *Allocator, s, sep string, n int) []string {
+	if n == 0 {
+		return nil
+	}
+	if sep == "" {
+		return explodeInto(ac, s, n)
+	}
+	if n < 0 {
+		n = strings.Count(s, sep) + 1
+	}
+	if n > len(s)+1 {
+		n = len(s) + 1
+	}
+
+	s = ac.NewString(s)
+	a := NewSlice[string](ac, n, n)
+	n--
+	i := 0
+	for i < n {
+		m := strings.Index(s, sep)
+		if m < 0 {
+			break
+		}
+		a[i] = s[:m]
+		s = s[m+len(sep):]
+		i++
+	}
+	a[i] = s
+	return a[:i+1]
+}
+
+// explodeInto 按 UTF-8 字符拆分, 最多 n 个
+func explodeInto(ac *Allocator, s string, n int) []string {
+	l := utf8.RuneCountInString(s)
+	if n < 0 || n > l {
+		n = l
+	}
+	s = ac.NewString(s)
+	a := NewSlice[string](ac, n, n)
+	for i := 0; i < n-1; i++ {
+		_, size := utf8.DecodeRuneInString(s)
+		a[i] = s[:size]
+		s = s[size:]
+	}
+	if n > 0 {
+		a[n-1] = s
+	}
+	return a
+}
+
+// FieldsInto 同 strings.Fields
+func FieldsInto(ac *Allocator, s string) []string {
+	n := 0
+	inField := false
+	for _, r := range s {
+		wasInField := inField
+		inField = !unicode.IsSpace(r)
+		if inField && !wasInField {
+			n++
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+
+	s = ac.NewString(s)
+	a := NewSlice[string](ac, 0, n)
+	start := -1
+	for i, r := range s {
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				a = append(a, s[start:i])
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		a = append(a, s[start:])
+	}
+	return a
+}
@@ -0,0 +1,46 @@
+package memorypool
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStrUtil(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	heap := func(s string) string { return string([]byte(s)) }
+
+	upper := ac.ToUpper(heap("hello, World"))
+	upperU := ac.ToUpper(heap("héllo wörld"))
+	lower := ac.ToLower(heap("HELLO, World"))
+	repl := ac.Replace(heap("oink oink oink"), "k", "ky", 2)
+	replAll := ac.ReplaceAll(heap("oink oink oink"), "oink", "moo")
+	replEmpty := ac.ReplaceAll(heap("ab"), "", "-")
+	join := ac.Join([]string{heap("a"), heap("b"), heap("c")}, ", ")
+	repeat := ac.Repeat(heap("ab"), 3)
+	trim := ac.TrimSpace(heap(" \t x y \n"))
+	split := SplitInto(ac, heap("a,b,,c"), ",")
+	splitN := SplitNInto(ac, heap("a,b,c"), ",", 2)
+	explode := SplitInto(ac, heap("a中c"), "")
+	fields := FieldsInto(ac, heap("  foo bar  baz   "))
+	runtime.GC()
+
+	assert.EqualValues(t, "HELLO, WORLD", upper)
+	assert.EqualValues(t, strings.ToUpper("héllo wörld"), upperU)
+	assert.EqualValues(t, "hello, world", lower)
+	assert.EqualValues(t, "oinky oinky oink", repl)
+	assert.EqualValues(t, "moo moo moo", replAll)
+	assert.EqualValues(t, "-a-b-", replEmpty)
+	assert.EqualValues(t, "a, b, c", join)
+	assert.EqualValues(t, "ababab", repeat)
+	assert.EqualValues(t, "x y", trim)
+	assert.EqualValues(t, []string{"a", "b", "", "c"}, split)
+	assert.EqualValues(t, []string{"a", "b,c"}, splitN)
+	assert.EqualValues(t, []string{"a", "中", "c"}, explode)
+	assert.EqualValues(t, []string{"foo", "bar", "baz"}, fields)
+	assert.Nil(t, FieldsInto(ac, "   "))
+
+	runtime.KeepAlive(ac)
+}
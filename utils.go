@@ -19,6 +19,7 @@ import (
 
 const (
 	flagIndir uintptr = 1 << 7
+	flagAddr  uintptr = 1 << 8
 	ptrSize           = int64(unsafe.Sizeof(uintptr(0)))
 )
 
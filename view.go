@@ -0,0 +1,71 @@
+package memorypool
+
+import (
+	"reflect"
+	"sync"
+	"unsafe"
+)
+
+// pointerFreeTypes 缓存类型是否不含指针, reflect.Type.Field 会分配内存
+var pointerFreeTypes sync.Map // map[reflect.Type]bool
+
+// pointerFree t 的内存中是否一定没有指针
+func pointerFree(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Array:
+		return t.Len() == 0 || pointerFree(t.Elem())
+	case reflect.Struct:
+		if v, ok := pointerFreeTypes.Load(t); ok {
+			return v.(bool)
+		}
+		free := true
+		for i := 0; i < t.NumField() && free; i++ {
+			free = pointerFree(t.Field(i).Type)
+		}
+		pointerFreeTypes.Store(t, free)
+		return free
+	}
+	return !mayContainsPtr(t.Kind())
+}
+
+// checkView 检查 b 能否按 T 解释: T 不含指针, b 的起始地址满足 T 的对齐
+func checkView[T any](name string, b []byte) {
+	var zero T
+	if !pointerFree(reflect.TypeOf((*T)(nil)).Elem()) {
+		panic(name + ": element type " + reflect.TypeOf((*T)(nil)).Elem().String() + " contains pointers")
+	}
+	if uintptr(unsafe.Pointer(unsafe.SliceData(b)))%unsafe.Alignof(zero) != 0 {
+		panic(name + ": misaligned buffer")
+	}
+}
+
+// View 不拷贝, 把 b 开头的 sizeof(T) 个字节解释为 *T, 返回值与 b 共享内存.
+// T 不能包含指针, b 的长度不能小于 sizeof(T), 起始地址需要满足 T 的对齐, 否则 panic.
+// 字节序为本机字节序, 需要指定字节序时使用 BinaryReader
+func View[T any](b []byte) *T {
+	var zero T
+	if uintptr(len(b)) < unsafe.Sizeof(zero) {
+		panic("View: buffer too short")
+	}
+	checkView[T]("View", b)
+	return (*T)(unsafe.Pointer(unsafe.SliceData(b)))
+}
+
+// ViewSlice 不拷贝, 把 b 解释为 []T, 返回值与 b 共享内存.
+// T 不能包含指针且大小不为 0, b 的长度必须是 sizeof(T) 的整数倍, 起始地址需要满足 T 的对齐, 否则 panic.
+// b 为 nil 时返回 nil
+func ViewSlice[T any](b []byte) []T {
+	var zero T
+	size := unsafe.Sizeof(zero)
+	if size == 0 {
+		panic("ViewSlice: zero-size element type")
+	}
+	if uintptr(len(b))%size != 0 {
+		panic("ViewSlice: buffer length is not a multiple of element size")
+	}
+	checkView[T]("ViewSlice", b)
+	if b == nil {
+		return nil
+	}
+	return unsafe.Slice((*T)(unsafe.Pointer(unsafe.SliceData(b))), uintptr(len(b))/size)
+}
@@ -0,0 +1,72 @@
+package memorypool
+
+import (
+	"encoding/binary"
+	"runtime"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type viewHeader struct {
+	Magic   uint32
+	Version uint16
+	Flags   uint16
+	Size    int64
+	Pos     [2]float32
+}
+
+func TestView(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	b := NewSlice[byte](ac, 48, 48)
+	binary.LittleEndian.PutUint32(b, 0xCAFEBABE)
+	binary.LittleEndian.PutUint16(b[4:], 2)
+	binary.LittleEndian.PutUint64(b[8:], uint64(1<<64-5))
+
+	// 假定本机为小端
+	h := View[viewHeader](b)
+	runtime.GC()
+	assert.EqualValues(t, 0xCAFEBABE, h.Magic)
+	assert.EqualValues(t, 2, h.Version)
+	assert.EqualValues(t, -5, h.Size)
+	assert.Equal(t, unsafe.Pointer(&b[0]), unsafe.Pointer(h))
+
+	// 修改 View 直接反映到 b
+	h.Flags = 0x0102
+	assert.EqualValues(t, []byte{2, 1}, b[6:8])
+
+	s := ViewSlice[uint64](b)
+	assert.Len(t, s, 6)
+	s[5] = 1
+	assert.EqualValues(t, 1, b[40])
+	assert.Len(t, ViewSlice[viewHeader](b[:24*2]), 2)
+	assert.Nil(t, ViewSlice[uint32](nil))
+	assert.NotNil(t, ViewSlice[uint32](b[:0]))
+
+	assert.PanicsWithValue(t, "View: buffer too short", func() { View[viewHeader](b[:16]) })
+	assert.PanicsWithValue(t, "View: misaligned buffer", func() { View[uint32](b[1:]) })
+	assert.PanicsWithValue(t, "View: element type *int contains pointers", func() { View[*int](b) })
+	assert.PanicsWithValue(t, "ViewSlice: element type struct { A int; S string } contains pointers", func() {
+		ViewSlice[struct {
+			A int
+			S string
+		}](b)
+	})
+	assert.PanicsWithValue(t, "ViewSlice: buffer length is not a multiple of element size", func() { ViewSlice[uint64](b[:12]) })
+	assert.PanicsWithValue(t, "ViewSlice: zero-size element type", func() { ViewSlice[struct{}](b) })
+
+	runtime.KeepAlive(ac)
+}
+
+func TestViewNoHeapAlloc(t *testing.T) {
+	ac := NewAlloctorFromPool(0)
+	b := NewSlice[byte](ac, 48, 48)
+	View[viewHeader](b)
+	n := testing.AllocsPerRun(100, func() {
+		View[viewHeader](b).Size++
+		ViewSlice[viewHeader](b[:24])[0].Size++
+	})
+	assert.EqualValues(t, 0, n)
+	runtime.KeepAlive(ac)
+}